@@ -14,71 +14,58 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"flag"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	scalar "github.com/MarceloPetrucio/go-scalar-api-reference"
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	_ "github.com/zachatrocity/voyage/docs" // Import generated docs
-	"github.com/zachatrocity/voyage/internal/api/handlers"
+	"github.com/zachatrocity/voyage/internal/api"
+	"github.com/zachatrocity/voyage/internal/config"
 )
 
 func main() {
-	// Create a new Echo instance
-	e := echo.New()
+	configFile := flag.String("config", os.Getenv("VOYAGE_CONFIG"), "YAML config file")
+	listen := flag.String("listen", "", "address to listen on, overriding the config")
+	database := flag.String("database", "", "notmuch database path, overriding the config")
+	flag.Parse()
 
-	// Middleware
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
-
-	// Routes
-	e.GET("/health", handlers.HealthCheck)
-
-	// Serve Swagger JSON file
-	e.Static("/swagger", "./docs")
-
-	// Scalar API documentation endpoint
-	e.GET("/docs", func(c echo.Context) error {
-		htmlContent, err := scalar.ApiReferenceHTML(&scalar.Options{
-			SpecURL: "docs/swagger.json",
-			CustomOptions: scalar.CustomOptions{
-				PageTitle: "Voyage API Documentation",
-			},
-			DarkMode: true,
-		})
-		if err != nil {
-			log.Printf("Error generating API documentation: %v", err)
-			return c.String(http.StatusInternalServerError, fmt.Sprintf("Failed to generate API documentation: %v", err))
-		}
-		return c.HTML(http.StatusOK, htmlContent)
-	})
-
-	// API v1 group
-	v1 := e.Group("/api/v1")
-	{
-		// Search endpoint
-		v1.GET("/search", handlers.Search)
-
-		// Email endpoint
-		v1.GET("/email/:id", handlers.GetEmail)
-
-		// Tag email endpoint
-		v1.POST("/email/:id/tags/:tag", handlers.TagEmail)
+	// Flags override the config file and the environment. Until the config
+	// is applied the configured logger is not set up.
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if *listen != "" {
+		cfg.Server.Listen = *listen
+	}
+	if *database != "" {
+		cfg.Database.Path = *database
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid config:\n%v", err)
+	}
+	cfg.Apply()
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	s, err := api.NewServer(cfg)
+	if err != nil {
+		slog.Error("Failed to start server", "error", err)
+		os.Exit(1)
 	}
 
-	// Start the server
-	log.Printf("Starting server on port %s", port)
-	if err := e.Start(":" + port); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Failed to start server: %v", err)
+	// Start the server, draining it on SIGTERM or an interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("Starting server", "listen", cfg.Server.Listen)
+	err = s.Serve(ctx, cfg.Server.Listen, time.Duration(cfg.Server.ShutdownTimeout))
+	if err != nil && err != http.ErrServerClosed {
+		stop()
+		slog.Error("Server failed", "error", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+
+	"github.com/urfave/cli/v2"
+	"github.com/zachatrocity/voyage/internal/trips"
+)
+
+var exportCommand = &cli.Command{
+	Name:  "export",
+	Usage: "export trips with their emails and reservations",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "trip",
+			Usage: "export only the named trip; may be repeated",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		names := c.StringSlice("trip")
+		if len(names) == 0 {
+			list, err := trips.List()
+			if err != nil {
+				return err
+			}
+			for _, trip := range list {
+				names = append(names, trip.Name)
+			}
+		}
+
+		exported := []*trips.Trip{}
+		for _, name := range names {
+			trip, err := trips.Get(c.Context, name)
+			if err != nil {
+				return err
+			}
+			exported = append(exported, trip)
+		}
+
+		return output(c, exported, func(w io.Writer) {
+			row(w, append([]string{"TRIP"}, reservationHeader...)...)
+			for _, trip := range exported {
+				reservationTable(w, trip.Reservations, trip.Name)
+			}
+		})
+	},
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/urfave/cli/v2"
+	"github.com/zachatrocity/voyage/internal/extract"
+	"github.com/zachatrocity/voyage/internal/mailsync"
+)
+
+var extractCommand = &cli.Command{
+	Name:      "extract",
+	Usage:     "print the reservations found in an email file, without the database",
+	ArgsUsage: "FILE.eml",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("an email file is required")
+		}
+
+		reservations, err := extract.FromFile("", c.Args().First())
+		if err != nil {
+			return err
+		}
+		if reservations == nil {
+			reservations = []extract.Reservation{}
+		}
+
+		return output(c, reservations, func(w io.Writer) {
+			row(w, reservationHeader...)
+			reservationTable(w, reservations)
+		})
+	},
+}
+
+var syncCommand = &cli.Command{
+	Name:  "sync",
+	Usage: "index new mail, drop deleted files and extract reservations from new emails",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "tag",
+			Usage: "tags added to new emails, overriding sync.new_tags",
+		},
+		&cli.BoolFlag{
+			Name:  "no-extract",
+			Usage: "skip extracting reservations from new emails, overriding extract.new_mail",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		newTags := cfg.Sync.NewTags
+		if c.IsSet("tag") {
+			newTags = c.StringSlice("tag")
+		}
+
+		extractNew := cfg.Extract.NewMail && !c.Bool("no-extract")
+		result, err := mailsync.Sync(c.Context, newTags, extractNew)
+		if err != nil {
+			return err
+		}
+
+		return output(c, result, func(w io.Writer) {
+			fmt.Fprintf(w, "Added %d emails (%d files), removed %d emails (%d files), ignored %d files, %d unreadable\n",
+				len(result.Added), result.AddedFiles, result.Removed, result.RemovedFiles, result.Ignored, result.Unreadable)
+			if extractNew {
+				fmt.Fprintf(w, "Extracted %d reservations, %d emails failed\n", result.Reservations, result.Failed)
+			}
+		})
+	},
+}
@@ -0,0 +1,77 @@
+// Command voyage searches, tags and files travel emails straight from the
+// notmuch database, without the HTTP API running, and serves the API itself.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/urfave/cli/v2"
+	"github.com/zachatrocity/voyage/internal/config"
+)
+
+// cfg is the configuration loaded before any command runs
+var cfg *config.Config
+
+func main() {
+	app := &cli.App{
+		Name:  "voyage",
+		Usage: "search and organise travel emails in a notmuch database",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print results as JSON instead of a table",
+			},
+			&cli.StringFlag{
+				Name:    "config",
+				Usage:   "YAML config file",
+				EnvVars: []string{"VOYAGE_CONFIG"},
+			},
+			&cli.StringFlag{
+				Name:  "database",
+				Usage: "notmuch database path, overriding the config",
+			},
+		},
+		Before: loadConfig,
+		Commands: []*cli.Command{
+			serveCommand,
+			searchCommand,
+			showCommand,
+			tagCommand,
+			tripsCommand,
+			extractCommand,
+			syncCommand,
+			exportCommand,
+		},
+	}
+
+	// An interrupt stops serve and sync cleanly instead of killing them
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := app.RunContext(ctx, os.Args)
+	stop()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "voyage:", err)
+		os.Exit(1)
+	}
+}
+
+// loadConfig layers the global flags over the config file and the
+// environment
+func loadConfig(c *cli.Context) error {
+	var err error
+	cfg, err = config.Load(c.String("config"))
+	if err != nil {
+		return err
+	}
+	if c.IsSet("database") {
+		cfg.Database.Path = c.String("database")
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
+	cfg.Apply()
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/zachatrocity/voyage/internal/extract"
+)
+
+// output prints v as indented JSON when --json is set, and otherwise lets
+// table write it as aligned columns
+func output(c *cli.Context, v interface{}, table func(w io.Writer)) error {
+	if c.Bool("json") {
+		enc := json.NewEncoder(c.App.Writer)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(c.App.Writer, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// row writes the tab-separated columns of a table row
+func row(w io.Writer, columns ...string) {
+	fmt.Fprintln(w, strings.Join(columns, "\t"))
+}
+
+// formatTime renders a time for a table in its own zone, so reservations
+// show local times at the airport or hotel, or - when it is not set
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// orDash renders an empty column as -
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// reservationTable writes one row per reservation, prefixed by the given
+// leading column values
+func reservationTable(w io.Writer, reservations []extract.Reservation, lead ...string) {
+	for _, res := range reservations {
+		route := ""
+		if res.Origin != "" || res.Destination != "" {
+			route = orDash(res.Origin) + " -> " + orDash(res.Destination)
+		}
+		columns := append(append([]string{}, lead...),
+			res.Type,
+			orDash(res.Name),
+			orDash(res.Confirmation),
+			orDash(route),
+			formatTime(res.StartAt),
+			formatTime(res.EndAt),
+			res.Status,
+		)
+		row(w, columns...)
+	}
+}
+
+// reservationHeader is the header row matching reservationTable
+var reservationHeader = []string{"TYPE", "NAME", "CONFIRMATION", "ROUTE", "START", "END", "STATUS"}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"github.com/zachatrocity/voyage/internal/extract"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+	"github.com/zachatrocity/voyage/internal/query"
+)
+
+var searchCommand = &cli.Command{
+	Name:      "search",
+	Usage:     "search emails with a notmuch query",
+	ArgsUsage: "QUERY...",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "maximum number of results",
+			Value: 50,
+		},
+		&cli.StringFlag{
+			Name:  "sort",
+			Usage: "sort order: newest_first or oldest_first",
+			Value: "newest_first",
+		},
+		&cli.StringFlag{
+			Name:  "syntax",
+			Usage: "query syntax: xapian or sexp",
+			Value: string(notmuch.SyntaxXapian),
+		},
+		&cli.StringFlag{
+			Name:  "exclude",
+			Usage: "comma-separated tags to hide unless the query names them, replacing VOYAGE_EXCLUDE_TAGS",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		q := strings.Join(c.Args().Slice(), " ")
+		if q == "" {
+			return errors.New("a query is required")
+		}
+
+		syntax, err := notmuch.ParseSyntax(c.String("syntax"))
+		if err != nil {
+			return err
+		}
+		opts := notmuch.QueryOptions{Syntax: syntax, Exclude: notmuch.DefaultExcludeTags}
+		if c.IsSet("exclude") {
+			opts.Exclude = notmuch.ParseTagList(c.String("exclude"))
+		}
+
+		// Report malformed queries with positions instead of a Xapian error
+		report := query.Validate(q)
+		if syntax == notmuch.SyntaxSexp {
+			report = query.ValidateSexp(q)
+		}
+		if !report.Valid {
+			return fmt.Errorf("invalid query: %s", report.Errors[0])
+		}
+
+		sortType := notmuch.SortNewestFirst
+		if c.String("sort") == "oldest_first" {
+			sortType = notmuch.SortOldestFirst
+		}
+
+		results, err := notmuch.SearchWithOptions(c.Context, q, strconv.Itoa(c.Int("limit")), sortType, opts)
+		if err != nil {
+			return err
+		}
+
+		return output(c, results, func(w io.Writer) {
+			row(w, "DATE", "FROM", "SUBJECT", "TAGS", "MESSAGE ID")
+			for _, email := range results.Results {
+				row(w, formatTime(email.Date), email.From, email.Subject, strings.Join(email.Tags, ","), email.MessageID)
+			}
+		})
+	},
+}
+
+// shownEmail is an email printed by the show command
+type shownEmail struct {
+	notmuch.EmailResult
+	Reservations []extract.Reservation `json:"reservations"`
+}
+
+var showCommand = &cli.Command{
+	Name:      "show",
+	Usage:     "show an email and the reservations extracted from it",
+	ArgsUsage: "MESSAGE-ID",
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return errors.New("a message ID is required")
+		}
+
+		email, err := notmuch.GetEmail(strings.TrimPrefix(c.Args().First(), "id:"))
+		if err != nil {
+			return err
+		}
+
+		reservations, err := extract.Extract(c.Context, email.MessageID, email.Filename)
+		if err != nil {
+			return err
+		}
+		if reservations == nil {
+			reservations = []extract.Reservation{}
+		}
+
+		shown := shownEmail{EmailResult: *email, Reservations: reservations}
+		return output(c, shown, func(w io.Writer) {
+			row(w, "Message ID:", email.MessageID)
+			row(w, "Thread ID:", email.ThreadID)
+			row(w, "Date:", formatTime(email.Date))
+			row(w, "From:", email.From)
+			row(w, "Subject:", email.Subject)
+			row(w, "Tags:", strings.Join(email.Tags, ","))
+			row(w, "File:", email.Filename)
+			if len(reservations) > 0 {
+				row(w)
+				row(w, reservationHeader...)
+				reservationTable(w, reservations)
+			}
+		})
+	},
+}
+
+// tagResult is printed by the tag command
+type tagResult struct {
+	Query   string   `json:"query"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed int      `json:"changed"`
+}
+
+var tagCommand = &cli.Command{
+	Name:      "tag",
+	Usage:     "add and remove tags on every email matching a query",
+	ArgsUsage: "+TAG|-TAG... [--] QUERY...",
+	// -tag removes a tag, so the arguments are not parsed as flags
+	SkipFlagParsing: true,
+	Action: func(c *cli.Context) error {
+		result := tagResult{Added: []string{}, Removed: []string{}}
+
+		args := c.Args().Slice()
+		for len(args) > 0 {
+			arg := args[0]
+			if arg == "--" {
+				args = args[1:]
+				break
+			}
+			if strings.HasPrefix(arg, "+") && len(arg) > 1 {
+				result.Added = append(result.Added, arg[1:])
+			} else if strings.HasPrefix(arg, "-") && len(arg) > 1 {
+				result.Removed = append(result.Removed, arg[1:])
+			} else {
+				break
+			}
+			args = args[1:]
+		}
+		result.Query = strings.Join(args, " ")
+
+		if len(result.Added) == 0 && len(result.Removed) == 0 {
+			return errors.New("at least one +TAG or -TAG is required")
+		}
+		if result.Query == "" {
+			return errors.New("a query is required")
+		}
+		if report := query.Validate(result.Query); !report.Valid {
+			return fmt.Errorf("invalid query: %s", report.Errors[0])
+		}
+
+		err := notmuch.WithAtomic(func(tx *notmuch.Tx) error {
+			var err error
+			result.Changed, err = tx.TagMessages(result.Query, result.Added, result.Removed)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		return output(c, result, func(w io.Writer) {
+			fmt.Fprintf(w, "Tagged %d emails\n", result.Changed)
+		})
+	},
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/zachatrocity/voyage/internal/api"
+)
+
+var serveCommand = &cli.Command{
+	Name:  "serve",
+	Usage: "serve the HTTP API",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "listen",
+			Usage: "address to listen on, overriding the config",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.IsSet("listen") {
+			cfg.Server.Listen = c.String("listen")
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+		}
+
+		s, err := api.NewServer(cfg)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("Starting server", "listen", cfg.Server.Listen)
+		err = s.Serve(c.Context, cfg.Server.Listen, time.Duration(cfg.Server.ShutdownTimeout))
+		if err != nil && err != http.ErrServerClosed {
+			return err
+		}
+		return nil
+	},
+}
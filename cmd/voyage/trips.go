@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+	"github.com/zachatrocity/voyage/internal/trips"
+)
+
+var tripsCommand = &cli.Command{
+	Name:  "trips",
+	Usage: "list, create and show trips",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "list",
+			Usage: "list every trip with its email count",
+			Action: func(c *cli.Context) error {
+				list, err := trips.List()
+				if err != nil {
+					return err
+				}
+
+				return output(c, list, func(w io.Writer) {
+					row(w, "NAME", "EMAILS")
+					for _, trip := range list {
+						row(w, trip.Name, strconv.Itoa(trip.Count))
+					}
+				})
+			},
+		},
+		{
+			Name:      "create",
+			Usage:     "file every email matching a query under a new trip",
+			ArgsUsage: "NAME QUERY...",
+			Action: func(c *cli.Context) error {
+				if c.NArg() < 2 {
+					return errors.New("a trip name and a query are required")
+				}
+
+				trip, err := trips.Create(c.Args().First(), strings.Join(c.Args().Tail(), " "))
+				if err != nil {
+					return err
+				}
+
+				return output(c, trip, func(w io.Writer) {
+					fmt.Fprintf(w, "Created trip %s with %d emails\n", trip.Name, trip.Count)
+				})
+			},
+		},
+		{
+			Name:      "show",
+			Usage:     "show the emails and reservations of a trip",
+			ArgsUsage: "NAME",
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					return errors.New("a trip name is required")
+				}
+
+				trip, err := trips.Get(c.Context, c.Args().First())
+				if err != nil {
+					return err
+				}
+
+				return output(c, trip, func(w io.Writer) {
+					row(w, "Trip:", trip.Name)
+					row(w, "Emails:", strconv.Itoa(trip.Count))
+					if trip.StartAt != nil && trip.EndAt != nil {
+						row(w, "Dates:", formatTime(*trip.StartAt)+" - "+formatTime(*trip.EndAt))
+					}
+
+					row(w)
+					row(w, "DATE", "FROM", "SUBJECT", "MESSAGE ID")
+					for _, email := range trip.Emails {
+						row(w, formatTime(email.Date), email.From, email.Subject, email.MessageID)
+					}
+
+					if len(trip.Reservations) > 0 {
+						row(w)
+						row(w, reservationHeader...)
+						reservationTable(w, trip.Reservations)
+					}
+				})
+			},
+		},
+	},
+}
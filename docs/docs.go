@@ -23,9 +23,9 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/email/{id}": {
+        "/admin/config": {
             "get": {
-                "description": "Retrieve a single email by its message ID",
+                "description": "Show the configuration the server runs with, after layering the config file, environment variables and flags. API keys are redacted.",
                 "consumes": [
                     "application/json"
                 ],
@@ -33,58 +33,119 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "email"
+                    "admin"
                 ],
-                "summary": "Get email by ID",
+                "summary": "Get the effective configuration",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/config.Config"
+                        }
+                    },
+                    "403": {
+                        "description": "No API keys are configured",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/database": {
+            "get": {
+                "description": "Report the notmuch database version, index size, message count and the latest maintenance operation",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get database information",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Thread ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "type": "boolean",
+                        "default": false,
+                        "description": "Briefly take the writer lock to report whether an upgrade is needed",
+                        "name": "check_upgrade",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/notmuch.EmailResult"
+                            "$ref": "#/definitions/handlers.DatabaseStatus"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "403": {
+                        "description": "No API keys are configured",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "The database is unavailable or being upgraded",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/database/check": {
+            "get": {
+                "description": "Verify that the files of every indexed message still exist on disk. This reads every message and may take a while on large databases.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Check database integrity",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/notmuch.CheckReport"
+                        }
+                    },
+                    "403": {
+                        "description": "No API keys are configured",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "The database is unavailable or being upgraded",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/email/{id}/tags/{tag}": {
+        "/admin/database/compact": {
             "post": {
-                "description": "Add a tag to an email by its message ID",
+                "description": "Rewrite the notmuch database into a smaller copy in the background, moving the original into the backup directory. Reads keep working; writes fail with database_maintenance until it completes. Poll GET /admin/database for progress.",
                 "consumes": [
                     "application/json"
                 ],
@@ -92,65 +153,110 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "email"
+                    "admin"
                 ],
-                "summary": "Tag an email",
-                "parameters": [
-                    {
-                        "type": "string",
-                        "description": "Message ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                "summary": "Compact the database",
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/maintenance.Operation"
+                        }
                     },
-                    {
-                        "type": "string",
-                        "description": "Tag to add",
-                        "name": "tag",
-                        "in": "path",
-                        "required": true
+                    "403": {
+                        "description": "No API keys are configured",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Another maintenance operation is running",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
                     }
+                }
+            }
+        },
+        "/admin/database/upgrade": {
+            "post": {
+                "description": "Upgrade the notmuch database to the latest version supported by libnotmuch in the background. Reads and writes fail with database_maintenance until it completes. Poll GET /admin/database for progress.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
                 ],
+                "summary": "Upgrade the database",
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "202": {
+                        "description": "Accepted",
                         "schema": {
-                            "$ref": "#/definitions/notmuch.EmailResult"
+                            "$ref": "#/definitions/maintenance.Operation"
                         }
                     },
-                    "400": {
-                        "description": "Bad Request",
+                    "403": {
+                        "description": "No API keys are configured",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "409": {
+                        "description": "Another maintenance operation is running",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/health/details": {
+            "get": {
+                "description": "Report the build, the database path, version, revision and whether it needs an upgrade, the last scheduled sync, the processing backlog and the free disk space. Failed checks are reported in the body with status degraded.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Get health diagnostics",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "default": true,
+                        "description": "Briefly take the writer lock to report whether an upgrade is needed",
+                        "name": "check_upgrade",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HealthDetails"
                         }
                     },
-                    "500": {
-                        "description": "Internal Server Error",
+                    "403": {
+                        "description": "No API keys are configured",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/health": {
+        "/changes": {
             "get": {
-                "description": "Get the health status of the API and database connection",
+                "description": "List the emails whose tags, properties or content changed after a database revision, in message ID order. A page cut short by limit carries next; pass it as cursor with the same since and q to get the following page. Once next is absent, pass the returned revision as since on the next call to sync incrementally.",
                 "consumes": [
                     "application/json"
                 ],
@@ -158,23 +264,86 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "health"
+                    "search"
+                ],
+                "summary": "List changed emails",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "default": 0,
+                        "description": "Revision to list changes after; 0 lists every email",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Database UUID returned with the previous changes; a mismatch answers 409",
+                        "name": "uuid",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only list changed emails matching this query",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 500,
+                        "description": "Emails per page, at most 1000",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next of the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated tags to leave out unless the query names them; by default nothing is left out so clients see emails being deleted",
+                        "name": "exclude",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Health check endpoint",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": true
+                            "$ref": "#/definitions/notmuch.Changes"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The revision or cursor belongs to another database or is ahead of it; sync again from 0",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     }
                 }
             }
         },
-        "/search": {
+        "/count": {
             "get": {
-                "description": "Search for emails using notmuch query",
+                "description": "Count the messages, threads or files matching a notmuch query without returning them",
                 "consumes": [
                     "application/json"
                 ],
@@ -184,7 +353,7 @@ const docTemplate = `{
                 "tags": [
                     "search"
                 ],
-                "summary": "Search emails",
+                "summary": "Count emails",
                 "parameters": [
                     {
                         "type": "string",
@@ -195,16 +364,22 @@ const docTemplate = `{
                     },
                     {
                         "type": "string",
-                        "default": "50",
-                        "description": "Result limit",
-                        "name": "limit",
+                        "default": "messages",
+                        "description": "What to count (messages, threads, files)",
+                        "name": "output",
                         "in": "query"
                     },
                     {
                         "type": "string",
-                        "default": "newest_first",
-                        "description": "Sort order (oldest_first, newest_first)",
-                        "name": "sort",
+                        "description": "Comma-separated tags to hide unless the query names them, replacing the configured defaults; empty hides nothing",
+                        "name": "exclude",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "xapian",
+                        "description": "Query syntax (xapian, sexp)",
+                        "name": "syntax",
                         "in": "query"
                     }
                 ],
@@ -212,55 +387,2380 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/notmuch.SearchResults"
+                            "$ref": "#/definitions/handlers.CountResult"
                         }
                     },
                     "400": {
-                        "description": "Bad Request",
+                        "description": "Missing or malformed query, or unknown output",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
                         }
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "notmuch.EmailResult": {
-            "description": "Email search result",
-            "type": "object",
-            "properties": {
-                "date": {
-                    "type": "string",
-                    "example": "2023-01-01T12:00:00Z"
-                },
-                "filename": {
-                    "type": "string",
-                    "example": "/path/to/email.eml"
-                },
-                "from": {
-                    "type": "string",
-                    "example": "sender@example.com"
-                },
-                "message_id": {
-                    "type": "string",
-                    "example": "\u003c12345@example.com\u003e"
-                },
-                "subject": {
-                    "type": "string",
-                    "example": "Flight Confirmation"
+        },
+        "/email/{id}": {
+            "get": {
+                "description": "Retrieve a single email by its message ID. The response carries an ETag derived from the message ID, tags and file name; send it back in If-None-Match to get 304 while they are unchanged.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "email"
+                ],
+                "summary": "Get email by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Thread ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a copy of the email held by the client",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/notmuch.EmailResult"
+                        }
+                    },
+                    "304": {
+                        "description": "The email is unchanged since the ETag was sent"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/email/{id}/reservations": {
+            "get": {
+                "description": "Retrieve the reservations extracted from an email. They are read from the voyage.* message properties, extracting and storing them first when the email has not been extracted yet.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "email"
+                ],
+                "summary": "Get reservations of an email",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Extract the email again, replacing the stored reservations",
+                        "name": "refresh",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/extract.Reservation"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/email/{id}/tags/{tag}": {
+            "post": {
+                "description": "Add a tag to an email by its message ID. With VOYAGE_SYNC_MAILDIR_FLAGS set the Maildir flags of the email are updated too.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "email"
+                ],
+                "summary": "Tag an email",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tag to add",
+                        "name": "tag",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/notmuch.EmailResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Remove a tag from an email by its message ID, e.g. unread to mark it read. With VOYAGE_SYNC_MAILDIR_FLAGS set the Maildir flags of the email are updated too.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "email"
+                ],
+                "summary": "Untag an email",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Message ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Tag to remove",
+                        "name": "tag",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/notmuch.EmailResult"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/health": {
+            "get": {
+                "description": "Get the health status of the API and database connection. Always answers 200; probes should use /livez and /readyz instead.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Health check endpoint",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/livez": {
+            "get": {
+                "description": "Report that the process is serving requests, without touching the database",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Liveness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Report whether the database can be opened and written to. Writability is judged without taking the writer lock, so probes never block notmuch new. Results are reused for 5 seconds.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Readiness probe",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ReadinessResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ReadinessResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/reindex": {
+            "get": {
+                "description": "List the running and recently finished reindex jobs, newest first",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reindex"
+                ],
+                "summary": "List reindex jobs",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/reindex.Job"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Index the messages matching a query again and re-run reservation extraction on them in the background, e.g. after a parser improvement. Excluded messages are included. Poll the returned job for progress.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reindex"
+                ],
+                "summary": "Start a reindex job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search query",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "xapian",
+                        "description": "Query syntax (xapian, sexp)",
+                        "name": "syntax",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Policy for encrypted parts (false, true, auto, nostash); defaults to the database setting",
+                        "name": "decrypt",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/reindex.Job"
+                        }
+                    },
+                    "400": {
+                        "description": "Missing or malformed query, or unknown decrypt policy",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Another reindex job is running",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/reindex/{id}": {
+            "get": {
+                "description": "Retrieve the progress of a reindex job",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reindex"
+                ],
+                "summary": "Get a reindex job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/reindex.Job"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/reindex/{id}/cancel": {
+            "post": {
+                "description": "Stop a running reindex job after the message it is processing. Messages already processed keep their new index.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reindex"
+                ],
+                "summary": "Cancel a reindex job",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Job ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/reindex.Job"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "The job already finished",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/reminders": {
+            "get": {
+                "description": "List the check-in, departure and check-out reminders computed from extracted reservations, soonest first",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "reminders"
+                ],
+                "summary": "List reminders",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only return reminders with this status (pending, fired, cancelled, missed)",
+                        "name": "status",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/reminders.Reminder"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/saved": {
+            "get": {
+                "description": "List saved searches, pinned first, each with its total and unread message counts",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "saved"
+                ],
+                "summary": "List saved searches",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/handlers.SavedSearchResult"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Save a named notmuch query",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "saved"
+                ],
+                "summary": "Create a saved search",
+                "parameters": [
+                    {
+                        "description": "Saved search",
+                        "name": "search",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SavedSearchRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/saved.Search"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/saved/{name}": {
+            "get": {
+                "description": "Retrieve a saved search with its total and unread message counts",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "saved"
+                ],
+                "summary": "Get a saved search",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Saved search name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SavedSearchResult"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Replace the query, sort order and pinned flag of a saved search, or rename it",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "saved"
+                ],
+                "summary": "Update a saved search",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Saved search name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Saved search",
+                        "name": "search",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SavedSearchRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/saved.Search"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Remove a saved search",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "saved"
+                ],
+                "summary": "Delete a saved search",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Saved search name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/saved/{name}/results": {
+            "get": {
+                "description": "Execute a saved search and return the matching emails",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "saved"
+                ],
+                "summary": "Run a saved search",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Saved search name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "50",
+                        "description": "Result limit",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/notmuch.SearchResults"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/search": {
+            "get": {
+                "description": "Search for emails using notmuch query. The response carries an ETag derived from the database revision and the query parameters; send it back in If-None-Match to get 304 while nothing changed. With Accept: application/x-ndjson the results are streamed as they are read, one notmuch.EmailResult per line, without the count, and limit defaults to every matching message. A streamed search failing after its first result ends with a line {\"error\": ErrorResponse} instead.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "application/x-ndjson"
+                ],
+                "tags": [
+                    "search"
+                ],
+                "summary": "Search emails",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search query",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "50",
+                        "description": "Result limit; -1 for every matching message",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "newest_first",
+                        "description": "Sort order (oldest_first, newest_first)",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated tags to hide unless the query names them, replacing the configured defaults; empty hides nothing",
+                        "name": "exclude",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "default": "xapian",
+                        "description": "Query syntax (xapian, sexp)",
+                        "name": "syntax",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "application/x-ndjson to stream the results",
+                        "name": "Accept",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a copy of the results held by the client",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "The results; a stream failing after its first result ends with the line {\"error\": ErrorResponse}",
+                        "schema": {
+                            "$ref": "#/definitions/notmuch.SearchResults"
+                        }
+                    },
+                    "304": {
+                        "description": "The results are unchanged since the ETag was sent"
+                    },
+                    "400": {
+                        "description": "Missing or malformed query; details lists the parse errors",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Search for emails using a JSON query tree that the server compiles into notmuch syntax with correct quoting",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "search"
+                ],
+                "summary": "Search emails with a structured query",
+                "parameters": [
+                    {
+                        "description": "Structured query",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SearchRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/notmuch.SearchResults"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/search/validate": {
+            "get": {
+                "description": "Check a notmuch query string for syntax errors without running it. Error positions are zero-based byte offsets into the query.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "search"
+                ],
+                "summary": "Validate a search query",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Search query",
+                        "name": "q",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "default": "xapian",
+                        "description": "Query syntax (xapian, sexp); sexp queries are only checked for balanced parentheses and quotes",
+                        "name": "syntax",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/query.Report"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/trips": {
+            "get": {
+                "description": "List every trip with the number of emails filed under it. Supports If-None-Match like search.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "trips"
+                ],
+                "summary": "List trips",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ETag of a copy of the list held by the client",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/trips.Trip"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "The trips are unchanged since the ETag was sent"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "File every email matching a query under a new trip tag. Either all matching emails are tagged or none.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "trips"
+                ],
+                "summary": "Create a trip",
+                "parameters": [
+                    {
+                        "description": "Trip",
+                        "name": "trip",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateTripRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/trips.Trip"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/trips/{name}": {
+            "get": {
+                "description": "Retrieve a trip with its emails and the reservations extracted from them. Supports If-None-Match like search.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "trips"
+                ],
+                "summary": "Get a trip",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Trip name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of a copy of the trip held by the client",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/trips.Trip"
+                        }
+                    },
+                    "304": {
+                        "description": "The trip is unchanged since the ETag was sent"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/trips/{name}/merge": {
+            "post": {
+                "description": "Move every email of another trip into this one. Either all emails move or none.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "trips"
+                ],
+                "summary": "Merge trips",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Trip to merge into",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Trip to merge from",
+                        "name": "merge",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.MergeTripRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/trips.Trip"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "description": "List all webhook subscriptions",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhooks",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/webhooks.Webhook"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Subscribe a URL to travel events, optionally filtered by event type and notmuch query",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Create a webhook",
+                "parameters": [
+                    {
+                        "description": "Webhook subscription",
+                        "name": "webhook",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateWebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/webhooks.Webhook"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}": {
+            "get": {
+                "description": "Retrieve a webhook subscription by its ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Get a webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/webhooks.Webhook"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Remove a webhook subscription and its delivery log",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "Delete a webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}/deliveries": {
+            "get": {
+                "description": "Retrieve the delivery log of a webhook, newest first",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "webhooks"
+                ],
+                "summary": "List webhook deliveries",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Webhook ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/webhooks.Delivery"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "config.Auth": {
+            "type": "object",
+            "properties": {
+                "api_keys": {
+                    "description": "APIKeys are accepted as a Bearer token or in the X-API-Key header.\nWhen empty the API is open, except for the admin endpoints.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "[redacted]"
+                    ]
+                }
+            }
+        },
+        "config.Config": {
+            "description": "Effective configuration, with secrets redacted",
+            "type": "object",
+            "properties": {
+                "auth": {
+                    "$ref": "#/definitions/config.Auth"
+                },
+                "database": {
+                    "$ref": "#/definitions/config.Database"
+                },
+                "extract": {
+                    "$ref": "#/definitions/config.Extract"
+                },
+                "file": {
+                    "description": "File is the YAML file the configuration was read from, if any",
+                    "type": "string",
+                    "example": "/config/voyage.yaml"
+                },
+                "limits": {
+                    "$ref": "#/definitions/config.Limits"
+                },
+                "log": {
+                    "$ref": "#/definitions/config.Log"
+                },
+                "reminders": {
+                    "$ref": "#/definitions/config.Reminders"
+                },
+                "search": {
+                    "$ref": "#/definitions/config.Search"
+                },
+                "server": {
+                    "$ref": "#/definitions/config.Server"
+                },
+                "sync": {
+                    "$ref": "#/definitions/config.Sync"
+                }
+            }
+        },
+        "config.Database": {
+            "type": "object",
+            "properties": {
+                "backup_dir": {
+                    "description": "BackupDir receives the original database on every compaction; empty\nmeans \u003cpath\u003e/.notmuch/backups",
+                    "type": "string",
+                    "example": "/mail/.notmuch/backups"
+                },
+                "notmuch_config": {
+                    "description": "NotmuchConfig is the notmuch config file of the user. Its\ndatabase.path, search.exclude_tags, new.tags and\nmaildir.synchronize_flags are the defaults of the settings here, and\nlibnotmuch reads it whenever the database is opened.",
+                    "type": "string",
+                    "example": "/config/notmuch/config"
+                },
+                "path": {
+                    "description": "Path is the mail root holding the notmuch database",
+                    "type": "string",
+                    "example": "/mail"
+                },
+                "state_dir": {
+                    "description": "StateDir keeps webhooks, saved searches and fired reminders; empty\nmeans \u003cpath\u003e/.notmuch/voyage",
+                    "type": "string",
+                    "example": "/mail/.notmuch/voyage"
+                }
+            }
+        },
+        "config.Extract": {
+            "type": "object",
+            "properties": {
+                "new_mail": {
+                    "description": "NewMail extracts the reservations of the emails every sync adds",
+                    "type": "boolean",
+                    "example": true
+                },
+                "parsers": {
+                    "description": "Parsers names the parsers to run, in their registered order; empty\nruns every parser",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "schema.org"
+                    ]
+                }
+            }
+        },
+        "config.Limits": {
+            "type": "object",
+            "properties": {
+                "auth_failures": {
+                    "description": "AuthFailures limits the requests with an invalid API key, per client\nIP; once it is used up the client's keys are not checked any more\nuntil it refills",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/config.RateLimit"
+                        }
+                    ]
+                },
+                "concurrent_searches": {
+                    "description": "ConcurrentSearches bounds the searches running at once; zero leaves\nthem unbounded",
+                    "type": "integer",
+                    "example": 8
+                },
+                "import": {
+                    "$ref": "#/definitions/config.RateLimit"
+                },
+                "import_max_body": {
+                    "type": "string",
+                    "example": "50M"
+                },
+                "max_body": {
+                    "description": "MaxBody caps request bodies, and ImportMaxBody those of the import\nand upload routes, written like 512K or 1M",
+                    "type": "string",
+                    "example": "1M"
+                },
+                "search": {
+                    "description": "Search limits the routes running searches, Write the other requests\nchanging data, and Import the import and upload routes. Requests are\ncounted per API key, or per client IP when the API is open.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/config.RateLimit"
+                        }
+                    ]
+                },
+                "write": {
+                    "$ref": "#/definitions/config.RateLimit"
+                }
+            }
+        },
+        "config.Log": {
+            "type": "object",
+            "properties": {
+                "format": {
+                    "description": "Format is json or text",
+                    "type": "string",
+                    "example": "json"
+                },
+                "level": {
+                    "description": "Level is the minimum level logged: debug, info, warn or error",
+                    "type": "string",
+                    "example": "info"
+                },
+                "redact": {
+                    "description": "Redact is what is hidden from the logs: none, emails for the local\npart of email addresses, or queries for addresses and query terms\nother than tags, dates and folders",
+                    "type": "string",
+                    "example": "queries"
+                }
+            }
+        },
+        "config.RateLimit": {
+            "type": "object",
+            "properties": {
+                "burst": {
+                    "type": "integer",
+                    "example": 30
+                },
+                "rate": {
+                    "description": "Rate is the sustained requests per second; zero disables the limit",
+                    "type": "number",
+                    "example": 10
+                }
+            }
+        },
+        "config.Reminders": {
+            "type": "object",
+            "properties": {
+                "lead_times": {
+                    "description": "LeadTimes override the default lead times, e.g.\n\"flight.checkin-opens=24h,hotel.checkout-today=3h\"",
+                    "type": "string",
+                    "example": "flight.checkin-opens=24h"
+                },
+                "query": {
+                    "description": "Query selects the emails reminders are computed from",
+                    "type": "string",
+                    "example": "tag:travel"
+                }
+            }
+        },
+        "config.Search": {
+            "type": "object",
+            "properties": {
+                "exclude_tags": {
+                    "description": "ExcludeTags hide messages unless the query names the tag",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "deleted",
+                        "spam",
+                        "voyage-ignored"
+                    ]
+                }
+            }
+        },
+        "config.Server": {
+            "type": "object",
+            "properties": {
+                "listen": {
+                    "description": "Listen is the address the API listens on",
+                    "type": "string",
+                    "example": ":8080"
+                },
+                "public_metrics": {
+                    "description": "PublicMetrics serves /metrics without an API key when API keys are\nconfigured, for scrapers that cannot send one",
+                    "type": "boolean",
+                    "example": false
+                },
+                "shutdown_timeout": {
+                    "description": "ShutdownTimeout bounds how long a stopping server waits for requests\nin flight and background work to finish",
+                    "type": "string",
+                    "example": "30s"
+                },
+                "trusted_proxies": {
+                    "description": "TrustedProxies are the IPs or CIDR ranges of the reverse proxies\nwhose X-Forwarded-For header tells the client IP. When empty the IP\nof the connection is used.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "172.16.0.0/12"
+                    ]
+                }
+            }
+        },
+        "config.Sync": {
+            "type": "object",
+            "properties": {
+                "interval": {
+                    "description": "Interval between syncs run by the API server; zero leaves syncing to\nthe mail container or voyage sync",
+                    "type": "string",
+                    "example": "15m"
+                },
+                "maildir_flags": {
+                    "description": "MaildirFlags renames Maildir files when tags change, and turns the\nflags of new mail into tags",
+                    "type": "boolean",
+                    "example": false
+                },
+                "new_tags": {
+                    "description": "NewTags are added to new emails",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "unread",
+                        "inbox"
+                    ]
+                }
+            }
+        },
+        "extract.Reservation": {
+            "description": "Reservation extracted from a travel email",
+            "type": "object",
+            "properties": {
+                "confirmation": {
+                    "type": "string",
+                    "example": "ABC123"
+                },
+                "destination": {
+                    "type": "string",
+                    "example": "JFK"
+                },
+                "end_at": {
+                    "type": "string",
+                    "example": "2023-01-01T16:30:00-05:00"
+                },
+                "end_zone": {
+                    "type": "string",
+                    "example": "America/New_York"
+                },
+                "message_id": {
+                    "type": "string",
+                    "example": "\u003c12345@example.com\u003e"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "UA 123"
+                },
+                "origin": {
+                    "type": "string",
+                    "example": "SFO"
+                },
+                "parser": {
+                    "type": "string",
+                    "example": "schema.org"
+                },
+                "provider": {
+                    "type": "string",
+                    "example": "United Airlines"
+                },
+                "start_at": {
+                    "type": "string",
+                    "example": "2023-01-01T08:00:00-08:00"
+                },
+                "start_zone": {
+                    "description": "StartZone and EndZone name the IANA time zone of the venue when it\nis known, or are floating for a wall clock time at a venue whose\nzone is not",
+                    "type": "string",
+                    "example": "America/Los_Angeles"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "confirmed"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "flight"
+                }
+            }
+        },
+        "handlers.Backlog": {
+            "description": "Messages awaiting processing",
+            "type": "object",
+            "properties": {
+                "extract": {
+                    "description": "Extract counts the new emails a running sync has yet to extract",
+                    "type": "integer",
+                    "example": 0
+                },
+                "reindex": {
+                    "description": "Reindex counts the messages the running reindex job has yet to process",
+                    "type": "integer",
+                    "example": 80
+                }
+            }
+        },
+        "handlers.CountResult": {
+            "description": "Number of messages, threads or files matching a query",
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "exclude_tags": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "deleted",
+                        "spam",
+                        "voyage-ignored"
+                    ]
+                },
+                "output": {
+                    "type": "string",
+                    "example": "messages"
+                },
+                "query": {
+                    "type": "string",
+                    "example": "tag:travel and not tag:trip"
+                }
+            }
+        },
+        "handlers.CreateTripRequest": {
+            "description": "Trip to create",
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "example": "lisbon-2024"
+                },
+                "query": {
+                    "type": "string",
+                    "example": "tag:travel and date:2024-04-01..2024-05-08 and (Lisbon or TAP)"
+                }
+            }
+        },
+        "handlers.CreateWebhookRequest": {
+            "description": "Webhook subscription to create",
+            "type": "object",
+            "properties": {
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "email.tagged"
+                    ]
+                },
+                "query": {
+                    "type": "string",
+                    "example": "tag:flight"
+                },
+                "secret": {
+                    "type": "string",
+                    "example": "s3cr3t"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://chat.example.com/hooks/voyage"
+                }
+            }
+        },
+        "handlers.DatabaseStatus": {
+            "description": "Database information and the latest maintenance operation",
+            "type": "object",
+            "properties": {
+                "last_operation": {
+                    "$ref": "#/definitions/maintenance.Operation"
+                },
+                "maintenance": {
+                    "description": "Maintenance is the operation holding the database, if any",
+                    "type": "string",
+                    "example": "compact"
+                },
+                "messages": {
+                    "type": "integer",
+                    "example": 15230
+                },
+                "needs_upgrade": {
+                    "description": "NeedsUpgrade is only reported when asked for, since libnotmuch needs\nthe writer lock to tell. It is left out while another writer holds\nthe database.",
+                    "type": "boolean",
+                    "example": false
+                },
+                "path": {
+                    "type": "string",
+                    "example": "/mail"
+                },
+                "revision": {
+                    "type": "integer",
+                    "example": 1234
+                },
+                "size_bytes": {
+                    "description": "SizeBytes is the size of the Xapian index on disk",
+                    "type": "integer",
+                    "example": 524288000
+                },
+                "uuid": {
+                    "type": "string",
+                    "example": "4e0a9b2e-2d63-4c1c-9f3e-7d0b5a6c1f2a"
+                },
+                "version": {
+                    "type": "integer",
+                    "example": 3
+                }
+            }
+        },
+        "handlers.ErrorResponse": {
+            "description": "Error response",
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "string",
+                    "example": "not_found"
+                },
+                "details": {},
+                "message": {
+                    "type": "string",
+                    "example": "Email not found"
+                },
+                "request_id": {
+                    "type": "string",
+                    "example": "3Fq9x1bT0uLmZ8kV2cRw7yHn4pDs6aGe"
+                }
+            }
+        },
+        "handlers.HealthDetails": {
+            "description": "Build, database, sync and disk diagnostics",
+            "type": "object",
+            "properties": {
+                "backlog": {
+                    "$ref": "#/definitions/handlers.Backlog"
+                },
+                "build": {
+                    "$ref": "#/definitions/version.Info"
+                },
+                "checks": {
+                    "description": "Checks maps every check to ok or the reason it failed",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "database": {
+                    "$ref": "#/definitions/notmuch.DatabaseInfo"
+                },
+                "disk": {
+                    "$ref": "#/definitions/notmuch.DiskUsage"
+                },
+                "started_at": {
+                    "type": "string",
+                    "example": "2023-01-01T12:00:00Z"
+                },
+                "status": {
+                    "description": "Status is ok, or degraded when a check failed",
+                    "type": "string",
+                    "example": "ok"
+                },
+                "sync": {
+                    "$ref": "#/definitions/handlers.SyncStatus"
+                }
+            }
+        },
+        "handlers.MergeTripRequest": {
+            "description": "Trip to merge into another",
+            "type": "object",
+            "properties": {
+                "from": {
+                    "type": "string",
+                    "example": "porto-2024"
+                }
+            }
+        },
+        "handlers.ReadinessResponse": {
+            "description": "Readiness and the checks behind it",
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "description": "Checks maps every check to ok or the reason it failed",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "status": {
+                    "description": "Status is ready or not_ready",
+                    "type": "string",
+                    "example": "ready"
+                }
+            }
+        },
+        "handlers.SavedSearchRequest": {
+            "description": "Saved search to create or update",
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string",
+                    "example": "unfiled-airline-confirmations"
+                },
+                "pinned": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "query": {
+                    "type": "string",
+                    "example": "tag:travel and subject:confirmation and not tag:trip"
+                },
+                "sort": {
+                    "type": "string",
+                    "example": "newest_first"
+                },
+                "syntax": {
+                    "type": "string",
+                    "example": "xapian"
+                }
+            }
+        },
+        "handlers.SavedSearchResult": {
+            "description": "Saved search with counts",
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer",
+                    "example": 12
+                },
+                "created_at": {
+                    "type": "string",
+                    "example": "2023-01-01T12:00:00Z"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "unfiled-airline-confirmations"
+                },
+                "pinned": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "query": {
+                    "type": "string",
+                    "example": "tag:travel and subject:confirmation and not tag:trip"
+                },
+                "sort": {
+                    "type": "string",
+                    "example": "newest_first"
+                },
+                "syntax": {
+                    "type": "string",
+                    "example": "xapian"
+                },
+                "unread": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2023-01-01T12:00:00Z"
+                }
+            }
+        },
+        "handlers.SearchRequest": {
+            "description": "Structured search request",
+            "type": "object",
+            "properties": {
+                "exclude": {
+                    "description": "Exclude replaces the configured tags hidden from the results; an\nempty list hides nothing",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "deleted",
+                        "spam"
+                    ]
+                },
+                "limit": {
+                    "type": "integer",
+                    "example": 50
+                },
+                "query": {
+                    "$ref": "#/definitions/query.Node"
+                },
+                "sort": {
+                    "type": "string",
+                    "example": "newest_first"
+                }
+            }
+        },
+        "handlers.SyncStatus": {
+            "description": "Scheduled mail sync",
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "last_run": {
+                    "description": "LastRun is when the last sync started",
+                    "type": "string",
+                    "example": "2023-01-01T12:00:00Z"
+                },
+                "result": {
+                    "$ref": "#/definitions/mailsync.Result"
+                },
+                "scheduled": {
+                    "description": "Scheduled reports whether the server syncs new mail itself",
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "mailsync.Result": {
+            "description": "Outcome of syncing the database with the mail directory",
+            "type": "object",
+            "properties": {
+                "added": {
+                    "description": "Added lists the message IDs of the messages new to the database",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "added_files": {
+                    "description": "AddedFiles counts the indexed files, including new copies of known\nmessages",
+                    "type": "integer",
+                    "example": 4
+                },
+                "failed": {
+                    "description": "Failed counts the new emails whose reservations could not be extracted",
+                    "type": "integer",
+                    "example": 0
+                },
+                "ignored": {
+                    "description": "Ignored counts the files that do not look like email",
+                    "type": "integer",
+                    "example": 0
+                },
+                "removed": {
+                    "description": "Removed counts the messages none of whose files exist any more",
+                    "type": "integer",
+                    "example": 1
+                },
+                "removed_files": {
+                    "description": "RemovedFiles counts the indexed files that no longer exist",
+                    "type": "integer",
+                    "example": 1
+                },
+                "reservations": {
+                    "description": "Reservations counts the reservations extracted from new emails",
+                    "type": "integer",
+                    "example": 2
+                },
+                "unreadable": {
+                    "description": "Unreadable counts the files that could not be read. They are tried\nagain once their directory changes.",
+                    "type": "integer",
+                    "example": 0
+                }
+            }
+        },
+        "maintenance.Operation": {
+            "description": "Database maintenance operation",
+            "type": "object",
+            "properties": {
+                "backup_path": {
+                    "description": "BackupPath is where a compaction moved the original database",
+                    "type": "string",
+                    "example": "/mail/.notmuch/backups/xapian-20230101T120000"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "finished_at": {
+                    "type": "string",
+                    "example": "2023-01-01T12:03:00Z"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "6f1c2a9e4b7d3e10"
+                },
+                "messages": {
+                    "description": "Messages are the latest status messages reported by the compaction",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "copying document 1000"
+                    ]
+                },
+                "progress": {
+                    "description": "Progress runs from 0 to 1 during an upgrade",
+                    "type": "number",
+                    "example": 0.5
+                },
+                "started_at": {
+                    "type": "string",
+                    "example": "2023-01-01T12:00:00Z"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "running"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "compact"
+                },
+                "upgraded": {
+                    "description": "Upgraded reports whether an upgrade was needed",
+                    "type": "boolean",
+                    "example": true
+                }
+            }
+        },
+        "notmuch.Changes": {
+            "description": "Messages whose tags, properties or content changed since a revision",
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer",
+                    "example": 3
+                },
+                "next": {
+                    "description": "Next continues a listing cut short by its limit; it is empty on the\nlast page, after which Revision is passed as since",
+                    "type": "string",
+                    "example": "MTIzNCA8MTIzNDVAZXhhbXBsZS5jb20-"
+                },
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notmuch.EmailResult"
+                    }
+                },
+                "revision": {
+                    "description": "Revision is the committed database revision; pass it as since to\nfetch the next changes",
+                    "type": "integer",
+                    "example": 1234
+                },
+                "since": {
+                    "description": "Since is the revision the changes were requested from",
+                    "type": "integer",
+                    "example": 1200
+                },
+                "uuid": {
+                    "description": "UUID identifies the database. Revisions of different databases can\nnot be compared.",
+                    "type": "string",
+                    "example": "4e0a9b2e-2d63-4c1c-9f3e-7d0b5a6c1f2a"
+                }
+            }
+        },
+        "notmuch.CheckReport": {
+            "description": "Database integrity check",
+            "type": "object",
+            "properties": {
+                "messages": {
+                    "type": "integer",
+                    "example": 15230
+                },
+                "messages_without_files": {
+                    "description": "MessagesWithoutFiles counts messages none of whose files exist",
+                    "type": "integer",
+                    "example": 1
+                },
+                "missing_file_count": {
+                    "description": "MissingFileCount counts indexed files that no longer exist",
+                    "type": "integer",
+                    "example": 2
+                },
+                "missing_files": {
+                    "description": "MissingFiles lists up to 100 of the missing files",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "ok": {
+                    "type": "boolean",
+                    "example": false
+                }
+            }
+        },
+        "notmuch.DatabaseInfo": {
+            "description": "Notmuch database information",
+            "type": "object",
+            "properties": {
+                "maintenance": {
+                    "description": "Maintenance is the operation holding the database, if any",
+                    "type": "string",
+                    "example": "compact"
+                },
+                "messages": {
+                    "type": "integer",
+                    "example": 15230
+                },
+                "needs_upgrade": {
+                    "description": "NeedsUpgrade is only reported when asked for, since libnotmuch needs\nthe writer lock to tell. It is left out while another writer holds\nthe database.",
+                    "type": "boolean",
+                    "example": false
+                },
+                "path": {
+                    "type": "string",
+                    "example": "/mail"
+                },
+                "revision": {
+                    "type": "integer",
+                    "example": 1234
+                },
+                "size_bytes": {
+                    "description": "SizeBytes is the size of the Xapian index on disk",
+                    "type": "integer",
+                    "example": 524288000
+                },
+                "uuid": {
+                    "type": "string",
+                    "example": "4e0a9b2e-2d63-4c1c-9f3e-7d0b5a6c1f2a"
+                },
+                "version": {
+                    "type": "integer",
+                    "example": 3
+                }
+            }
+        },
+        "notmuch.DiskUsage": {
+            "description": "Space on the file system holding the database",
+            "type": "object",
+            "properties": {
+                "free_bytes": {
+                    "description": "FreeBytes is the space available to voyage",
+                    "type": "integer",
+                    "example": 10737418240
+                },
+                "path": {
+                    "type": "string",
+                    "example": "/mail"
+                },
+                "total_bytes": {
+                    "type": "integer",
+                    "example": 107374182400
+                }
+            }
+        },
+        "notmuch.EmailResult": {
+            "description": "Email search result",
+            "type": "object",
+            "properties": {
+                "date": {
+                    "type": "string",
+                    "example": "2023-01-01T12:00:00Z"
+                },
+                "filename": {
+                    "type": "string",
+                    "example": "/path/to/email.eml"
+                },
+                "from": {
+                    "type": "string",
+                    "example": "sender@example.com"
+                },
+                "message_id": {
+                    "type": "string",
+                    "example": "\u003c12345@example.com\u003e"
+                },
+                "subject": {
+                    "type": "string",
+                    "example": "Flight Confirmation"
                 },
                 "tags": {
                     "type": "array",
@@ -286,6 +2786,18 @@ const docTemplate = `{
                     "type": "integer",
                     "example": 42
                 },
+                "exclude_tags": {
+                    "description": "ExcludeTags are the tags hidden from the results unless the query\nnames them",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "deleted",
+                        "spam",
+                        "voyage-ignored"
+                    ]
+                },
                 "query": {
                     "type": "string",
                     "example": "subject:flight"
@@ -297,6 +2809,390 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "query.DateRange": {
+            "description": "Date range",
+            "type": "object",
+            "properties": {
+                "after": {
+                    "type": "string",
+                    "example": "2023-01-01"
+                },
+                "before": {
+                    "type": "string",
+                    "example": "2023-12-31"
+                }
+            }
+        },
+        "query.Node": {
+            "description": "Structured search query",
+            "type": "object",
+            "properties": {
+                "and": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/query.Node"
+                    }
+                },
+                "body": {
+                    "type": "string",
+                    "example": "confirmation number"
+                },
+                "date": {
+                    "$ref": "#/definitions/query.DateRange"
+                },
+                "from": {
+                    "type": "string",
+                    "example": "united.com"
+                },
+                "not": {
+                    "$ref": "#/definitions/query.Node"
+                },
+                "or": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/query.Node"
+                    }
+                },
+                "subject": {
+                    "type": "string",
+                    "example": "flight confirmation"
+                },
+                "tag": {
+                    "type": "string",
+                    "example": "travel"
+                },
+                "to": {
+                    "type": "string",
+                    "example": "me@example.com"
+                }
+            }
+        },
+        "query.ParseError": {
+            "description": "Query parse error",
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string",
+                    "example": "unterminated quoted phrase"
+                },
+                "position": {
+                    "description": "Position is the zero-based byte offset of the problem in the query",
+                    "type": "integer",
+                    "example": 12
+                }
+            }
+        },
+        "query.Report": {
+            "description": "Query validation report",
+            "type": "object",
+            "properties": {
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/query.ParseError"
+                    }
+                },
+                "query": {
+                    "type": "string",
+                    "example": "subject:flight and (tag:travel"
+                },
+                "valid": {
+                    "type": "boolean",
+                    "example": false
+                },
+                "warnings": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/query.ParseError"
+                    }
+                }
+            }
+        },
+        "reindex.Job": {
+            "description": "Reindex job",
+            "type": "object",
+            "properties": {
+                "decrypt": {
+                    "type": "string",
+                    "example": "auto"
+                },
+                "done": {
+                    "description": "Done counts the messages processed so far, including failed ones",
+                    "type": "integer",
+                    "example": 40
+                },
+                "error": {
+                    "type": "string"
+                },
+                "failed": {
+                    "description": "Failed counts the messages that could not be reindexed or extracted",
+                    "type": "integer",
+                    "example": 1
+                },
+                "finished_at": {
+                    "type": "string",
+                    "example": "2023-01-01T12:03:00Z"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "6f1c2a9e4b7d3e10"
+                },
+                "query": {
+                    "type": "string",
+                    "example": "tag:travel"
+                },
+                "started_at": {
+                    "type": "string",
+                    "example": "2023-01-01T12:00:00Z"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "running"
+                },
+                "syntax": {
+                    "type": "string",
+                    "example": "xapian"
+                },
+                "total": {
+                    "description": "Total is the number of messages matching the query when the job\nstarted, 0 until the job has looked them up",
+                    "type": "integer",
+                    "example": 120
+                }
+            }
+        },
+        "reminders.Reminder": {
+            "description": "Reminder for an upcoming reservation",
+            "type": "object",
+            "properties": {
+                "confirmation": {
+                    "type": "string",
+                    "example": "ABC123"
+                },
+                "event_at": {
+                    "type": "string",
+                    "example": "2023-01-01T08:00:00-08:00"
+                },
+                "event_zone": {
+                    "type": "string",
+                    "example": "America/Los_Angeles"
+                },
+                "fire_at": {
+                    "type": "string",
+                    "example": "2022-12-31T08:00:00-08:00"
+                },
+                "key": {
+                    "type": "string",
+                    "example": "flight|ABC123|UA 123|checkin-opens|1672588800"
+                },
+                "message": {
+                    "type": "string",
+                    "example": "Online check-in opens"
+                },
+                "message_id": {
+                    "type": "string",
+                    "example": "\u003c12345@example.com\u003e"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "UA 123"
+                },
+                "rule": {
+                    "type": "string",
+                    "example": "checkin-opens"
+                },
+                "status": {
+                    "type": "string",
+                    "example": "pending"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "flight"
+                }
+            }
+        },
+        "saved.Search": {
+            "description": "Saved search",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2023-01-01T12:00:00Z"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "unfiled-airline-confirmations"
+                },
+                "pinned": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "query": {
+                    "type": "string",
+                    "example": "tag:travel and subject:confirmation and not tag:trip"
+                },
+                "sort": {
+                    "type": "string",
+                    "example": "newest_first"
+                },
+                "syntax": {
+                    "type": "string",
+                    "example": "xapian"
+                },
+                "updated_at": {
+                    "type": "string",
+                    "example": "2023-01-01T12:00:00Z"
+                }
+            }
+        },
+        "trips.Trip": {
+            "description": "Trip",
+            "type": "object",
+            "properties": {
+                "count": {
+                    "type": "integer",
+                    "example": 7
+                },
+                "emails": {
+                    "description": "Emails and Reservations are only filled in by Get",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notmuch.EmailResult"
+                    }
+                },
+                "end_at": {
+                    "type": "string",
+                    "example": "2024-05-08T11:00:00+01:00"
+                },
+                "name": {
+                    "type": "string",
+                    "example": "lisbon-2024"
+                },
+                "reservations": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/extract.Reservation"
+                    }
+                },
+                "start_at": {
+                    "description": "StartAt and EndAt span the reservations extracted from the emails",
+                    "type": "string",
+                    "example": "2024-05-01T08:00:00-07:00"
+                },
+                "tag": {
+                    "type": "string",
+                    "example": "trip/lisbon-2024"
+                }
+            }
+        },
+        "version.Info": {
+            "description": "Build information",
+            "type": "object",
+            "properties": {
+                "go_version": {
+                    "type": "string",
+                    "example": "go1.23.4"
+                },
+                "modified": {
+                    "description": "Modified reports uncommitted changes in the checkout",
+                    "type": "boolean",
+                    "example": false
+                },
+                "revision": {
+                    "description": "Revision is the commit the binary was built from, when built from a\ngit checkout",
+                    "type": "string",
+                    "example": "5d98646f0c1e2b3a4d5e6f708192a3b4c5d6e7f8"
+                },
+                "time": {
+                    "description": "Time is the commit time of Revision",
+                    "type": "string",
+                    "example": "2024-05-01T12:00:00Z"
+                },
+                "version": {
+                    "type": "string",
+                    "example": "v1.2.0"
+                }
+            }
+        },
+        "webhooks.Delivery": {
+            "description": "Webhook delivery attempt",
+            "type": "object",
+            "properties": {
+                "attempt": {
+                    "type": "integer",
+                    "example": 1
+                },
+                "duration": {
+                    "type": "string",
+                    "example": "120ms"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "type": "string",
+                    "example": "1a2b3c4d5e6f7a8b"
+                },
+                "event_type": {
+                    "type": "string",
+                    "example": "email.tagged"
+                },
+                "id": {
+                    "type": "string",
+                    "example": "0c9d8e7f6a5b4c3d"
+                },
+                "status_code": {
+                    "type": "integer",
+                    "example": 200
+                },
+                "success": {
+                    "type": "boolean",
+                    "example": true
+                },
+                "timestamp": {
+                    "type": "string",
+                    "example": "2023-01-01T12:00:00Z"
+                },
+                "webhook_id": {
+                    "type": "string",
+                    "example": "6f1c2a9e4b7d3e10"
+                }
+            }
+        },
+        "webhooks.Webhook": {
+            "description": "Webhook subscription",
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string",
+                    "example": "2023-01-01T12:00:00Z"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "email.tagged"
+                    ]
+                },
+                "id": {
+                    "type": "string",
+                    "example": "6f1c2a9e4b7d3e10"
+                },
+                "query": {
+                    "type": "string",
+                    "example": "tag:flight"
+                },
+                "secret": {
+                    "type": "string",
+                    "example": "s3cr3t"
+                },
+                "url": {
+                    "type": "string",
+                    "example": "https://chat.example.com/hooks/voyage"
+                }
+            }
         }
     }
 }`
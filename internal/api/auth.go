@@ -0,0 +1,67 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// apiKeyAuth accepts requests carrying one of keys as a Bearer token or in
+// the X-API-Key header, noting which key was used for the rate limits.
+// Invalid keys are counted per client IP in failures, unless it is nil, and
+// a client that used it up gets 429 without its key being checked, so keys
+// cannot be guessed at speed.
+func apiKeyAuth(keys []string, failures *limiter) echo.MiddlewareFunc {
+	auth := middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		KeyLookup: "header:" + echo.HeaderAuthorization + ":Bearer ,header:X-API-Key",
+		Validator: func(key string, c echo.Context) (bool, error) {
+			for i, k := range keys {
+				if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+					c.Set(apiKeyIndexKey, i)
+					return true, nil
+				}
+			}
+			return false, nil
+		},
+		ErrorHandler: func(err error, c echo.Context) error {
+			// Requests without a key are not guesses
+			var missing *middleware.ErrKeyAuthMissing
+			if failures != nil && !errors.As(err, &missing) {
+				failures.allow("ip:"+c.RealIP(), time.Now())
+			}
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+			return echo.NewHTTPError(http.StatusUnauthorized, "A valid API key is required")
+		},
+	})
+	if failures == nil {
+		return auth
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		check := auth(next)
+		return func(c echo.Context) error {
+			if wait, ok := failures.exhausted("ip:"+c.RealIP(), time.Now()); ok {
+				retryAfter(c, wait)
+				return echo.NewHTTPError(http.StatusTooManyRequests, "Too many invalid API keys")
+			}
+			return check(c)
+		}
+	}
+}
+
+// requireAPIKeys refuses every request while no API keys are configured, for
+// endpoints that must never be open
+func requireAPIKeys(keys []string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if len(keys) == 0 {
+				return echo.NewHTTPError(http.StatusForbidden, "Admin endpoints are disabled until auth.api_keys is set")
+			}
+			return next(c)
+		}
+	}
+}
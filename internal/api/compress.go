@@ -0,0 +1,211 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/labstack/echo/v4"
+)
+
+// compressMinLength is the smallest response worth compressing; smaller
+// ones are sent as they are
+const compressMinLength = 1024
+
+// encoder is a compressing writer that can be reused for another response
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoders pool the writers of every supported content coding, in order
+// of preference
+var encoders = []struct {
+	name string
+	pool *sync.Pool
+}{
+	{"br", &sync.Pool{New: func() interface{} {
+		// Level 4 compresses JSON about as well as gzip's best at a
+		// fraction of the cost of brotli's default
+		return brotli.NewWriterLevel(io.Discard, 4)
+	}}},
+	{"gzip", &sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(io.Discard)
+	}}},
+}
+
+// acceptedEncoding returns the index in encoders of the content coding the
+// client gives the highest q-value, the earlier one on a tie, or -1 when it
+// accepts none. A * entry covers the codings not listed.
+func acceptedEncoding(header string) int {
+	weights := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				q = f
+			}
+		}
+		weights[strings.ToLower(name)] = q
+	}
+
+	best, bestQ := -1, 0.0
+	for i, e := range encoders {
+		q, ok := weights[e.name]
+		if !ok {
+			q = weights["*"]
+		}
+		if q > bestQ {
+			best, bestQ = i, q
+		}
+	}
+	return best
+}
+
+// compress encodes responses of at least compressMinLength bytes with
+// brotli or gzip, whichever the client prefers of those it accepts.
+// Flushing a response sends what was written so far, so streamed responses
+// keep streaming.
+func compress() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			res := c.Response()
+			res.Header().Add(echo.HeaderVary, echo.HeaderAcceptEncoding)
+
+			i := acceptedEncoding(c.Request().Header.Get(echo.HeaderAcceptEncoding))
+			if i < 0 || c.Request().Method == http.MethodHead {
+				return next(c)
+			}
+
+			w := &compressWriter{ResponseWriter: res.Writer, encoding: encoders[i].name, pool: encoders[i].pool}
+			res.Writer = w
+			defer func() {
+				w.close()
+				res.Writer = w.ResponseWriter
+			}()
+
+			return next(c)
+		}
+	}
+}
+
+// compressWriter holds back the start of a response until it knows whether
+// the response is large enough to compress
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	pool     *sync.Pool
+
+	status int
+	buf    []byte
+	// enc is set once the response is being compressed, and plain once
+	// it is being sent as it is
+	enc   encoder
+	plain bool
+}
+
+// WriteHeader records the status, sending it with the first bytes of the
+// body. Responses without a body are sent at once.
+func (w *compressWriter) WriteHeader(status int) {
+	w.status = status
+	if status == http.StatusNoContent || status == http.StatusNotModified || status < http.StatusOK {
+		w.sendPlain()
+	}
+}
+
+// Write holds the body back until compressMinLength bytes are written
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	switch {
+	case w.enc != nil:
+		return w.enc.Write(b)
+	case w.plain:
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= compressMinLength {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// start begins compressing, unless the handler encoded the response itself
+func (w *compressWriter) start() error {
+	if w.Header().Get(echo.HeaderContentEncoding) != "" {
+		return w.sendPlain()
+	}
+
+	header := w.Header()
+	header.Set(echo.HeaderContentEncoding, w.encoding)
+	header.Del(echo.HeaderContentLength)
+	w.ResponseWriter.WriteHeader(w.status)
+
+	w.enc = w.pool.Get().(encoder)
+	w.enc.Reset(w.ResponseWriter)
+	buf := w.buf
+	w.buf = nil
+	_, err := w.enc.Write(buf)
+	return err
+}
+
+// sendPlain sends the status and whatever was held back uncompressed
+func (w *compressWriter) sendPlain() error {
+	if w.plain || w.enc != nil {
+		return nil
+	}
+	w.plain = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush sends what was written so far, compressing it when the response
+// has a body
+func (w *compressWriter) Flush() {
+	switch {
+	case w.enc == nil && !w.plain && len(w.buf) > 0:
+		w.start()
+	case w.enc == nil && !w.plain:
+		w.sendPlain()
+	}
+	if w.enc != nil {
+		w.enc.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// close ends the compressed stream, or sends a response too small to
+// compress
+func (w *compressWriter) close() {
+	if w.enc == nil {
+		w.sendPlain()
+		return
+	}
+	w.enc.Close()
+	w.enc.Reset(io.Discard)
+	w.pool.Put(w.enc)
+	w.enc = nil
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/config"
+	"github.com/zachatrocity/voyage/internal/maintenance"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+)
+
+// Config is the effective configuration shown by GetConfig
+var Config *config.Config
+
+// Maintenance runs the database upgrades and compactions started through the
+// admin endpoints
+var Maintenance *maintenance.Runner
+
+// DatabaseStatus is the response of the database admin endpoint
+// @Description Database information and the latest maintenance operation
+type DatabaseStatus struct {
+	notmuch.DatabaseInfo
+	LastOperation *maintenance.Operation `json:"last_operation,omitempty"`
+}
+
+// GetDatabaseStatus godoc
+// @Summary Get database information
+// @Description Report the notmuch database version, index size, message count and the latest maintenance operation
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param check_upgrade query bool false "Briefly take the writer lock to report whether an upgrade is needed" default(false)
+// @Success 200 {object} DatabaseStatus
+// @Failure 403 {object} ErrorResponse "No API keys are configured"
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse "The database is unavailable or being upgraded"
+// @Router /admin/database [get]
+func GetDatabaseStatus(c echo.Context) error {
+	checkUpgrade, _ := strconv.ParseBool(c.QueryParam("check_upgrade"))
+
+	info, err := notmuch.GetDatabaseInfo(checkUpgrade)
+	if err != nil {
+		return storeError(c, "Failed to read database information", err)
+	}
+
+	status := DatabaseStatus{DatabaseInfo: *info}
+	if op, ok := Maintenance.Last(); ok {
+		status.LastOperation = &op
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
+
+// UpgradeDatabase godoc
+// @Summary Upgrade the database
+// @Description Upgrade the notmuch database to the latest version supported by libnotmuch in the background. Reads and writes fail with database_maintenance until it completes. Poll GET /admin/database for progress.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Success 202 {object} maintenance.Operation
+// @Failure 403 {object} ErrorResponse "No API keys are configured"
+// @Failure 409 {object} ErrorResponse "Another maintenance operation is running"
+// @Router /admin/database/upgrade [post]
+func UpgradeDatabase(c echo.Context) error {
+	op, err := Maintenance.Upgrade()
+	if err != nil {
+		return maintenanceError(c, "Failed to start upgrade", err)
+	}
+
+	return c.JSON(http.StatusAccepted, op)
+}
+
+// CompactDatabase godoc
+// @Summary Compact the database
+// @Description Rewrite the notmuch database into a smaller copy in the background, moving the original into the backup directory. Reads keep working; writes fail with database_maintenance until it completes. Poll GET /admin/database for progress.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Success 202 {object} maintenance.Operation
+// @Failure 403 {object} ErrorResponse "No API keys are configured"
+// @Failure 409 {object} ErrorResponse "Another maintenance operation is running"
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/database/compact [post]
+func CompactDatabase(c echo.Context) error {
+	op, err := Maintenance.Compact()
+	if err != nil {
+		return maintenanceError(c, "Failed to start compaction", err)
+	}
+
+	return c.JSON(http.StatusAccepted, op)
+}
+
+// CheckDatabase godoc
+// @Summary Check database integrity
+// @Description Verify that the files of every indexed message still exist on disk. This reads every message and may take a while on large databases.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} notmuch.CheckReport
+// @Failure 403 {object} ErrorResponse "No API keys are configured"
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse "The database is unavailable or being upgraded"
+// @Router /admin/database/check [get]
+func CheckDatabase(c echo.Context) error {
+	report, err := notmuch.Check()
+	if err != nil {
+		return storeError(c, "Failed to check database", err)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// GetConfig godoc
+// @Summary Get the effective configuration
+// @Description Show the configuration the server runs with, after layering the config file, environment variables and flags. API keys are redacted.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} config.Config
+// @Failure 403 {object} ErrorResponse "No API keys are configured"
+// @Router /admin/config [get]
+func GetConfig(c echo.Context) error {
+	return c.JSON(http.StatusOK, Config.Redacted())
+}
+
+// maintenanceError writes the ErrorResponse for an operation that could not
+// be started
+func maintenanceError(c echo.Context, message string, err error) error {
+	if errors.Is(err, maintenance.ErrBusy) {
+		return errorResponse(c, http.StatusConflict, CodeConflict, err.Error(), nil)
+	}
+	return errorResponse(c, http.StatusInternalServerError, CodeInternal, message+": "+err.Error(), nil)
+}
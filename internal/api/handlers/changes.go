@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+	"github.com/zachatrocity/voyage/internal/query"
+)
+
+// Changes are listed in pages of changesLimit emails unless the request asks
+// for fewer, and never more than maxChangesLimit
+const (
+	changesLimit    = 500
+	maxChangesLimit = 1000
+)
+
+// GetChanges godoc
+// @Summary List changed emails
+// @Description List the emails whose tags, properties or content changed after a database revision, in message ID order. A page cut short by limit carries next; pass it as cursor with the same since and q to get the following page. Once next is absent, pass the returned revision as since on the next call to sync incrementally.
+// @Tags search
+// @Accept json
+// @Produce json
+// @Param since query int false "Revision to list changes after; 0 lists every email" default(0)
+// @Param uuid query string false "Database UUID returned with the previous changes; a mismatch answers 409"
+// @Param q query string false "Only list changed emails matching this query"
+// @Param limit query int false "Emails per page, at most 1000" default(500)
+// @Param cursor query string false "next of the previous page"
+// @Param exclude query string false "Comma-separated tags to leave out unless the query names them; by default nothing is left out so clients see emails being deleted"
+// @Success 200 {object} notmuch.Changes
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "The revision or cursor belongs to another database or is ahead of it; sync again from 0"
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /changes [get]
+func GetChanges(c echo.Context) error {
+	var since uint64
+	if s := c.QueryParam("since"); s != "" {
+		var err error
+		since, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return badRequest(c, "Query parameter 'since' must be a revision number")
+		}
+	}
+
+	q := c.QueryParam("q")
+	if q != "" {
+		if report := query.Validate(q); !report.Valid {
+			return errorResponse(c, http.StatusBadRequest, CodeBadQuery, "Invalid search query", report.Errors)
+		}
+	}
+
+	limit := changesLimit
+	if s := c.QueryParam("limit"); s != "" {
+		var err error
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit <= 0 {
+			return badRequest(c, "Query parameter 'limit' must be a positive number")
+		}
+		if limit > maxChangesLimit {
+			limit = maxChangesLimit
+		}
+	}
+
+	changes, err := notmuch.GetChanges(c.Request().Context(), since, q, excludeParam(c, nil), limit, c.QueryParam("cursor"))
+	switch {
+	case errors.Is(err, notmuch.ErrInvalidCursor):
+		return badRequest(c, "Query parameter 'cursor' must be the next of a previous page")
+	case errors.Is(err, notmuch.ErrStaleCursor):
+		return errorResponse(c, http.StatusConflict, CodeStaleRevision, "Cursor does not belong to the current database; sync again from 0", nil)
+	case err != nil:
+		return storeError(c, "Failed to list changes", err)
+	}
+
+	// Revisions of another database, or one restored from a backup, can not
+	// be compared with the current one
+	uuid := c.QueryParam("uuid")
+	if (uuid != "" && uuid != changes.UUID) || since > changes.Revision {
+		return errorResponse(c, http.StatusConflict, CodeStaleRevision, "Revision does not belong to the current database; sync again from 0", map[string]interface{}{
+			"uuid":     changes.UUID,
+			"revision": changes.Revision,
+		})
+	}
+
+	return c.JSON(http.StatusOK, changes)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+)
+
+// CountResult is the response of the count endpoint
+// @Description Number of messages, threads or files matching a query
+type CountResult struct {
+	Query       string   `json:"query" example:"tag:travel and not tag:trip"`
+	Output      string   `json:"output" example:"messages"`
+	ExcludeTags []string `json:"exclude_tags" example:"deleted,spam,voyage-ignored"`
+	Count       int      `json:"count" example:"12"`
+}
+
+// Count godoc
+// @Summary Count emails
+// @Description Count the messages, threads or files matching a notmuch query without returning them
+// @Tags search
+// @Accept json
+// @Produce json
+// @Param q query string true "Search query"
+// @Param output query string false "What to count (messages, threads, files)" default(messages)
+// @Param exclude query string false "Comma-separated tags to hide unless the query names them, replacing the configured defaults; empty hides nothing"
+// @Param syntax query string false "Query syntax (xapian, sexp)" default(xapian)
+// @Success 200 {object} CountResult
+// @Failure 400 {object} ErrorResponse "Missing or malformed query, or unknown output"
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /count [get]
+func Count(c echo.Context) error {
+	q := c.QueryParam("q")
+	if q == "" {
+		return badRequest(c, "Query parameter 'q' is required")
+	}
+
+	output := c.QueryParam("output")
+	switch output {
+	case "":
+		output = notmuch.OutputMessages
+	case notmuch.OutputMessages, notmuch.OutputThreads, notmuch.OutputFiles:
+	default:
+		return badRequest(c, "Query parameter 'output' must be messages, threads or files")
+	}
+
+	opts, err := queryOptions(c, notmuch.DefaultExcludeTags)
+	if err != nil {
+		return badRequest(c, err.Error())
+	}
+
+	// Reject malformed queries before they reach Xapian
+	if report := validate(q, opts.Syntax); !report.Valid {
+		return errorResponse(c, http.StatusBadRequest, CodeBadQuery, "Invalid search query", report.Errors)
+	}
+
+	count, err := notmuch.Count(c.Request().Context(), q, output, opts)
+	if err != nil {
+		return storeError(c, "Failed to count emails", err)
+	}
+
+	return c.JSON(http.StatusOK, CountResult{
+		Query:       q,
+		Output:      output,
+		ExcludeTags: opts.Exclude,
+		Count:       count,
+	})
+}
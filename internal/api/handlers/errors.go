@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+	nm "github.com/zachatrocity/voyage/notmuch"
+)
+
+// Error codes returned in ErrorResponse.Code
+const (
+	CodeBadRequest          = "bad_request"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeInternal            = "internal_error"
+	CodeReadOnlyDatabase    = "read_only_database"
+	CodeDatabaseUnavailable = "database_unavailable"
+	CodeUpgradeRequired     = "upgrade_required"
+	CodeFileError           = "file_error"
+	CodeFileNotEmail        = "file_not_email"
+	CodeDuplicateMessage    = "duplicate_message_id"
+	CodeTagTooLong          = "tag_too_long"
+	CodeBadQuery            = "bad_query"
+	CodeUnsupported         = "unsupported_operation"
+	CodeStaleRevision       = "stale_revision"
+	CodeMaintenance         = "database_maintenance"
+	CodeRequestTooLarge     = "request_too_large"
+	CodeRateLimited         = "rate_limited"
+	CodeBusy                = "server_busy"
+)
+
+// ErrorResponse is the body returned by every endpoint when a request fails
+// @Description Error response
+type ErrorResponse struct {
+	Code      string      `json:"code" example:"not_found"`
+	Message   string      `json:"message" example:"Email not found"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty" example:"3Fq9x1bT0uLmZ8kV2cRw7yHn4pDs6aGe"`
+}
+
+// StatusClientClosedRequest is logged for requests whose client went away
+// before the response was ready
+const StatusClientClosedRequest = 499
+
+// statusMapping is the HTTP status and error code for a notmuch status
+type statusMapping struct {
+	httpStatus int
+	code       string
+}
+
+// notmuchStatuses maps notmuch statuses to HTTP responses. Statuses not
+// listed here are reported as internal errors.
+var notmuchStatuses = map[nm.Status]statusMapping{
+	nm.STATUS_OUT_OF_MEMORY:         {http.StatusServiceUnavailable, CodeDatabaseUnavailable},
+	nm.STATUS_READ_ONLY_DATABASE:    {http.StatusServiceUnavailable, CodeReadOnlyDatabase},
+	nm.STATUS_XAPIAN_EXCEPTION:      {http.StatusServiceUnavailable, CodeDatabaseUnavailable},
+	nm.STATUS_FILE_ERROR:            {http.StatusInternalServerError, CodeFileError},
+	nm.STATUS_FILE_NOT_EMAIL:        {http.StatusUnprocessableEntity, CodeFileNotEmail},
+	nm.STATUS_DUPLICATE_MESSAGE_ID:  {http.StatusConflict, CodeDuplicateMessage},
+	nm.STATUS_TAG_TOO_LONG:          {http.StatusBadRequest, CodeTagTooLong},
+	nm.STATUS_UNSUPPORTED_OPERATION: {http.StatusNotImplemented, CodeUnsupported},
+	nm.STATUS_UPGRADE_REQUIRED:      {http.StatusServiceUnavailable, CodeUpgradeRequired},
+	nm.STATUS_ILLEGAL_ARGUMENT:      {http.StatusBadRequest, CodeBadRequest},
+	nm.STATUS_NO_CONFIG:             {http.StatusServiceUnavailable, CodeDatabaseUnavailable},
+	nm.STATUS_NO_DATABASE:           {http.StatusServiceUnavailable, CodeDatabaseUnavailable},
+	nm.STATUS_BAD_QUERY_SYNTAX:      {http.StatusBadRequest, CodeBadQuery},
+	nm.STATUS_CLOSED_DATABASE:       {http.StatusServiceUnavailable, CodeDatabaseUnavailable},
+}
+
+// errorResponse writes an ErrorResponse with the given HTTP status
+func errorResponse(c echo.Context, httpStatus int, code string, message string, details interface{}) error {
+	// An ETag set before the request failed describes the response that
+	// was expected, not this one
+	c.Response().Header().Del("ETag")
+	return c.JSON(httpStatus, ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	})
+}
+
+// badRequest writes a 400 ErrorResponse
+func badRequest(c echo.Context, message string) error {
+	return errorResponse(c, http.StatusBadRequest, CodeBadRequest, message, nil)
+}
+
+// notFound writes a 404 ErrorResponse
+func notFound(c echo.Context, message string) error {
+	return errorResponse(c, http.StatusNotFound, CodeNotFound, message, nil)
+}
+
+// storeError writes the ErrorResponse for an error returned by the notmuch
+// store, picking the HTTP status from the underlying notmuch status
+func storeError(c echo.Context, message string, err error) error {
+	if errors.Is(err, context.Canceled) && c.Request().Context().Err() != nil {
+		// Nobody is left to read the response
+		return c.NoContent(StatusClientClosedRequest)
+	}
+	if errors.Is(err, notmuch.ErrNotFound) {
+		return notFound(c, "Email not found")
+	}
+	if errors.Is(err, notmuch.ErrMaintenance) {
+		c.Response().Header().Set("Retry-After", "60")
+		return errorResponse(c, http.StatusServiceUnavailable, CodeMaintenance, message+": "+err.Error(), nil)
+	}
+
+	var nmErr *notmuch.Error
+	if errors.As(err, &nmErr) {
+		details := map[string]interface{}{
+			"operation": nmErr.Op,
+			"status":    nmErr.Status.String(),
+		}
+		m, ok := notmuchStatuses[nmErr.Status]
+		if !ok {
+			m = statusMapping{http.StatusInternalServerError, CodeInternal}
+		}
+		if m.httpStatus >= http.StatusInternalServerError {
+			slog.ErrorContext(c.Request().Context(), message, "error", err)
+		}
+		return errorResponse(c, m.httpStatus, m.code, message, details)
+	}
+
+	slog.ErrorContext(c.Request().Context(), message, "error", err)
+	return errorResponse(c, http.StatusInternalServerError, CodeInternal, message+": "+err.Error(), nil)
+}
+
+// HTTPErrorHandler renders errors raised by Echo itself and the middleware,
+// such as unknown routes, rejected requests or panics caught by the recover
+// middleware, as ErrorResponse
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	httpStatus := http.StatusInternalServerError
+	message := http.StatusText(httpStatus)
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		httpStatus = he.Code
+		if m, ok := he.Message.(string); ok {
+			message = m
+		} else {
+			message = http.StatusText(he.Code)
+		}
+	}
+
+	code := CodeInternal
+	switch httpStatus {
+	case http.StatusBadRequest:
+		code = CodeBadRequest
+	case http.StatusUnauthorized:
+		code = CodeUnauthorized
+	case http.StatusForbidden:
+		code = CodeForbidden
+	case http.StatusNotFound:
+		code = CodeNotFound
+	case http.StatusMethodNotAllowed:
+		code = CodeMethodNotAllowed
+	case http.StatusRequestEntityTooLarge:
+		code = CodeRequestTooLarge
+	case http.StatusTooManyRequests:
+		code = CodeRateLimited
+	case http.StatusServiceUnavailable:
+		code = CodeBusy
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(httpStatus)
+	} else {
+		err = errorResponse(c, httpStatus, code, message, nil)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request().Context(), "Failed to send error response", "error", err)
+	}
+}
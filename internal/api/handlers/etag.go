@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+	"github.com/zachatrocity/voyage/internal/version"
+)
+
+// etag hashes parts into a weak entity tag. Tags are weak because the same
+// response is sent compressed or not. The build version is part of every
+// tag, so an upgrade that changes a response does not leave clients with a
+// stale copy.
+func etag(parts ...string) string {
+	h := sha256.New()
+	h.Write([]byte(version.Get().Version))
+	for _, part := range parts {
+		h.Write([]byte{0})
+		h.Write([]byte(part))
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// revisionETag returns the entity tag of a response computed from the
+// whole database: it changes whenever a message is added, removed or
+// retagged, the excluded tags are reconfigured, or the request asks for
+// something else. parts name anything else the response depends on, such
+// as its format. Call it before searching the database, so a change made
+// meanwhile costs the client a refetch rather than a stale copy.
+func revisionETag(c echo.Context, parts ...string) (string, error) {
+	revision, uuid, err := notmuch.GetRevision()
+	if err != nil {
+		return "", err
+	}
+	parts = append([]string{
+		uuid,
+		strconv.FormatUint(revision, 10),
+		strings.Join(notmuch.DefaultExcludeTags, ","),
+		c.Request().URL.Path,
+		c.QueryParams().Encode(),
+	}, parts...)
+	return etag(parts...), nil
+}
+
+// emailETag returns the entity tag of a single email, which changes with
+// its tags and, when Maildir flags are synced, its file name
+func emailETag(email *notmuch.EmailResult) string {
+	return etag(email.MessageID, strings.Join(email.Tags, ","), email.Filename)
+}
+
+// notModified sets the ETag of the response and reports whether the client
+// already holds it, in which case the caller answers 304
+func notModified(c echo.Context, tag string) bool {
+	header := c.Response().Header()
+	header.Set(echo.HeaderCacheControl, "private, no-cache")
+	header.Set("ETag", tag)
+
+	match := c.Request().Header.Get("If-None-Match")
+	if match == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(match, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// If-None-Match compares weakly
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(tag, "W/") {
+			return true
+		}
+	}
+	return false
+}
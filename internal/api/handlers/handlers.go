@@ -1,17 +1,20 @@
 package handlers
 
 import (
-	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/events"
 	"github.com/zachatrocity/voyage/internal/notmuch"
+	"github.com/zachatrocity/voyage/internal/query"
+	"github.com/zachatrocity/voyage/internal/version"
 )
 
 // HealthCheck godoc
 // @Summary Health check endpoint
-// @Description Get the health status of the API and database connection
+// @Description Get the health status of the API and database connection. Always answers 200; probes should use /livez and /readyz instead.
 // @Tags health
 // @Accept json
 // @Produce json
@@ -27,31 +30,35 @@ func HealthCheck(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"status":    "up",
 		"database":  dbStatus,
-		"version":   "0.1.0",
+		"version":   version.Get().Version,
 		"timestamp": time.Now().Format(time.RFC3339),
 	})
 }
 
 // Search godoc
 // @Summary Search emails
-// @Description Search for emails using notmuch query
+// @Description Search for emails using notmuch query. The response carries an ETag derived from the database revision and the query parameters; send it back in If-None-Match to get 304 while nothing changed. With Accept: application/x-ndjson the results are streamed as they are read, one notmuch.EmailResult per line, without the count, and limit defaults to every matching message. A streamed search failing after its first result ends with a line {"error": ErrorResponse} instead.
 // @Tags search
 // @Accept json
-// @Produce json
+// @Produce json,application/x-ndjson
 // @Param q query string true "Search query"
-// @Param limit query string false "Result limit" default(50)
+// @Param limit query string false "Result limit; -1 for every matching message" default(50)
 // @Param sort query string false "Sort order (oldest_first, newest_first)" default(newest_first)
-// @Success 200 {object} notmuch.SearchResults
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Param exclude query string false "Comma-separated tags to hide unless the query names them, replacing the configured defaults; empty hides nothing"
+// @Param syntax query string false "Query syntax (xapian, sexp)" default(xapian)
+// @Param Accept header string false "application/x-ndjson to stream the results"
+// @Param If-None-Match header string false "ETag of a copy of the results held by the client"
+// @Success 200 {object} notmuch.SearchResults "The results; a stream failing after its first result ends with the line {"error": ErrorResponse}"
+// @Success 304 "The results are unchanged since the ETag was sent"
+// @Failure 400 {object} ErrorResponse "Missing or malformed query; details lists the parse errors"
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /search [get]
 func Search(c echo.Context) error {
 	// Get query parameter
-	query := c.QueryParam("q")
-	if query == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Query parameter 'q' is required",
-		})
+	q := c.QueryParam("q")
+	if q == "" {
+		return badRequest(c, "Query parameter 'q' is required")
 	}
 
 	// Get optional limit parameter
@@ -62,62 +69,109 @@ func Search(c echo.Context) error {
 
 	// Get optional sort parameter
 	sortParam := c.QueryParam("sort")
-	var sortType notmuch.SortType
-	switch sortParam {
-	case "oldest_first":
-		sortType = notmuch.SortOldestFirst
-	default:
-		sortType = notmuch.SortNewestFirst // Default to newest first
+	sortType := parseSort(sortParam)
+
+	opts, err := queryOptions(c, notmuch.DefaultExcludeTags)
+	if err != nil {
+		return badRequest(c, err.Error())
+	}
+
+	// Reject malformed queries before they reach Xapian
+	if report := validate(q, opts.Syntax); !report.Valid {
+		return errorResponse(c, http.StatusBadRequest, CodeBadQuery, "Invalid search query", report.Errors)
 	}
 
-	// Log the sort parameter for debugging
-	log.Printf("Search request with query: %s, sort param: %s, sort type: %d", query, sortParam, sortType)
+	stream := acceptsNDJSON(c)
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	tag, err := revisionETag(c, strconv.FormatBool(stream))
+	if err != nil {
+		return storeError(c, "Failed to read database revision", err)
+	}
+	if notModified(c, tag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	if stream {
+		return streamSearch(c, q, streamLimit(c.QueryParam("limit")), sortType, opts)
+	}
 
 	// Perform search
-	results, err := notmuch.Search(query, limit, sortType)
+	results, err := notmuch.SearchWithOptions(c.Request().Context(), q, limit, sortType, opts)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to search emails: " + err.Error(),
-		})
+		return storeError(c, "Failed to search emails", err)
 	}
 
 	return c.JSON(http.StatusOK, results)
 }
 
+// excludeParam returns the tags listed in the exclude query parameter, or
+// defaults when the parameter is absent
+func excludeParam(c echo.Context, defaults []string) []string {
+	if !c.QueryParams().Has("exclude") {
+		return defaults
+	}
+	return notmuch.ParseTagList(c.QueryParam("exclude"))
+}
+
+// queryOptions reads the syntax and exclude query parameters
+func queryOptions(c echo.Context, defaultExclude []string) (notmuch.QueryOptions, error) {
+	syntax, err := notmuch.ParseSyntax(c.QueryParam("syntax"))
+	if err != nil {
+		return notmuch.QueryOptions{}, err
+	}
+	return notmuch.QueryOptions{
+		Syntax:  syntax,
+		Exclude: excludeParam(c, defaultExclude),
+	}, nil
+}
+
+// validate checks a query string written in the given syntax
+func validate(q string, syntax notmuch.Syntax) query.Report {
+	if syntax == notmuch.SyntaxSexp {
+		return query.ValidateSexp(q)
+	}
+	return query.Validate(q)
+}
+
+// parseSort maps the sort query parameter to a notmuch sort order
+func parseSort(sortParam string) notmuch.SortType {
+	switch sortParam {
+	case "oldest_first":
+		return notmuch.SortOldestFirst
+	default:
+		return notmuch.SortNewestFirst // Default to newest first
+	}
+}
+
 // GetEmail godoc
 // @Summary Get email by ID
-// @Description Retrieve a single email by its message ID
+// @Description Retrieve a single email by its message ID. The response carries an ETag derived from the message ID, tags and file name; send it back in If-None-Match to get 304 while they are unchanged.
 // @Tags email
 // @Accept json
 // @Produce json
 // @Param id path string true "Thread ID"
+// @Param If-None-Match header string false "ETag of a copy of the email held by the client"
 // @Success 200 {object} notmuch.EmailResult
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Success 304 "The email is unchanged since the ETag was sent"
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /email/{id} [get]
 func GetEmail(c echo.Context) error {
 	// Get message ID from URL parameter
 	messageID := c.Param("id")
 	if messageID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Message ID is required",
-		})
+		return badRequest(c, "Message ID is required")
 	}
 
 	// Get email details
 	email, err := notmuch.GetEmail(messageID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to retrieve email: " + err.Error(),
-		})
+		return storeError(c, "Failed to retrieve email", err)
 	}
-
-	// Check if email was found
-	if email == nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "Email not found",
-		})
+	if notModified(c, emailETag(email)) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
 	return c.JSON(http.StatusOK, email)
@@ -125,55 +179,92 @@ func GetEmail(c echo.Context) error {
 
 // TagEmail godoc
 // @Summary Tag an email
-// @Description Add a tag to an email by its message ID
+// @Description Add a tag to an email by its message ID. With VOYAGE_SYNC_MAILDIR_FLAGS set the Maildir flags of the email are updated too.
 // @Tags email
 // @Accept json
 // @Produce json
 // @Param id path string true "Message ID"
 // @Param tag path string true "Tag to add"
 // @Success 200 {object} notmuch.EmailResult
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
 // @Router /email/{id}/tags/{tag} [post]
 func TagEmail(c echo.Context) error {
 	// Get message ID from URL parameter
 	messageID := c.Param("id")
 	if messageID == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Message ID is required",
-		})
+		return badRequest(c, "Message ID is required")
 	}
 
 	// Get message tag from URL parameter
 	tag := c.Param("tag")
 	if tag == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "tag is required",
-		})
+		return badRequest(c, "tag is required")
 	}
 
-	// Get email details
-	email, err := notmuch.GetEmail(messageID)
+	taggedEmail, err := notmuch.TagEmail(c.Request().Context(), messageID, tag)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to retrieve email: " + err.Error(),
-		})
+		return storeError(c, "Failed to tag email", err)
+	}
+
+	// Let subscribers know about the new tag
+	events.Publish(events.Event{
+		Type:      events.TypeEmailTagged,
+		MessageID: taggedEmail.MessageID,
+		Data: map[string]interface{}{
+			"tag":     tag,
+			"subject": taggedEmail.Subject,
+			"tags":    taggedEmail.Tags,
+		},
+	})
+
+	return c.JSON(http.StatusOK, taggedEmail)
+}
+
+// UntagEmail godoc
+// @Summary Untag an email
+// @Description Remove a tag from an email by its message ID, e.g. unread to mark it read. With VOYAGE_SYNC_MAILDIR_FLAGS set the Maildir flags of the email are updated too.
+// @Tags email
+// @Accept json
+// @Produce json
+// @Param id path string true "Message ID"
+// @Param tag path string true "Tag to remove"
+// @Success 200 {object} notmuch.EmailResult
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /email/{id}/tags/{tag} [delete]
+func UntagEmail(c echo.Context) error {
+	// Get message ID from URL parameter
+	messageID := c.Param("id")
+	if messageID == "" {
+		return badRequest(c, "Message ID is required")
 	}
 
-	// Check if email was found
-	if email == nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "Email not found",
-		})
+	// Get message tag from URL parameter
+	tag := c.Param("tag")
+	if tag == "" {
+		return badRequest(c, "tag is required")
 	}
 
-	taggedEmail, err := notmuch.TagEmail(messageID, tag)
+	untaggedEmail, err := notmuch.UntagEmail(c.Request().Context(), messageID, tag)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to tag email: " + err.Error(),
-		})
+		return storeError(c, "Failed to untag email", err)
 	}
 
-	return c.JSON(http.StatusOK, taggedEmail)
+	// Let subscribers know about the removed tag
+	events.Publish(events.Event{
+		Type:      events.TypeEmailUntagged,
+		MessageID: untaggedEmail.MessageID,
+		Data: map[string]interface{}{
+			"tag":     tag,
+			"subject": untaggedEmail.Subject,
+			"tags":    untaggedEmail.Tags,
+		},
+	})
+
+	return c.JSON(http.StatusOK, untaggedEmail)
 }
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/mailsync"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+	"github.com/zachatrocity/voyage/internal/version"
+)
+
+// Syncer indexes new mail on a schedule; nil when sync.interval is 0
+var Syncer *mailsync.Scheduler
+
+// startedAt is when the process started serving
+var startedAt = time.Now().UTC()
+
+// checkOK is the result of a passing check
+const checkOK = "ok"
+
+// readyTTL is how long a readiness result is reused, so frequent probes do
+// not open the database every time
+const readyTTL = 5 * time.Second
+
+// ReadinessResponse is the response of the readiness probe
+// @Description Readiness and the checks behind it
+type ReadinessResponse struct {
+	// Status is ready or not_ready
+	Status string `json:"status" example:"ready"`
+	// Checks maps every check to ok or the reason it failed
+	Checks map[string]string `json:"checks"`
+}
+
+// readiness caches the last readiness result
+var readiness struct {
+	sync.Mutex
+	checked time.Time
+	result  ReadinessResponse
+}
+
+// Liveness godoc
+// @Summary Liveness probe
+// @Description Report that the process is serving requests, without touching the database
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /livez [get]
+func Liveness(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "up"})
+}
+
+// Readiness godoc
+// @Summary Readiness probe
+// @Description Report whether the database can be opened and written to. Writability is judged without taking the writer lock, so probes never block notmuch new. Results are reused for 5 seconds.
+// @Tags health
+// @Produce json
+// @Success 200 {object} ReadinessResponse
+// @Failure 503 {object} ReadinessResponse
+// @Router /readyz [get]
+func Readiness(c echo.Context) error {
+	readiness.Lock()
+	defer readiness.Unlock()
+
+	if time.Since(readiness.checked) >= readyTTL {
+		readiness.result = ReadinessResponse{
+			Status: "ready",
+			Checks: map[string]string{
+				"database": checkResult(notmuch.CheckDatabaseConnection()),
+				"writer":   checkResult(notmuch.CheckWriter()),
+			},
+		}
+		for _, result := range readiness.result.Checks {
+			if result != checkOK {
+				readiness.result.Status = "not_ready"
+			}
+		}
+		readiness.checked = time.Now()
+	}
+
+	if readiness.result.Status != "ready" {
+		return c.JSON(http.StatusServiceUnavailable, readiness.result)
+	}
+	return c.JSON(http.StatusOK, readiness.result)
+}
+
+// checkResult is ok, or the error of a failed check
+func checkResult(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return checkOK
+}
+
+// HealthDetails is the response of the health details endpoint
+// @Description Build, database, sync and disk diagnostics
+type HealthDetails struct {
+	// Status is ok, or degraded when a check failed
+	Status    string       `json:"status" example:"ok"`
+	Build     version.Info `json:"build"`
+	StartedAt time.Time    `json:"started_at" example:"2023-01-01T12:00:00Z"`
+	// Checks maps every check to ok or the reason it failed
+	Checks   map[string]string     `json:"checks"`
+	Database *notmuch.DatabaseInfo `json:"database,omitempty"`
+	Sync     SyncStatus            `json:"sync"`
+	Backlog  Backlog               `json:"backlog"`
+	Disk     *notmuch.DiskUsage    `json:"disk,omitempty"`
+}
+
+// SyncStatus describes the scheduled mail sync
+// @Description Scheduled mail sync
+type SyncStatus struct {
+	// Scheduled reports whether the server syncs new mail itself
+	Scheduled bool `json:"scheduled" example:"true"`
+	// LastRun is when the last sync started
+	LastRun *time.Time       `json:"last_run,omitempty" example:"2023-01-01T12:00:00Z"`
+	Result  *mailsync.Result `json:"result,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// Backlog counts the messages awaiting processing
+// @Description Messages awaiting processing
+type Backlog struct {
+	// Extract counts the new emails a running sync has yet to extract
+	Extract int `json:"extract" example:"0"`
+	// Reindex counts the messages the running reindex job has yet to process
+	Reindex int `json:"reindex" example:"80"`
+}
+
+// GetHealthDetails godoc
+// @Summary Get health diagnostics
+// @Description Report the build, the database path, version, revision and whether it needs an upgrade, the last scheduled sync, the processing backlog and the free disk space. Failed checks are reported in the body with status degraded.
+// @Tags admin
+// @Produce json
+// @Param check_upgrade query bool false "Briefly take the writer lock to report whether an upgrade is needed" default(true)
+// @Success 200 {object} HealthDetails
+// @Failure 403 {object} ErrorResponse "No API keys are configured"
+// @Router /admin/health/details [get]
+func GetHealthDetails(c echo.Context) error {
+	checkUpgrade := true
+	if value := c.QueryParam("check_upgrade"); value != "" {
+		checkUpgrade, _ = strconv.ParseBool(value)
+	}
+
+	details := HealthDetails{
+		Status:    "ok",
+		Build:     version.Get(),
+		StartedAt: startedAt,
+		Checks:    map[string]string{},
+		Backlog: Backlog{
+			Extract: mailsync.Pending(),
+			Reindex: Reindexer.Pending(),
+		},
+	}
+
+	info, err := notmuch.GetDatabaseInfo(checkUpgrade)
+	details.Checks["database"] = checkResult(err)
+	details.Database = info
+	details.Checks["writer"] = checkResult(notmuch.CheckWriter())
+
+	disk, err := notmuch.GetDiskUsage()
+	details.Checks["disk"] = checkResult(err)
+	details.Disk = disk
+
+	if Syncer != nil {
+		details.Sync.Scheduled = true
+		lastRun, result, err := Syncer.Last()
+		if !lastRun.IsZero() {
+			details.Sync.LastRun = &lastRun
+			details.Sync.Result = result
+		}
+		if err != nil {
+			details.Sync.Error = err.Error()
+		}
+	}
+
+	for _, result := range details.Checks {
+		if result != checkOK {
+			details.Status = "degraded"
+		}
+	}
+
+	return c.JSON(http.StatusOK, details)
+}
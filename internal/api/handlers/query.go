@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+	"github.com/zachatrocity/voyage/internal/query"
+)
+
+// SearchRequest is the body accepted by the structured search endpoint
+// @Description Structured search request
+type SearchRequest struct {
+	Query query.Node `json:"query"`
+	Limit int        `json:"limit" example:"50"`
+	Sort  string     `json:"sort" example:"newest_first"`
+	// Exclude replaces the configured tags hidden from the results; an
+	// empty list hides nothing
+	Exclude []string `json:"exclude,omitempty" example:"deleted,spam"`
+}
+
+// StructuredSearch godoc
+// @Summary Search emails with a structured query
+// @Description Search for emails using a JSON query tree that the server compiles into notmuch syntax with correct quoting
+// @Tags search
+// @Accept json
+// @Produce json
+// @Param request body SearchRequest true "Structured query"
+// @Success 200 {object} notmuch.SearchResults
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /search [post]
+func StructuredSearch(c echo.Context) error {
+	var req SearchRequest
+	if err := c.Bind(&req); err != nil {
+		return badRequest(c, "Invalid request body")
+	}
+
+	q, err := query.Compile(req.Query)
+	if err != nil {
+		code := CodeBadQuery
+		if errors.Is(err, query.ErrEmptyQuery) {
+			code = CodeBadRequest
+		}
+		return errorResponse(c, http.StatusBadRequest, code, "Invalid structured query: "+err.Error(), nil)
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	opts := notmuch.DefaultQueryOptions()
+	if req.Exclude != nil {
+		opts.Exclude = req.Exclude
+	}
+
+	results, err := notmuch.SearchWithOptions(c.Request().Context(), q, strconv.Itoa(limit), parseSort(req.Sort), opts)
+	if err != nil {
+		return storeError(c, "Failed to search emails", err)
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+// ValidateQuery godoc
+// @Summary Validate a search query
+// @Description Check a notmuch query string for syntax errors without running it. Error positions are zero-based byte offsets into the query.
+// @Tags search
+// @Accept json
+// @Produce json
+// @Param q query string true "Search query"
+// @Param syntax query string false "Query syntax (xapian, sexp); sexp queries are only checked for balanced parentheses and quotes" default(xapian)
+// @Success 200 {object} query.Report
+// @Failure 400 {object} ErrorResponse
+// @Router /search/validate [get]
+func ValidateQuery(c echo.Context) error {
+	q := c.QueryParam("q")
+	if q == "" {
+		return badRequest(c, "Query parameter 'q' is required")
+	}
+
+	syntax, err := notmuch.ParseSyntax(c.QueryParam("syntax"))
+	if err != nil {
+		return badRequest(c, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, validate(q, syntax))
+}
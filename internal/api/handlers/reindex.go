@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+	"github.com/zachatrocity/voyage/internal/reindex"
+)
+
+// Reindexer runs the reindex jobs started through the reindex endpoints
+var Reindexer *reindex.Manager
+
+// StartReindex godoc
+// @Summary Start a reindex job
+// @Description Index the messages matching a query again and re-run reservation extraction on them in the background, e.g. after a parser improvement. Excluded messages are included. Poll the returned job for progress.
+// @Tags reindex
+// @Accept json
+// @Produce json
+// @Param q query string true "Search query"
+// @Param syntax query string false "Query syntax (xapian, sexp)" default(xapian)
+// @Param decrypt query string false "Policy for encrypted parts (false, true, auto, nostash); defaults to the database setting"
+// @Success 202 {object} reindex.Job
+// @Failure 400 {object} ErrorResponse "Missing or malformed query, or unknown decrypt policy"
+// @Failure 409 {object} ErrorResponse "Another reindex job is running"
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /reindex [post]
+func StartReindex(c echo.Context) error {
+	q := c.QueryParam("q")
+	if q == "" {
+		return badRequest(c, "Query parameter 'q' is required")
+	}
+
+	syntax, err := notmuch.ParseSyntax(c.QueryParam("syntax"))
+	if err != nil {
+		return badRequest(c, err.Error())
+	}
+	opts := notmuch.ReindexOptions{Decrypt: c.QueryParam("decrypt")}
+	if err := opts.Validate(); err != nil {
+		return badRequest(c, err.Error())
+	}
+
+	// Reject malformed queries before they reach Xapian
+	if report := validate(q, syntax); !report.Valid {
+		return errorResponse(c, http.StatusBadRequest, CodeBadQuery, "Invalid search query", report.Errors)
+	}
+
+	job, err := Reindexer.Start(c.Request().Context(), q, syntax, opts)
+	if errors.Is(err, reindex.ErrBusy) {
+		return errorResponse(c, http.StatusConflict, CodeConflict, err.Error(), nil)
+	}
+	if err != nil {
+		return storeError(c, "Failed to start reindex", err)
+	}
+
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// ListReindexJobs godoc
+// @Summary List reindex jobs
+// @Description List the running and recently finished reindex jobs, newest first
+// @Tags reindex
+// @Accept json
+// @Produce json
+// @Success 200 {array} reindex.Job
+// @Router /reindex [get]
+func ListReindexJobs(c echo.Context) error {
+	return c.JSON(http.StatusOK, Reindexer.List())
+}
+
+// GetReindexJob godoc
+// @Summary Get a reindex job
+// @Description Retrieve the progress of a reindex job
+// @Tags reindex
+// @Accept json
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 200 {object} reindex.Job
+// @Failure 404 {object} ErrorResponse
+// @Router /reindex/{id} [get]
+func GetReindexJob(c echo.Context) error {
+	job, err := Reindexer.Get(c.Param("id"))
+	if err != nil {
+		return notFound(c, "Reindex job not found")
+	}
+
+	return c.JSON(http.StatusOK, job)
+}
+
+// CancelReindexJob godoc
+// @Summary Cancel a reindex job
+// @Description Stop a running reindex job after the message it is processing. Messages already processed keep their new index.
+// @Tags reindex
+// @Accept json
+// @Produce json
+// @Param id path string true "Job ID"
+// @Success 202 {object} reindex.Job
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse "The job already finished"
+// @Router /reindex/{id}/cancel [post]
+func CancelReindexJob(c echo.Context) error {
+	job, err := Reindexer.Cancel(c.Param("id"))
+	if errors.Is(err, reindex.ErrNotFound) {
+		return notFound(c, "Reindex job not found")
+	}
+	if errors.Is(err, reindex.ErrFinished) {
+		return errorResponse(c, http.StatusConflict, CodeConflict, err.Error(), nil)
+	}
+
+	return c.JSON(http.StatusAccepted, job)
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/reminders"
+)
+
+// Reminders is the scheduler backing the reminder endpoints
+var Reminders *reminders.Scheduler
+
+// ListReminders godoc
+// @Summary List reminders
+// @Description List the check-in, departure and check-out reminders computed from extracted reservations, soonest first
+// @Tags reminders
+// @Accept json
+// @Produce json
+// @Param status query string false "Only return reminders with this status (pending, fired, cancelled, missed)"
+// @Success 200 {array} reminders.Reminder
+// @Router /reminders [get]
+func ListReminders(c echo.Context) error {
+	status := c.QueryParam("status")
+
+	list := []reminders.Reminder{}
+	for _, r := range Reminders.Upcoming() {
+		if status == "" || r.Status == status {
+			list = append(list, r)
+		}
+	}
+
+	return c.JSON(http.StatusOK, list)
+}
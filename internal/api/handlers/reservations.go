@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/extract"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+)
+
+// GetEmailReservations godoc
+// @Summary Get reservations of an email
+// @Description Retrieve the reservations extracted from an email. They are read from the voyage.* message properties, extracting and storing them first when the email has not been extracted yet.
+// @Tags email
+// @Accept json
+// @Produce json
+// @Param id path string true "Message ID"
+// @Param refresh query bool false "Extract the email again, replacing the stored reservations"
+// @Success 200 {array} extract.Reservation
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /email/{id}/reservations [get]
+func GetEmailReservations(c echo.Context) error {
+	messageID := c.Param("id")
+	if messageID == "" {
+		return badRequest(c, "Message ID is required")
+	}
+
+	email, err := notmuch.GetEmail(messageID)
+	if err != nil {
+		return storeError(c, "Failed to retrieve email", err)
+	}
+
+	var reservations []extract.Reservation
+	if c.QueryParam("refresh") == "true" {
+		reservations, err = extract.FromFile(email.MessageID, email.Filename)
+		if err == nil {
+			if err := extract.Store(email.MessageID, reservations); err != nil {
+				return storeError(c, "Failed to store reservations", err)
+			}
+		}
+	} else {
+		reservations, err = extract.Extract(c.Request().Context(), email.MessageID, email.Filename)
+	}
+	if err != nil {
+		return errorResponse(c, http.StatusUnprocessableEntity, CodeFileNotEmail, "Failed to extract reservations: "+err.Error(), nil)
+	}
+	if reservations == nil {
+		reservations = []extract.Reservation{}
+	}
+
+	return c.JSON(http.StatusOK, reservations)
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+	"github.com/zachatrocity/voyage/internal/saved"
+)
+
+// SavedSearches is the store backing the saved search endpoints
+var SavedSearches *saved.Store
+
+// SavedSearchRequest is the body accepted when creating or updating a saved search
+// @Description Saved search to create or update
+type SavedSearchRequest struct {
+	Name   string `json:"name" example:"unfiled-airline-confirmations"`
+	Query  string `json:"query" example:"tag:travel and subject:confirmation and not tag:trip"`
+	Sort   string `json:"sort" example:"newest_first"`
+	Syntax string `json:"syntax" example:"xapian"`
+	Pinned bool   `json:"pinned" example:"true"`
+}
+
+// SavedSearchResult is a saved search together with its message counts
+// @Description Saved search with counts
+type SavedSearchResult struct {
+	saved.Search
+	Count  int `json:"count" example:"12"`
+	Unread int `json:"unread" example:"3"`
+}
+
+// ListSavedSearches godoc
+// @Summary List saved searches
+// @Description List saved searches, pinned first, each with its total and unread message counts
+// @Tags saved
+// @Accept json
+// @Produce json
+// @Success 200 {array} SavedSearchResult
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /saved [get]
+func ListSavedSearches(c echo.Context) error {
+	results, err := withCounts(c.Request().Context(), SavedSearches.List())
+	if err != nil {
+		return storeError(c, "Failed to count saved searches", err)
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+// CreateSavedSearch godoc
+// @Summary Create a saved search
+// @Description Save a named notmuch query
+// @Tags saved
+// @Accept json
+// @Produce json
+// @Param search body SavedSearchRequest true "Saved search"
+// @Success 201 {object} saved.Search
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /saved [post]
+func CreateSavedSearch(c echo.Context) error {
+	var req SavedSearchRequest
+	if err := c.Bind(&req); err != nil {
+		return badRequest(c, "Invalid request body")
+	}
+
+	search, err := SavedSearches.Create(saved.Search{
+		Name:   req.Name,
+		Query:  req.Query,
+		Sort:   req.Sort,
+		Syntax: req.Syntax,
+		Pinned: req.Pinned,
+	})
+	if err != nil {
+		return savedSearchError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, search)
+}
+
+// GetSavedSearch godoc
+// @Summary Get a saved search
+// @Description Retrieve a saved search with its total and unread message counts
+// @Tags saved
+// @Accept json
+// @Produce json
+// @Param name path string true "Saved search name"
+// @Success 200 {object} SavedSearchResult
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /saved/{name} [get]
+func GetSavedSearch(c echo.Context) error {
+	search, err := SavedSearches.Get(c.Param("name"))
+	if err != nil {
+		return savedSearchError(c, err)
+	}
+
+	results, err := withCounts(c.Request().Context(), []saved.Search{*search})
+	if err != nil {
+		return storeError(c, "Failed to count saved search", err)
+	}
+
+	return c.JSON(http.StatusOK, results[0])
+}
+
+// UpdateSavedSearch godoc
+// @Summary Update a saved search
+// @Description Replace the query, sort order and pinned flag of a saved search, or rename it
+// @Tags saved
+// @Accept json
+// @Produce json
+// @Param name path string true "Saved search name"
+// @Param search body SavedSearchRequest true "Saved search"
+// @Success 200 {object} saved.Search
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /saved/{name} [put]
+func UpdateSavedSearch(c echo.Context) error {
+	var req SavedSearchRequest
+	if err := c.Bind(&req); err != nil {
+		return badRequest(c, "Invalid request body")
+	}
+	if req.Name == "" {
+		req.Name = c.Param("name")
+	}
+
+	search, err := SavedSearches.Update(c.Param("name"), saved.Search{
+		Name:   req.Name,
+		Query:  req.Query,
+		Sort:   req.Sort,
+		Syntax: req.Syntax,
+		Pinned: req.Pinned,
+	})
+	if err != nil {
+		return savedSearchError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, search)
+}
+
+// DeleteSavedSearch godoc
+// @Summary Delete a saved search
+// @Description Remove a saved search
+// @Tags saved
+// @Accept json
+// @Produce json
+// @Param name path string true "Saved search name"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /saved/{name} [delete]
+func DeleteSavedSearch(c echo.Context) error {
+	if err := SavedSearches.Delete(c.Param("name")); err != nil {
+		return savedSearchError(c, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetSavedSearchResults godoc
+// @Summary Run a saved search
+// @Description Execute a saved search and return the matching emails
+// @Tags saved
+// @Accept json
+// @Produce json
+// @Param name path string true "Saved search name"
+// @Param limit query string false "Result limit" default(50)
+// @Success 200 {object} notmuch.SearchResults
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /saved/{name}/results [get]
+func GetSavedSearchResults(c echo.Context) error {
+	search, err := SavedSearches.Get(c.Param("name"))
+	if err != nil {
+		return savedSearchError(c, err)
+	}
+
+	limit := c.QueryParam("limit")
+	if limit == "" {
+		limit = "50"
+	}
+
+	results, err := notmuch.SearchWithOptions(c.Request().Context(), search.Query, limit, parseSort(search.Sort), savedQueryOptions(*search))
+	if err != nil {
+		return storeError(c, "Failed to search emails", err)
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+// withCounts adds the total and unread message counts to saved searches,
+// counting them all in a single open of the database
+func withCounts(ctx context.Context, searches []saved.Search) ([]SavedSearchResult, error) {
+	requests := make([]notmuch.CountRequest, 0, 2*len(searches))
+	for _, search := range searches {
+		opts := savedQueryOptions(search)
+		unreadQuery := "(" + search.Query + ") and tag:unread"
+		if opts.Syntax == notmuch.SyntaxSexp {
+			unreadQuery = "(and " + search.Query + " (tag unread))"
+		}
+		requests = append(requests,
+			notmuch.CountRequest{Query: search.Query, Options: opts},
+			notmuch.CountRequest{Query: unreadQuery, Options: opts},
+		)
+	}
+
+	counts, err := notmuch.CountAll(ctx, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]SavedSearchResult, len(searches))
+	for i, search := range searches {
+		results[i] = SavedSearchResult{Search: search, Count: counts[2*i], Unread: counts[2*i+1]}
+	}
+	return results, nil
+}
+
+// savedQueryOptions returns the options a saved search is run with
+func savedQueryOptions(search saved.Search) notmuch.QueryOptions {
+	opts := notmuch.DefaultQueryOptions()
+	opts.Syntax, _ = notmuch.ParseSyntax(search.Syntax)
+	return opts
+}
+
+// savedSearchError writes the ErrorResponse for a saved search store error
+func savedSearchError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, saved.ErrNotFound):
+		return notFound(c, "Saved search not found")
+	case errors.Is(err, saved.ErrExists):
+		return errorResponse(c, http.StatusConflict, CodeConflict, "Saved search already exists", nil)
+	case errors.Is(err, saved.ErrInvalid):
+		return badRequest(c, err.Error())
+	default:
+		return errorResponse(c, http.StatusInternalServerError, CodeInternal, "Failed to save search: "+err.Error(), nil)
+	}
+}
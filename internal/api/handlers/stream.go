@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+)
+
+// MIMEApplicationNDJSON is newline-delimited JSON, one value per line
+const MIMEApplicationNDJSON = "application/x-ndjson"
+
+// streamFlushInterval is how often a streamed search sends the results
+// read so far
+const streamFlushInterval = 500 * time.Millisecond
+
+// StreamError is the last line of a streamed search that failed after its
+// first result, when the status can no longer tell
+type StreamError struct {
+	Error ErrorResponse `json:"error"`
+}
+
+// acceptsNDJSON reports whether the client asked for newline-delimited JSON
+func acceptsNDJSON(c echo.Context) bool {
+	for _, accepted := range strings.Split(c.Request().Header.Get(echo.HeaderAccept), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == MIMEApplicationNDJSON {
+			return true
+		}
+	}
+	return false
+}
+
+// streamLimit parses the limit of a streamed search, which defaults to
+// every matching message
+func streamLimit(value string) int {
+	if value == "" {
+		return -1
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil {
+		return 50 // Default limit, as for other searches
+	}
+	return limit
+}
+
+// streamSearch writes the results of a search as NDJSON while they are read
+// from the database, sending the first result at once and then whatever was
+// read every streamFlushInterval. A search failing after the first result
+// ends the stream with a StreamError line. A client that goes away stops
+// the search.
+func streamSearch(c echo.Context, q string, limit int, sortType notmuch.SortType, opts notmuch.QueryOptions) error {
+	ctx := c.Request().Context()
+	res := c.Response()
+	enc := json.NewEncoder(res)
+
+	start := func() {
+		res.Header().Set(echo.HeaderContentType, MIMEApplicationNDJSON)
+		res.WriteHeader(http.StatusOK)
+	}
+
+	streamed := 0
+	var flushed time.Time
+	err := notmuch.StreamSearch(ctx, q, limit, sortType, opts, func(email notmuch.EmailResult) error {
+		if !res.Committed {
+			start()
+		}
+		if err := enc.Encode(email); err != nil {
+			return err
+		}
+		streamed++
+
+		if streamed == 1 || time.Since(flushed) >= streamFlushInterval {
+			res.Flush()
+			flushed = time.Now()
+		}
+		return nil
+	})
+
+	switch {
+	case err != nil && !res.Committed:
+		return storeError(c, "Failed to search emails", err)
+	case err != nil && ctx.Err() == nil:
+		// The status is sent, so the last line tells the client the
+		// results are incomplete
+		slog.ErrorContext(ctx, "Failed to stream search results", "error", err, "streamed", streamed)
+		code := CodeInternal
+		var nmErr *notmuch.Error
+		if errors.As(err, &nmErr) {
+			if m, ok := notmuchStatuses[nmErr.Status]; ok {
+				code = m.code
+			}
+		}
+		enc.Encode(StreamError{Error: ErrorResponse{
+			Code:      code,
+			Message:   "Failed to stream search results",
+			RequestID: res.Header().Get(echo.HeaderXRequestID),
+		}})
+		res.Flush()
+	case err != nil:
+		// The client went away and needs neither a last line nor a log line
+	case !res.Committed:
+		// Nothing matched
+		start()
+	}
+	return nil
+}
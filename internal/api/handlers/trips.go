@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/trips"
+)
+
+// CreateTripRequest is the body accepted when creating a trip
+// @Description Trip to create
+type CreateTripRequest struct {
+	Name  string `json:"name" example:"lisbon-2024"`
+	Query string `json:"query" example:"tag:travel and date:2024-04-01..2024-05-08 and (Lisbon or TAP)"`
+}
+
+// MergeTripRequest is the body accepted when merging trips
+// @Description Trip to merge into another
+type MergeTripRequest struct {
+	From string `json:"from" example:"porto-2024"`
+}
+
+// ListTrips godoc
+// @Summary List trips
+// @Description List every trip with the number of emails filed under it. Supports If-None-Match like search.
+// @Tags trips
+// @Accept json
+// @Produce json
+// @Param If-None-Match header string false "ETag of a copy of the list held by the client"
+// @Success 200 {array} trips.Trip
+// @Success 304 "The trips are unchanged since the ETag was sent"
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /trips [get]
+func ListTrips(c echo.Context) error {
+	tag, err := revisionETag(c)
+	if err != nil {
+		return storeError(c, "Failed to read database revision", err)
+	}
+	if notModified(c, tag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	list, err := trips.List()
+	if err != nil {
+		return storeError(c, "Failed to list trips", err)
+	}
+
+	return c.JSON(http.StatusOK, list)
+}
+
+// CreateTrip godoc
+// @Summary Create a trip
+// @Description File every email matching a query under a new trip tag. Either all matching emails are tagged or none.
+// @Tags trips
+// @Accept json
+// @Produce json
+// @Param trip body CreateTripRequest true "Trip"
+// @Success 201 {object} trips.Trip
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /trips [post]
+func CreateTrip(c echo.Context) error {
+	var req CreateTripRequest
+	if err := c.Bind(&req); err != nil {
+		return badRequest(c, "Invalid request body")
+	}
+
+	trip, err := trips.Create(req.Name, req.Query)
+	if err != nil {
+		return tripError(c, "Failed to create trip", err)
+	}
+
+	return c.JSON(http.StatusCreated, trip)
+}
+
+// GetTrip godoc
+// @Summary Get a trip
+// @Description Retrieve a trip with its emails and the reservations extracted from them. Supports If-None-Match like search.
+// @Tags trips
+// @Accept json
+// @Produce json
+// @Param name path string true "Trip name"
+// @Param If-None-Match header string false "ETag of a copy of the trip held by the client"
+// @Success 200 {object} trips.Trip
+// @Success 304 "The trip is unchanged since the ETag was sent"
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /trips/{name} [get]
+func GetTrip(c echo.Context) error {
+	tag, err := revisionETag(c)
+	if err != nil {
+		return storeError(c, "Failed to read database revision", err)
+	}
+	if notModified(c, tag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	trip, err := trips.Get(c.Request().Context(), c.Param("name"))
+	if err != nil {
+		return tripError(c, "Failed to retrieve trip", err)
+	}
+
+	return c.JSON(http.StatusOK, trip)
+}
+
+// MergeTrip godoc
+// @Summary Merge trips
+// @Description Move every email of another trip into this one. Either all emails move or none.
+// @Tags trips
+// @Accept json
+// @Produce json
+// @Param name path string true "Trip to merge into"
+// @Param merge body MergeTripRequest true "Trip to merge from"
+// @Success 200 {object} trips.Trip
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 503 {object} ErrorResponse
+// @Router /trips/{name}/merge [post]
+func MergeTrip(c echo.Context) error {
+	var req MergeTripRequest
+	if err := c.Bind(&req); err != nil {
+		return badRequest(c, "Invalid request body")
+	}
+	if req.From == "" {
+		return badRequest(c, "from is required")
+	}
+
+	trip, err := trips.Merge(c.Param("name"), req.From)
+	if err != nil {
+		return tripError(c, "Failed to merge trips", err)
+	}
+
+	return c.JSON(http.StatusOK, trip)
+}
+
+// tripError writes the ErrorResponse for an error returned by the trips package
+func tripError(c echo.Context, message string, err error) error {
+	switch {
+	case errors.Is(err, trips.ErrNotFound):
+		return notFound(c, "Trip not found")
+	case errors.Is(err, trips.ErrExists):
+		return errorResponse(c, http.StatusConflict, CodeConflict, "Trip already exists", nil)
+	case errors.Is(err, trips.ErrInvalid):
+		return badRequest(c, err.Error())
+	default:
+		return storeError(c, message, err)
+	}
+}
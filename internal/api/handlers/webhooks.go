@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/webhooks"
+)
+
+// Webhooks is the webhook service backing the webhook endpoints
+var Webhooks *webhooks.Service
+
+// CreateWebhookRequest is the body accepted when creating a webhook
+// @Description Webhook subscription to create
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" example:"https://chat.example.com/hooks/voyage"`
+	Secret string   `json:"secret" example:"s3cr3t"`
+	Events []string `json:"events" example:"email.tagged"`
+	Query  string   `json:"query" example:"tag:flight"`
+}
+
+// ListWebhooks godoc
+// @Summary List webhooks
+// @Description List all webhook subscriptions
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Success 200 {array} webhooks.Webhook
+// @Router /webhooks [get]
+func ListWebhooks(c echo.Context) error {
+	list := Webhooks.List()
+	for i := range list {
+		list[i].Secret = ""
+	}
+
+	return c.JSON(http.StatusOK, list)
+}
+
+// CreateWebhook godoc
+// @Summary Create a webhook
+// @Description Subscribe a URL to travel events, optionally filtered by event type and notmuch query
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param webhook body CreateWebhookRequest true "Webhook subscription"
+// @Success 201 {object} webhooks.Webhook
+// @Failure 400 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /webhooks [post]
+func CreateWebhook(c echo.Context) error {
+	var req CreateWebhookRequest
+	if err := c.Bind(&req); err != nil {
+		return badRequest(c, "Invalid request body")
+	}
+	if req.URL == "" {
+		return badRequest(c, "url is required")
+	}
+
+	webhook, err := Webhooks.Create(webhooks.Webhook{
+		URL:    req.URL,
+		Secret: req.Secret,
+		Events: req.Events,
+		Query:  req.Query,
+	})
+	if err != nil {
+		return badRequest(c, "Failed to create webhook: "+err.Error())
+	}
+
+	webhook.Secret = ""
+	return c.JSON(http.StatusCreated, webhook)
+}
+
+// GetWebhook godoc
+// @Summary Get a webhook
+// @Description Retrieve a webhook subscription by its ID
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {object} webhooks.Webhook
+// @Failure 404 {object} ErrorResponse
+// @Router /webhooks/{id} [get]
+func GetWebhook(c echo.Context) error {
+	webhook, err := Webhooks.Get(c.Param("id"))
+	if err != nil {
+		return notFound(c, "Webhook not found")
+	}
+
+	webhook.Secret = ""
+	return c.JSON(http.StatusOK, webhook)
+}
+
+// DeleteWebhook godoc
+// @Summary Delete a webhook
+// @Description Remove a webhook subscription and its delivery log
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 204
+// @Failure 404 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /webhooks/{id} [delete]
+func DeleteWebhook(c echo.Context) error {
+	err := Webhooks.Delete(c.Param("id"))
+	if errors.Is(err, webhooks.ErrNotFound) {
+		return notFound(c, "Webhook not found")
+	}
+	if err != nil {
+		return errorResponse(c, http.StatusInternalServerError, CodeInternal, "Failed to delete webhook: "+err.Error(), nil)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetWebhookDeliveries godoc
+// @Summary List webhook deliveries
+// @Description Retrieve the delivery log of a webhook, newest first
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Webhook ID"
+// @Success 200 {array} webhooks.Delivery
+// @Failure 404 {object} ErrorResponse
+// @Router /webhooks/{id}/deliveries [get]
+func GetWebhookDeliveries(c echo.Context) error {
+	deliveries, err := Webhooks.Deliveries(c.Param("id"))
+	if err != nil {
+		return notFound(c, "Webhook not found")
+	}
+
+	return c.JSON(http.StatusOK, deliveries)
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/zachatrocity/voyage/internal/api/handlers"
+	"github.com/zachatrocity/voyage/internal/config"
+	"golang.org/x/time/rate"
+)
+
+// routeClass groups the routes sharing a rate limit
+type routeClass int
+
+const (
+	classNone routeClass = iota
+	classSearch
+	classWrite
+	classImport
+)
+
+// searchRoutes are the routes running database searches, by method and
+// route pattern
+var searchRoutes = map[string]bool{
+	"GET /api/v1/search":              true,
+	"POST /api/v1/search":             true,
+	"GET /api/v1/count":               true,
+	"GET /api/v1/changes":             true,
+	"GET /api/v1/saved":               true,
+	"GET /api/v1/saved/:name":         true,
+	"GET /api/v1/saved/:name/results": true,
+	"GET /api/v1/trips":               true,
+	"GET /api/v1/trips/:name":         true,
+}
+
+// importPrefixes are the route prefixes of the import and upload routes,
+// which accept large bodies
+var importPrefixes = []string{"/api/v1/import", "/api/v1/upload"}
+
+// classify returns the class of the route the request matched
+func classify(c echo.Context) routeClass {
+	route := c.Path()
+	for _, prefix := range importPrefixes {
+		if strings.HasPrefix(route, prefix) {
+			return classImport
+		}
+	}
+
+	method := c.Request().Method
+	if searchRoutes[method+" "+route] {
+		return classSearch
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return classNone
+	}
+	return classWrite
+}
+
+// apiKeyIndexKey is the context key under which apiKeyAuth stores the
+// position of the accepted key
+const apiKeyIndexKey = "api_key_index"
+
+// clientID identifies the client a request is counted against: its API key
+// when the API requires one, and its IP otherwise
+func clientID(c echo.Context) string {
+	if i, ok := c.Get(apiKeyIndexKey).(int); ok {
+		return "key:" + strconv.Itoa(i)
+	}
+	return "ip:" + c.RealIP()
+}
+
+// ipExtractor tells the IP of a client from the connection, or from
+// X-Forwarded-For when the request came through one of the trusted proxies.
+// The proxies must be valid.
+func ipExtractor(proxies []string) echo.IPExtractor {
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	// Only the configured proxies are trusted, not every private network
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, proxy := range proxies {
+		network, _ := config.ParseProxy(proxy)
+		options = append(options, echo.TrustIPRange(network))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// sweepInterval is how often idle clients are forgotten
+const sweepInterval = time.Minute
+
+// limiter keeps a token bucket per client
+type limiter struct {
+	limit rate.Limit
+	burst int
+	// idle is how long a client takes to refill its bucket, after which
+	// it is no different from a new one
+	idle time.Duration
+
+	mu        sync.Mutex
+	clients   map[string]*bucket
+	lastSweep time.Time
+}
+
+// bucket is the token bucket of a client
+type bucket struct {
+	*rate.Limiter
+	seen time.Time
+}
+
+// newLimiter returns the limiter for cfg, or nil when the limit is disabled
+func newLimiter(cfg config.RateLimit) *limiter {
+	if cfg.Rate <= 0 {
+		return nil
+	}
+	return &limiter{
+		limit:   rate.Limit(cfg.Rate),
+		burst:   cfg.Burst,
+		idle:    time.Duration(float64(cfg.Burst) / cfg.Rate * float64(time.Second)),
+		clients: map[string]*bucket{},
+	}
+}
+
+// allow takes a token from the bucket of id, or returns how long until one
+// is available
+func (l *limiter) allow(id string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		for key, b := range l.clients {
+			if now.Sub(b.seen) >= l.idle {
+				delete(l.clients, key)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.clients[id]
+	if !ok {
+		b = &bucket{Limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[id] = b
+	}
+	b.seen = now
+
+	r := b.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay, false
+	}
+	return 0, true
+}
+
+// exhausted reports whether the bucket of id is empty, and how long until it
+// holds a token again, without taking one
+func (l *limiter) exhausted(id string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.clients[id]
+	if !ok {
+		return 0, false
+	}
+	tokens := b.TokensAt(now)
+	if tokens >= 1 {
+		return 0, false
+	}
+	return time.Duration((1 - tokens) / float64(l.limit) * float64(time.Second)), true
+}
+
+// retryAfter sets the Retry-After header to wait, in whole seconds
+func retryAfter(c echo.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+// rateLimit answers 429 with Retry-After once a client has used up the
+// bucket of the route class
+func rateLimit(cfg config.Limits) echo.MiddlewareFunc {
+	limiters := map[routeClass]*limiter{
+		classSearch: newLimiter(cfg.Search),
+		classWrite:  newLimiter(cfg.Write),
+		classImport: newLimiter(cfg.Import),
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			l := limiters[classify(c)]
+			if l == nil {
+				return next(c)
+			}
+			if wait, ok := l.allow(clientID(c), time.Now()); !ok {
+				retryAfter(c, wait)
+				return echo.NewHTTPError(http.StatusTooManyRequests, "Rate limit exceeded")
+			}
+			return next(c)
+		}
+	}
+}
+
+// bodyLimit answers 413 to requests whose body is larger than the cap of
+// their route. The limits must be valid.
+func bodyLimit(cfg config.Limits) echo.MiddlewareFunc {
+	isImport := func(c echo.Context) bool { return classify(c) == classImport }
+
+	limit := middleware.BodyLimitWithConfig(middleware.BodyLimitConfig{
+		Skipper: isImport,
+		Limit:   cfg.MaxBody,
+	})
+	importLimit := middleware.BodyLimitWithConfig(middleware.BodyLimitConfig{
+		Skipper: func(c echo.Context) bool { return !isImport(c) },
+		Limit:   cfg.ImportMaxBody,
+	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return limit(importLimit(next))
+	}
+}
+
+// searchQueueTimeout is how long a search waits for one of the others to
+// finish before it is turned away
+const searchQueueTimeout = 2 * time.Second
+
+// searchConcurrency lets at most n searches run at once, answering 503
+// with Retry-After to those that cannot start within searchQueueTimeout.
+// Zero leaves searches unbounded.
+func searchConcurrency(n int) echo.MiddlewareFunc {
+	if n <= 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	}
+	slots := make(chan struct{}, n)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if classify(c) != classSearch {
+				return next(c)
+			}
+
+			timer := time.NewTimer(searchQueueTimeout)
+			defer timer.Stop()
+			select {
+			case slots <- struct{}{}:
+			case <-timer.C:
+				retryAfter(c, time.Second)
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Too many searches are running")
+			case <-c.Request().Context().Done():
+				return c.NoContent(handlers.StatusClientClosedRequest)
+			}
+			defer func() { <-slots }()
+
+			return next(c)
+		}
+	}
+}
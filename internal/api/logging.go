@@ -0,0 +1,71 @@
+package api
+
+import (
+	"log/slog"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/zachatrocity/voyage/internal/logging"
+)
+
+// requestID sets the X-Request-ID response header, reusing the one of the
+// request when the client sent it, and adds the ID to the request context so
+// everything logged while serving the request carries it
+func requestID() echo.MiddlewareFunc {
+	return middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, id string) {
+			ctx := logging.With(c.Request().Context(), "request_id", id)
+			c.SetRequest(c.Request().WithContext(ctx))
+		},
+	})
+}
+
+// recoverer turns panics into 500 responses, logging them with their stack
+func recoverer() echo.MiddlewareFunc {
+	return middleware.RecoverWithConfig(middleware.RecoverConfig{
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			slog.ErrorContext(c.Request().Context(), "Recovered from panic", "error", err, "stack", string(stack))
+			return err
+		},
+	})
+}
+
+// requestLogger logs every request once it is served. The query string is
+// left out, since it holds the search terms.
+func requestLogger() echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		HandleError:     true,
+		LogMethod:       true,
+		LogURIPath:      true,
+		LogRoutePath:    true,
+		LogStatus:       true,
+		LogLatency:      true,
+		LogRemoteIP:     true,
+		LogResponseSize: true,
+		LogError:        true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			level := slog.LevelInfo
+			switch {
+			case v.Status >= 500:
+				level = slog.LevelError
+			case v.Status >= 400:
+				level = slog.LevelWarn
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", v.Method),
+				slog.String("path", v.URIPath),
+				slog.String("route", v.RoutePath),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency),
+				slog.Int64("bytes_out", v.ResponseSize),
+				slog.String("remote_ip", v.RemoteIP),
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.Any("error", v.Error))
+			}
+			slog.LogAttrs(c.Request().Context(), level, "Request served", attrs...)
+			return nil
+		},
+	})
+}
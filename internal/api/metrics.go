@@ -0,0 +1,44 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/metrics"
+)
+
+// requestMetrics counts requests and observes their latency by route. The
+// route is the pattern the request matched, such as /api/v1/email/:id, so
+// message IDs and trip names do not each get their own series.
+func requestMetrics() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			// Errors are rendered by the error handler after the middleware
+			// returns, so take their status from the error
+			status := c.Response().Status
+			if err != nil {
+				status = http.StatusInternalServerError
+				var he *echo.HTTPError
+				if errors.As(err, &he) {
+					status = he.Code
+				}
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			method := c.Request().Method
+			metrics.Requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+			metrics.RequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
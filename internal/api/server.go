@@ -0,0 +1,283 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	scalar "github.com/MarceloPetrucio/go-scalar-api-reference"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	_ "github.com/zachatrocity/voyage/docs" // Import generated docs
+	"github.com/zachatrocity/voyage/internal/api/handlers"
+	"github.com/zachatrocity/voyage/internal/config"
+	"github.com/zachatrocity/voyage/internal/events"
+	"github.com/zachatrocity/voyage/internal/mailsync"
+	"github.com/zachatrocity/voyage/internal/maintenance"
+	"github.com/zachatrocity/voyage/internal/reindex"
+	"github.com/zachatrocity/voyage/internal/reminders"
+	"github.com/zachatrocity/voyage/internal/saved"
+	"github.com/zachatrocity/voyage/internal/webhooks"
+)
+
+// Server is the Echo instance serving the API along with the background
+// work behind it
+type Server struct {
+	*echo.Echo
+
+	// stop ends the reminder and sync schedulers, which workers waits for
+	stop    context.CancelFunc
+	workers sync.WaitGroup
+}
+
+// NewServer loads the services behind the handlers, starts their background
+// work and returns the server. The configuration must be valid and applied.
+func NewServer(cfg *config.Config) (*Server, error) {
+	handlers.Config = cfg
+
+	ctx, stop := context.WithCancel(context.Background())
+	s := &Server{stop: stop}
+
+	// Load webhook subscriptions and deliver events to them
+	webhookService, err := webhooks.NewService()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhooks: %w", err)
+	}
+	events.Subscribe(webhookService.HandleEvent)
+	handlers.Webhooks = webhookService
+
+	// Fire reservation reminders in the background
+	scheduler, err := reminders.NewScheduler(cfg.Reminders.Query, cfg.Reminders.LeadTimes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load reminders: %w", err)
+	}
+	s.goWork(func() { scheduler.Run(ctx) })
+	handlers.Reminders = scheduler
+
+	// Load saved searches
+	savedSearches, err := saved.NewStore()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saved searches: %w", err)
+	}
+	handlers.SavedSearches = savedSearches
+
+	// Run reindex jobs in the background
+	handlers.Reindexer = reindex.NewManager()
+
+	// Run database upgrades and compactions in the background
+	handlers.Maintenance = maintenance.NewRunner(cfg.Database.BackupDir)
+
+	// Index new mail on a schedule when asked to
+	if cfg.Sync.Interval > 0 {
+		syncer := &mailsync.Scheduler{
+			Interval: time.Duration(cfg.Sync.Interval),
+			NewTags:  cfg.Sync.NewTags,
+			Extract:  cfg.Extract.NewMail,
+		}
+		handlers.Syncer = syncer
+		s.goWork(func() { syncer.Run(ctx) })
+	}
+
+	// Create a new Echo instance
+	e := echo.New()
+	// Startup is logged by the caller through slog
+	e.HideBanner = true
+	e.HidePort = true
+	s.Echo = e
+
+	e.HTTPErrorHandler = handlers.HTTPErrorHandler
+	e.IPExtractor = ipExtractor(cfg.Server.TrustedProxies)
+
+	// Middleware
+	e.Use(requestID())
+	e.Use(requestLogger())
+	e.Use(requestMetrics())
+	e.Use(recoverer())
+	e.Use(middleware.CORS())
+
+	// Routes
+	e.GET("/health", handlers.HealthCheck)
+
+	// Liveness and readiness probes
+	e.GET("/livez", handlers.Liveness)
+	e.GET("/readyz", handlers.Readiness)
+
+	// Invalid API keys are limited per client IP on every route taking one
+	authFailures := newLimiter(cfg.Limits.AuthFailures)
+
+	// Prometheus metrics, behind the API keys unless made public
+	metricsAuth := []echo.MiddlewareFunc{}
+	if len(cfg.Auth.APIKeys) > 0 && !cfg.Server.PublicMetrics {
+		metricsAuth = append(metricsAuth, apiKeyAuth(cfg.Auth.APIKeys, authFailures))
+	}
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()), metricsAuth...)
+
+	// Serve Swagger JSON file
+	e.Static("/swagger", "./docs")
+
+	// Scalar API documentation endpoint
+	e.GET("/docs", func(c echo.Context) error {
+		htmlContent, err := scalar.ApiReferenceHTML(&scalar.Options{
+			SpecURL: "docs/swagger.json",
+			CustomOptions: scalar.CustomOptions{
+				PageTitle: "Voyage API Documentation",
+			},
+			DarkMode: true,
+		})
+		if err != nil {
+			slog.ErrorContext(c.Request().Context(), "Failed to generate API documentation", "error", err)
+			return c.String(http.StatusInternalServerError, fmt.Sprintf("Failed to generate API documentation: %v", err))
+		}
+		return c.HTML(http.StatusOK, htmlContent)
+	})
+
+	// API v1 group
+	v1 := e.Group("/api/v1")
+	{
+		// Require an API key when any are configured, then limit requests
+		// per key or client
+		if len(cfg.Auth.APIKeys) > 0 {
+			v1.Use(apiKeyAuth(cfg.Auth.APIKeys, authFailures))
+		}
+		v1.Use(rateLimit(cfg.Limits))
+		v1.Use(bodyLimit(cfg.Limits))
+		v1.Use(searchConcurrency(cfg.Limits.ConcurrentSearches))
+		v1.Use(compress())
+
+		// Search endpoint
+		v1.GET("/search", handlers.Search)
+		v1.POST("/search", handlers.StructuredSearch)
+		v1.GET("/search/validate", handlers.ValidateQuery)
+		v1.GET("/count", handlers.Count)
+
+		// Change feed endpoint
+		v1.GET("/changes", handlers.GetChanges)
+
+		// Email endpoint
+		v1.GET("/email/:id", handlers.GetEmail)
+
+		// Tag email endpoint
+		v1.POST("/email/:id/tags/:tag", handlers.TagEmail)
+		v1.DELETE("/email/:id/tags/:tag", handlers.UntagEmail)
+
+		// Extracted reservations endpoint
+		v1.GET("/email/:id/reservations", handlers.GetEmailReservations)
+
+		// Trip endpoints
+		v1.GET("/trips", handlers.ListTrips)
+		v1.POST("/trips", handlers.CreateTrip)
+		v1.GET("/trips/:name", handlers.GetTrip)
+		v1.POST("/trips/:name/merge", handlers.MergeTrip)
+
+		// Webhook endpoints
+		v1.GET("/webhooks", handlers.ListWebhooks)
+		v1.POST("/webhooks", handlers.CreateWebhook)
+		v1.GET("/webhooks/:id", handlers.GetWebhook)
+		v1.DELETE("/webhooks/:id", handlers.DeleteWebhook)
+		v1.GET("/webhooks/:id/deliveries", handlers.GetWebhookDeliveries)
+
+		// Reminder endpoints
+		v1.GET("/reminders", handlers.ListReminders)
+
+		// Saved search endpoints
+		v1.GET("/saved", handlers.ListSavedSearches)
+		v1.POST("/saved", handlers.CreateSavedSearch)
+		v1.GET("/saved/:name", handlers.GetSavedSearch)
+		v1.PUT("/saved/:name", handlers.UpdateSavedSearch)
+		v1.DELETE("/saved/:name", handlers.DeleteSavedSearch)
+		v1.GET("/saved/:name/results", handlers.GetSavedSearchResults)
+
+		// Reindex endpoints
+		v1.POST("/reindex", handlers.StartReindex)
+		v1.GET("/reindex", handlers.ListReindexJobs)
+		v1.GET("/reindex/:id", handlers.GetReindexJob)
+		v1.POST("/reindex/:id/cancel", handlers.CancelReindexJob)
+
+		// Admin endpoints, refused while the API is open
+		admin := v1.Group("/admin", requireAPIKeys(cfg.Auth.APIKeys))
+
+		// Database maintenance
+		admin.GET("/database", handlers.GetDatabaseStatus)
+		admin.POST("/database/upgrade", handlers.UpgradeDatabase)
+		admin.POST("/database/compact", handlers.CompactDatabase)
+		admin.GET("/database/check", handlers.CheckDatabase)
+
+		// Effective configuration
+		admin.GET("/config", handlers.GetConfig)
+
+		// Health diagnostics
+		admin.GET("/health/details", handlers.GetHealthDetails)
+	}
+
+	return s, nil
+}
+
+// goWork runs fn in the background until Shutdown
+func (s *Server) goWork(fn func()) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		fn()
+	}()
+}
+
+// Serve listens on addr until ctx is done, then shuts the server down,
+// giving it timeout to finish
+func (s *Server) Serve(ctx context.Context, addr string, timeout time.Duration) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Start(addr)
+	}()
+
+	select {
+	case err := <-errc:
+		// The listener failed; stop the background work anyway
+		s.Shutdown(context.Background())
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, waiting for requests and background work", "timeout", timeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.Shutdown(shutdownCtx)
+}
+
+// Shutdown stops accepting requests and waits for the ones in flight, then
+// stops the background work: the schedulers, reindex jobs, webhook retries
+// and any upgrade or compaction. Requests still running when ctx is done are
+// cut off, which cancels their searches. Shutdown returns once all work has
+// stopped, closing its database handles, or ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.Echo.Shutdown(ctx)
+	if err != nil {
+		slog.Warn("Requests still running, closing their connections", "error", err)
+		s.Echo.Close()
+	}
+
+	s.stop()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		// Stop whatever publishes events before the webhook deliveries
+		s.workers.Wait()
+		handlers.Reindexer.Close()
+		handlers.Webhooks.Close()
+		handlers.Maintenance.Wait()
+	}()
+
+	select {
+	case <-stopped:
+		slog.Info("Server stopped")
+	case <-ctx.Done():
+		slog.Warn("Gave up waiting for background work", "error", ctx.Err())
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+	return err
+}
@@ -0,0 +1,531 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/bytes"
+	"github.com/zachatrocity/voyage/internal/extract"
+	"github.com/zachatrocity/voyage/internal/logging"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+	"github.com/zachatrocity/voyage/internal/query"
+	"github.com/zachatrocity/voyage/internal/reminders"
+	"github.com/zachatrocity/voyage/internal/state"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in the effective configuration
+const redacted = "[redacted]"
+
+// Config is the configuration of voyage. It is layered from the defaults, a
+// YAML file, environment variables and command-line flags, each overriding
+// the ones before.
+// @Description Effective configuration, with secrets redacted
+type Config struct {
+	Database  Database  `yaml:"database" json:"database"`
+	Server    Server    `yaml:"server" json:"server"`
+	Auth      Auth      `yaml:"auth" json:"auth"`
+	Limits    Limits    `yaml:"limits" json:"limits"`
+	Sync      Sync      `yaml:"sync" json:"sync"`
+	Extract   Extract   `yaml:"extract" json:"extract"`
+	Search    Search    `yaml:"search" json:"search"`
+	Reminders Reminders `yaml:"reminders" json:"reminders"`
+	Log       Log       `yaml:"log" json:"log"`
+	// File is the YAML file the configuration was read from, if any
+	File string `yaml:"-" json:"file,omitempty" example:"/config/voyage.yaml"`
+}
+
+// Database locates the notmuch database and the files voyage keeps next to it
+type Database struct {
+	// Path is the mail root holding the notmuch database
+	Path string `yaml:"path" json:"path" example:"/mail"`
+	// NotmuchConfig is the notmuch config file of the user. Its
+	// database.path, search.exclude_tags, new.tags and
+	// maildir.synchronize_flags are the defaults of the settings here, and
+	// libnotmuch reads it whenever the database is opened. Maildir flag
+	// syncing stays off unless the file sets maildir.synchronize_flags.
+	NotmuchConfig string `yaml:"notmuch_config" json:"notmuch_config,omitempty" example:"/config/notmuch/config"`
+	// StateDir keeps webhooks, saved searches and fired reminders; empty
+	// means <path>/.notmuch/voyage
+	StateDir string `yaml:"state_dir" json:"state_dir,omitempty" example:"/mail/.notmuch/voyage"`
+	// BackupDir receives the original database on every compaction; empty
+	// means <path>/.notmuch/backups
+	BackupDir string `yaml:"backup_dir" json:"backup_dir,omitempty" example:"/mail/.notmuch/backups"`
+}
+
+// Server configures the HTTP API
+type Server struct {
+	// Listen is the address the API listens on
+	Listen string `yaml:"listen" json:"listen" example:":8080"`
+	// ShutdownTimeout bounds how long a stopping server waits for requests
+	// in flight and background work to finish
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" json:"shutdown_timeout" swaggertype:"string" example:"30s"`
+	// PublicMetrics serves /metrics without an API key when API keys are
+	// configured, for scrapers that cannot send one
+	PublicMetrics bool `yaml:"public_metrics" json:"public_metrics" example:"false"`
+	// TrustedProxies are the IPs or CIDR ranges of the reverse proxies
+	// whose X-Forwarded-For header tells the client IP. When empty the IP
+	// of the connection is used.
+	TrustedProxies []string `yaml:"trusted_proxies" json:"trusted_proxies" example:"172.16.0.0/12"`
+}
+
+// Auth protects the API
+type Auth struct {
+	// APIKeys are accepted as a Bearer token or in the X-API-Key header.
+	// When empty the API is open, except for the admin endpoints.
+	APIKeys []string `yaml:"api_keys" json:"api_keys" example:"[redacted]"`
+}
+
+// Limits protect the database from expensive or oversized requests
+type Limits struct {
+	// Search limits the routes running searches, Write the other requests
+	// changing data, and Import the import and upload routes. Requests are
+	// counted per API key, or per client IP when the API is open.
+	Search RateLimit `yaml:"search" json:"search"`
+	Write  RateLimit `yaml:"write" json:"write"`
+	Import RateLimit `yaml:"import" json:"import"`
+	// AuthFailures limits the requests with an invalid API key, per client
+	// IP; once it is used up the client's keys are not checked any more
+	// until it refills
+	AuthFailures RateLimit `yaml:"auth_failures" json:"auth_failures"`
+	// MaxBody caps request bodies, and ImportMaxBody those of the import
+	// and upload routes, written like 512K or 1M
+	MaxBody       string `yaml:"max_body" json:"max_body" example:"1M"`
+	ImportMaxBody string `yaml:"import_max_body" json:"import_max_body" example:"50M"`
+	// ConcurrentSearches bounds the searches running at once; zero leaves
+	// them unbounded
+	ConcurrentSearches int `yaml:"concurrent_searches" json:"concurrent_searches" example:"8"`
+}
+
+// RateLimit is a token bucket holding up to Burst requests and refilled at
+// Rate requests per second
+type RateLimit struct {
+	// Rate is the sustained requests per second; zero disables the limit
+	Rate  float64 `yaml:"rate" json:"rate" example:"10"`
+	Burst int     `yaml:"burst" json:"burst" example:"30"`
+}
+
+// Sync configures indexing of new mail
+type Sync struct {
+	// Interval between syncs run by the API server; zero leaves syncing to
+	// the mail container or voyage sync
+	Interval Duration `yaml:"interval" json:"interval" swaggertype:"string" example:"15m"`
+	// NewTags are added to new emails
+	NewTags []string `yaml:"new_tags" json:"new_tags" example:"unread,inbox"`
+	// MaildirFlags renames Maildir files when tags change, and turns the
+	// flags of new mail into tags
+	MaildirFlags bool `yaml:"maildir_flags" json:"maildir_flags" example:"false"`
+}
+
+// Extract configures reservation extraction
+type Extract struct {
+	// NewMail extracts the reservations of the emails every sync adds
+	NewMail bool `yaml:"new_mail" json:"new_mail" example:"true"`
+	// Parsers names the parsers to run, in their registered order; empty
+	// runs every parser
+	Parsers []string `yaml:"parsers" json:"parsers" example:"schema.org"`
+}
+
+// Search configures the default search behaviour
+type Search struct {
+	// ExcludeTags hide messages unless the query names the tag
+	ExcludeTags []string `yaml:"exclude_tags" json:"exclude_tags" example:"deleted,spam,voyage-ignored"`
+}
+
+// Reminders configures the reservation reminders
+type Reminders struct {
+	// Query selects the emails reminders are computed from
+	Query string `yaml:"query" json:"query" example:"tag:travel"`
+	// LeadTimes override the default lead times, e.g.
+	// "flight.checkin-opens=24h,hotel.checkout-today=3h"
+	LeadTimes string `yaml:"lead_times" json:"lead_times,omitempty" example:"flight.checkin-opens=24h"`
+}
+
+// Log configures logging
+type Log struct {
+	// Level is the minimum level logged: debug, info, warn or error
+	Level string `yaml:"level" json:"level" example:"info"`
+	// Format is json or text
+	Format string `yaml:"format" json:"format" example:"json"`
+	// Redact is what is hidden from the logs: none, emails for the local
+	// part of email addresses, or queries for addresses and query terms
+	// other than tags, dates and folders
+	Redact string `yaml:"redact" json:"redact" example:"queries"`
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Database: Database{Path: "/mail"},
+		Server:   Server{Listen: ":8080", ShutdownTimeout: Duration(30 * time.Second), TrustedProxies: []string{}},
+		Auth:     Auth{APIKeys: []string{}},
+		Limits: Limits{
+			Search:             RateLimit{Rate: 10, Burst: 30},
+			Write:              RateLimit{Rate: 5, Burst: 20},
+			Import:             RateLimit{Rate: 1, Burst: 5},
+			AuthFailures:       RateLimit{Rate: 0.1, Burst: 10},
+			MaxBody:            "1M",
+			ImportMaxBody:      "50M",
+			ConcurrentSearches: 8,
+		},
+		Sync:    Sync{NewTags: []string{"unread", "inbox"}},
+		Extract: Extract{NewMail: true, Parsers: []string{}},
+		Search:  Search{ExcludeTags: []string{"deleted", "spam", "voyage-ignored"}},
+		Reminders: Reminders{
+			Query: "tag:travel",
+		},
+		Log: Log{Level: "info", Format: logging.FormatJSON, Redact: logging.RedactQueries},
+	}
+}
+
+// Load returns the defaults overridden by the notmuch config file, then the
+// YAML file at path, when path is not empty, and then the environment. Flags
+// are applied by the caller before Validate.
+func Load(path string) (*Config, error) {
+	// The notmuch config file is named in the YAML file or the
+	// environment, but its settings lie below both
+	cfg, err := load(path, nil)
+	if err != nil || cfg.Database.NotmuchConfig == "" {
+		return cfg, err
+	}
+
+	user, err := notmuch.ReadUserConfig(cfg.Database.NotmuchConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notmuch config: %w", err)
+	}
+	return load(path, user)
+}
+
+// load layers the YAML file and the environment over the defaults and the
+// notmuch config file, if any
+func load(path string, user *notmuch.UserConfig) (*Config, error) {
+	cfg := Default()
+	if user != nil {
+		cfg.applyNotmuch(user)
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		cfg.File = path
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// applyNotmuch takes the database location, excluded tags, new-mail tags and
+// Maildir flag syncing from the notmuch config. Lists left empty there, and
+// Maildir flag syncing when the file does not set it, keep the defaults.
+func (cfg *Config) applyNotmuch(user *notmuch.UserConfig) {
+	if user.DatabasePath != "" {
+		cfg.Database.Path = user.DatabasePath
+	}
+	if len(user.ExcludeTags) > 0 {
+		cfg.Search.ExcludeTags = user.ExcludeTags
+	}
+	if len(user.NewTags) > 0 {
+		cfg.Sync.NewTags = user.NewTags
+	}
+	if user.SyncMaildirFlags != nil {
+		cfg.Sync.MaildirFlags = *user.SyncMaildirFlags
+	}
+}
+
+// loadEnv applies the environment variables that are set
+func (cfg *Config) loadEnv() error {
+	// NOTMUCH_DB_PATH is the name used by docker-compose
+	setString(&cfg.Database.Path, "NOTMUCH_DB_PATH")
+	setString(&cfg.Database.Path, "NOTMUCH_DATABASE")
+	setString(&cfg.Database.NotmuchConfig, "NOTMUCH_CONFIG")
+	setString(&cfg.Database.StateDir, "VOYAGE_STATE_DIR")
+	setString(&cfg.Database.BackupDir, "VOYAGE_BACKUP_DIR")
+
+	if port, ok := os.LookupEnv("PORT"); ok {
+		cfg.Server.Listen = ":" + port
+	}
+	setString(&cfg.Server.Listen, "VOYAGE_LISTEN")
+	if value, ok := os.LookupEnv("VOYAGE_SHUTDOWN_TIMEOUT"); ok {
+		if err := cfg.Server.ShutdownTimeout.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("VOYAGE_SHUTDOWN_TIMEOUT: %w", err)
+		}
+	}
+	if value, ok := os.LookupEnv("VOYAGE_PUBLIC_METRICS"); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("VOYAGE_PUBLIC_METRICS: %w", err)
+		}
+		cfg.Server.PublicMetrics = b
+	}
+	setList(&cfg.Server.TrustedProxies, "VOYAGE_TRUSTED_PROXIES")
+
+	setList(&cfg.Auth.APIKeys, "VOYAGE_API_KEYS")
+
+	for _, limit := range []struct {
+		name  string
+		limit *RateLimit
+	}{
+		{"SEARCH", &cfg.Limits.Search},
+		{"WRITE", &cfg.Limits.Write},
+		{"IMPORT", &cfg.Limits.Import},
+		{"AUTH_FAILURE", &cfg.Limits.AuthFailures},
+	} {
+		if value, ok := os.LookupEnv("VOYAGE_" + limit.name + "_RATE"); ok {
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("VOYAGE_%s_RATE: %w", limit.name, err)
+			}
+			limit.limit.Rate = rate
+		}
+		if value, ok := os.LookupEnv("VOYAGE_" + limit.name + "_BURST"); ok {
+			burst, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("VOYAGE_%s_BURST: %w", limit.name, err)
+			}
+			limit.limit.Burst = burst
+		}
+	}
+	setString(&cfg.Limits.MaxBody, "VOYAGE_MAX_BODY")
+	setString(&cfg.Limits.ImportMaxBody, "VOYAGE_IMPORT_MAX_BODY")
+	if value, ok := os.LookupEnv("VOYAGE_CONCURRENT_SEARCHES"); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("VOYAGE_CONCURRENT_SEARCHES: %w", err)
+		}
+		cfg.Limits.ConcurrentSearches = n
+	}
+
+	if value, ok := os.LookupEnv("SYNC_FREQUENCY"); ok {
+		if err := cfg.Sync.Interval.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("SYNC_FREQUENCY: %w", err)
+		}
+	}
+	setList(&cfg.Sync.NewTags, "VOYAGE_NEW_TAGS")
+	if value, ok := os.LookupEnv("VOYAGE_SYNC_MAILDIR_FLAGS"); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("VOYAGE_SYNC_MAILDIR_FLAGS: %w", err)
+		}
+		cfg.Sync.MaildirFlags = b
+	}
+
+	if value, ok := os.LookupEnv("VOYAGE_EXTRACT_NEW_MAIL"); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("VOYAGE_EXTRACT_NEW_MAIL: %w", err)
+		}
+		cfg.Extract.NewMail = b
+	}
+	setList(&cfg.Extract.Parsers, "VOYAGE_EXTRACT_PARSERS")
+
+	setList(&cfg.Search.ExcludeTags, "VOYAGE_EXCLUDE_TAGS")
+	setString(&cfg.Reminders.Query, "VOYAGE_REMINDER_QUERY")
+	setString(&cfg.Reminders.LeadTimes, "VOYAGE_REMINDER_LEAD_TIMES")
+	setString(&cfg.Log.Level, "VOYAGE_LOG_LEVEL")
+	setString(&cfg.Log.Format, "VOYAGE_LOG_FORMAT")
+	setString(&cfg.Log.Redact, "VOYAGE_LOG_REDACT")
+
+	return nil
+}
+
+// ParseProxy parses a trusted proxy, an IP or a CIDR range
+func ParseProxy(proxy string) (*net.IPNet, error) {
+	if ip := net.ParseIP(proxy); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not an IP or CIDR range", proxy)
+	}
+	return network, nil
+}
+
+// setString overrides *field with the environment variable when it is set
+// and not empty
+func setString(field *string, name string) {
+	if value := os.Getenv(name); value != "" {
+		*field = value
+	}
+}
+
+// setList overrides *field with the comma-separated environment variable
+// when it is set, even to an empty list
+func setList(field *[]string, name string) {
+	if value, ok := os.LookupEnv(name); ok {
+		*field = notmuch.ParseTagList(value)
+	}
+}
+
+// Validate checks every setting, reporting all problems at once
+func (cfg *Config) Validate() error {
+	var errs []error
+	invalid := func(field string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if cfg.Database.Path == "" {
+		invalid("database.path", "is required")
+	}
+
+	if _, port, err := net.SplitHostPort(cfg.Server.Listen); err != nil {
+		invalid("server.listen", "%v", err)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		invalid("server.listen", "invalid port %q", port)
+	}
+	if cfg.Server.ShutdownTimeout < 0 {
+		invalid("server.shutdown_timeout", "must not be negative")
+	}
+	for i, proxy := range cfg.Server.TrustedProxies {
+		if _, err := ParseProxy(proxy); err != nil {
+			invalid(fmt.Sprintf("server.trusted_proxies[%d]", i), "%v", err)
+		}
+	}
+
+	for i, key := range cfg.Auth.APIKeys {
+		if strings.TrimSpace(key) == "" {
+			invalid(fmt.Sprintf("auth.api_keys[%d]", i), "is empty")
+		}
+	}
+
+	for _, limit := range []struct {
+		field string
+		limit RateLimit
+	}{
+		{"limits.search", cfg.Limits.Search},
+		{"limits.write", cfg.Limits.Write},
+		{"limits.import", cfg.Limits.Import},
+		{"limits.auth_failures", cfg.Limits.AuthFailures},
+	} {
+		if limit.limit.Rate < 0 {
+			invalid(limit.field+".rate", "must not be negative")
+		}
+		if limit.limit.Rate > 0 && limit.limit.Burst < 1 {
+			invalid(limit.field+".burst", "must be at least 1")
+		}
+	}
+	if _, err := bytes.Parse(cfg.Limits.MaxBody); err != nil {
+		invalid("limits.max_body", "%v", err)
+	}
+	if _, err := bytes.Parse(cfg.Limits.ImportMaxBody); err != nil {
+		invalid("limits.import_max_body", "%v", err)
+	}
+	if cfg.Limits.ConcurrentSearches < 0 {
+		invalid("limits.concurrent_searches", "must not be negative")
+	}
+
+	if cfg.Sync.Interval < 0 {
+		invalid("sync.interval", "must not be negative")
+	}
+	for _, tag := range cfg.Sync.NewTags {
+		if tag == "" || strings.ContainsAny(tag, " \t\n") {
+			invalid("sync.new_tags", "invalid tag %q", tag)
+		}
+	}
+
+	known := extract.ParserNames()
+	for _, name := range cfg.Extract.Parsers {
+		if !slices.Contains(known, name) {
+			invalid("extract.parsers", "unknown parser %q, expected one of %s", name, strings.Join(known, ", "))
+		}
+	}
+
+	if report := query.Validate(cfg.Reminders.Query); cfg.Reminders.Query == "" || !report.Valid {
+		invalid("reminders.query", "invalid query %q", cfg.Reminders.Query)
+	}
+	if _, err := reminders.RulesFromEnv(reminders.DefaultRules, cfg.Reminders.LeadTimes); err != nil {
+		invalid("reminders.lead_times", "%v", err)
+	}
+
+	if _, err := logging.ParseLevel(cfg.Log.Level); err != nil {
+		invalid("log.level", "%v", err)
+	}
+	switch cfg.Log.Format {
+	case logging.FormatJSON, logging.FormatText:
+	default:
+		invalid("log.format", "must be %s or %s", logging.FormatJSON, logging.FormatText)
+	}
+	switch cfg.Log.Redact {
+	case logging.RedactNone, logging.RedactEmails, logging.RedactQueries:
+	default:
+		invalid("log.redact", "must be %s, %s or %s", logging.RedactNone, logging.RedactEmails, logging.RedactQueries)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Apply hands the settings to the packages that read them at run time and
+// makes the configured logger the default. The configuration must be valid.
+func (cfg *Config) Apply() {
+	notmuch.DatabasePath = cfg.Database.Path
+	notmuch.NotmuchConfig = cfg.Database.NotmuchConfig
+	notmuch.DefaultExcludeTags = cfg.Search.ExcludeTags
+	notmuch.SyncMaildirFlags = cfg.Sync.MaildirFlags
+	extract.EnabledParsers = cfg.Extract.Parsers
+	state.Dir = cfg.Database.StateDir
+
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	logging.Setup(os.Stderr, logging.Options{Level: level, Format: cfg.Log.Format, Redact: cfg.Log.Redact})
+}
+
+// Redacted returns a copy of the configuration safe to show, with secrets
+// replaced
+func (cfg *Config) Redacted() *Config {
+	c := *cfg
+	c.Auth.APIKeys = make([]string, len(cfg.Auth.APIKeys))
+	for i := range c.Auth.APIKeys {
+		c.Auth.APIKeys[i] = redacted
+	}
+	return &c
+}
+
+// Duration is a time.Duration written like 90s, 15m or 12h, and also in
+// days like 1d as SYNC_FREQUENCY allows
+type Duration time.Duration
+
+// MarshalText writes the duration in Go syntax
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText parses a Go duration or a whole number of days. Empty
+// means zero.
+func (d *Duration) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if s == "" {
+		*d = 0
+		return nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		*d = Duration(time.Duration(n) * 24 * time.Hour)
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
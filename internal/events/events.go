@@ -0,0 +1,76 @@
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Event types published by Voyage
+const (
+	// TypeEmailTagged is published after a tag has been added to an email
+	TypeEmailTagged = "email.tagged"
+	// TypeEmailUntagged is published after a tag has been removed from an email
+	TypeEmailUntagged = "email.untagged"
+	// TypeReminderDue is published when a reservation reminder comes due
+	TypeReminderDue = "reminder.due"
+	// TypeReservationExtracted is published for every reservation found in
+	// new mail by a sync
+	TypeReservationExtracted = "reservation.extracted"
+)
+
+// Event represents something that happened to the travel data
+// @Description Travel event
+type Event struct {
+	ID        string                 `json:"id" example:"6f1c2a9e4b7d3e10"`
+	Type      string                 `json:"type" example:"email.tagged"`
+	MessageID string                 `json:"message_id,omitempty" example:"<12345@example.com>"`
+	Timestamp time.Time              `json:"timestamp" example:"2023-01-01T12:00:00Z"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+// Handler is called for every published event
+type Handler func(Event)
+
+var (
+	mu       sync.RWMutex
+	handlers []Handler
+)
+
+// Subscribe registers a handler that is called for every published event
+func Subscribe(h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers = append(handlers, h)
+}
+
+// Publish delivers an event to every subscribed handler. The event ID and
+// timestamp are filled in when they are not already set.
+func Publish(e Event) Event {
+	if e.ID == "" {
+		e.ID = NewID()
+	}
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now().UTC()
+	}
+
+	mu.RLock()
+	subscribers := make([]Handler, len(handlers))
+	copy(subscribers, handlers)
+	mu.RUnlock()
+
+	for _, h := range subscribers {
+		h(e)
+	}
+	return e
+}
+
+// NewID returns a random identifier suitable for events and deliveries
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,258 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zachatrocity/voyage/internal/metrics"
+)
+
+// Reservation types
+const (
+	TypeFlight = "flight"
+	TypeHotel  = "hotel"
+)
+
+// Reservation statuses
+const (
+	StatusConfirmed = "confirmed"
+	StatusCancelled = "cancelled"
+)
+
+// Reservation is a single booking extracted from a travel email
+// @Description Reservation extracted from a travel email
+type Reservation struct {
+	Type         string    `json:"type" example:"flight"`
+	Parser       string    `json:"parser" example:"schema.org"`
+	MessageID    string    `json:"message_id" example:"<12345@example.com>"`
+	Confirmation string    `json:"confirmation" example:"ABC123"`
+	Status       string    `json:"status" example:"confirmed"`
+	Provider     string    `json:"provider" example:"United Airlines"`
+	Name         string    `json:"name" example:"UA 123"`
+	Origin       string    `json:"origin,omitempty" example:"SFO"`
+	Destination  string    `json:"destination,omitempty" example:"JFK"`
+	StartAt      time.Time `json:"start_at" example:"2023-01-01T08:00:00-08:00"`
+	EndAt        time.Time `json:"end_at" example:"2023-01-01T16:30:00-05:00"`
+	// StartZone and EndZone name the IANA time zone of the venue when it
+	// is known, or are floating for a wall clock time at a venue whose
+	// zone is not
+	StartZone string `json:"start_zone,omitempty" example:"America/Los_Angeles"`
+	EndZone   string `json:"end_zone,omitempty" example:"America/New_York"`
+}
+
+// Instant returns the moment a reservation time happens. A FloatingZone
+// time is taken at the earliest moment it may be, in the easternmost zone,
+// so that what is scheduled before it is never late.
+func Instant(t time.Time, zone string) time.Time {
+	if zone == FloatingZone && !t.IsZero() {
+		return t.Add(-14 * time.Hour)
+	}
+	return t
+}
+
+// Cancelled reports whether the reservation has been cancelled
+func (r Reservation) Cancelled() bool {
+	return r.Status == StatusCancelled
+}
+
+// Message is the decoded content of an email handed to the parsers
+type Message struct {
+	ID     string
+	Header mail.Header
+	// HTML holds the decoded text/html parts
+	HTML []string
+	// Text holds the decoded text/plain parts
+	Text []string
+	// JSONLD holds every JSON-LD document found in the message, either as
+	// an application/ld+json part or embedded in an HTML script tag
+	JSONLD []string
+}
+
+// Parser extracts reservations from a decoded message
+type Parser interface {
+	// Name identifies the parser, usually after the provider or format it handles
+	Name() string
+	// Parse returns the reservations found in the message, if any
+	Parse(msg *Message) ([]Reservation, error)
+}
+
+// Parsers are tried in order for every message
+var Parsers = []Parser{
+	&SchemaOrgParser{},
+}
+
+// EnabledParsers names the parsers FromReader runs; empty runs them all
+var EnabledParsers []string
+
+// ParserNames returns the names of the registered parsers
+func ParserNames() []string {
+	names := make([]string, len(Parsers))
+	for i, p := range Parsers {
+		names[i] = p.Name()
+	}
+	return names
+}
+
+// enabled reports whether the parser named name is among EnabledParsers
+func enabled(name string) bool {
+	if len(EnabledParsers) == 0 {
+		return true
+	}
+	for _, n := range EnabledParsers {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// FromFile reads an email from disk and extracts its reservations
+func FromFile(messageID string, filename string) ([]Reservation, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open email: %w", err)
+	}
+	defer f.Close()
+
+	return FromReader(messageID, f)
+}
+
+// FromReader parses an email and runs every enabled parser over it
+func FromReader(messageID string, r io.Reader) ([]Reservation, error) {
+	msg, err := ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	if messageID != "" {
+		msg.ID = messageID
+	}
+
+	var reservations []Reservation
+	for _, p := range Parsers {
+		if !enabled(p.Name()) {
+			continue
+		}
+		found, err := p.Parse(msg)
+		switch {
+		case err != nil:
+			metrics.Extractions.WithLabelValues(p.Name(), metrics.ResultFailure).Inc()
+			return nil, fmt.Errorf("%s parser: %w", p.Name(), err)
+		case len(found) == 0:
+			metrics.Extractions.WithLabelValues(p.Name(), metrics.ResultNone).Inc()
+		default:
+			metrics.Extractions.WithLabelValues(p.Name(), metrics.ResultSuccess).Inc()
+		}
+		for _, res := range found {
+			res.Parser = p.Name()
+			res.MessageID = msg.ID
+			reservations = append(reservations, res)
+		}
+	}
+
+	return reservations, nil
+}
+
+// ReadMessage decodes an email into the parts the parsers care about
+func ReadMessage(r io.Reader) (*Message, error) {
+	m, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email: %w", err)
+	}
+
+	msg := &Message{
+		ID:     strings.Trim(m.Header.Get("Message-Id"), "<> "),
+		Header: m.Header,
+	}
+	err = msg.addPart(m.Header.Get("Content-Type"), m.Header.Get("Content-Transfer-Encoding"), m.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// scriptPattern matches JSON-LD script blocks embedded in HTML
+var scriptPattern = regexp.MustCompile(`(?is)<script[^>]+type\s*=\s*["']application/ld\+json["'][^>]*>(.*?)</script>`)
+
+// addPart decodes a MIME part, descending into multiparts
+func (msg *Message) addPart(contentType string, encoding string, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read multipart body: %w", err)
+			}
+
+			err = msg.addPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	switch mediaType {
+	case "text/html", "text/plain", "application/ld+json":
+	default:
+		return nil
+	}
+
+	data, err := io.ReadAll(decodeTransfer(encoding, body))
+	if err != nil {
+		return fmt.Errorf("failed to decode %s part: %w", mediaType, err)
+	}
+	content := string(data)
+
+	switch mediaType {
+	case "text/html":
+		msg.HTML = append(msg.HTML, content)
+		for _, m := range scriptPattern.FindAllStringSubmatch(content, -1) {
+			msg.JSONLD = append(msg.JSONLD, m[1])
+		}
+	case "text/plain":
+		msg.Text = append(msg.Text, content)
+	case "application/ld+json":
+		msg.JSONLD = append(msg.JSONLD, content)
+	}
+	return nil
+}
+
+// decodeTransfer undoes the Content-Transfer-Encoding of a part
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return bytes.NewReader(nil)
+		}
+		clean := strings.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+				return -1
+			}
+			return r
+		}, string(data))
+		return base64.NewDecoder(base64.StdEncoding, strings.NewReader(clean))
+	default:
+		return body
+	}
+}
@@ -0,0 +1,218 @@
+package extract
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zachatrocity/voyage/internal/notmuch"
+)
+
+// PropertyPrefix starts the key of every message property written by voyage
+const PropertyPrefix = "voyage."
+
+// extractedKey marks a message as extracted, even when it holds no
+// reservation, so it is not parsed again
+const extractedKey = PropertyPrefix + "extracted_at"
+
+// Properties encodes reservations as notmuch message properties. The first
+// reservation uses plain keys such as voyage.confirmation and voyage.depart_at;
+// further ones are numbered from 2, as in voyage.2.confirmation.
+func Properties(reservations []Reservation, extractedAt time.Time) map[string][]string {
+	props := map[string][]string{
+		extractedKey: {extractedAt.UTC().Format(time.RFC3339)},
+	}
+
+	for i, res := range reservations {
+		prefix := PropertyPrefix
+		if i > 0 {
+			prefix = fmt.Sprintf("%s%d.", PropertyPrefix, i+1)
+		}
+
+		startKey, endKey := timeKeys(res.Type)
+		fields := []struct {
+			key   string
+			value string
+		}{
+			{"type", res.Type},
+			{"parser", res.Parser},
+			{"status", res.Status},
+			{"confirmation", res.Confirmation},
+			{"provider", res.Provider},
+			{"name", res.Name},
+			{"origin", res.Origin},
+			{"destination", res.Destination},
+			{startKey, formatTime(res.StartAt, res.StartZone)},
+			{endKey, formatTime(res.EndAt, res.EndZone)},
+			{zoneKey(startKey), res.StartZone},
+			{zoneKey(endKey), res.EndZone},
+		}
+		for _, f := range fields {
+			if f.value != "" {
+				props[prefix+f.key] = []string{f.value}
+			}
+		}
+	}
+
+	return props
+}
+
+// FromProperties decodes the reservations stored on a message. It reports
+// false when the message has not been extracted yet.
+func FromProperties(messageID string, props map[string][]string) ([]Reservation, bool) {
+	if len(props[extractedKey]) == 0 {
+		return nil, false
+	}
+
+	byIndex := map[int]map[string]string{}
+	for key, values := range props {
+		if key == extractedKey || !strings.HasPrefix(key, PropertyPrefix) || len(values) == 0 {
+			continue
+		}
+
+		index, field := 1, strings.TrimPrefix(key, PropertyPrefix)
+		if n, rest, ok := strings.Cut(field, "."); ok {
+			i, err := strconv.Atoi(n)
+			if err != nil || i < 2 {
+				continue
+			}
+			index, field = i, rest
+		}
+		if byIndex[index] == nil {
+			byIndex[index] = map[string]string{}
+		}
+		byIndex[index][field] = values[0]
+	}
+
+	indexes := make([]int, 0, len(byIndex))
+	for i := range byIndex {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	reservations := []Reservation{}
+	for _, i := range indexes {
+		fields := byIndex[i]
+		startKey, endKey := timeKeys(fields["type"])
+		startZone, endZone := fields[zoneKey(startKey)], fields[zoneKey(endKey)]
+		reservations = append(reservations, Reservation{
+			Type:         fields["type"],
+			Parser:       fields["parser"],
+			MessageID:    messageID,
+			Confirmation: fields["confirmation"],
+			Status:       fields["status"],
+			Provider:     fields["provider"],
+			Name:         fields["name"],
+			Origin:       fields["origin"],
+			Destination:  fields["destination"],
+			StartAt:      parseStored(fields[startKey], startZone),
+			EndAt:        parseStored(fields[endKey], endZone),
+			StartZone:    startZone,
+			EndZone:      endZone,
+		})
+	}
+
+	return reservations, true
+}
+
+// Stored returns the reservations persisted on a message, reporting false
+// when the message has not been extracted yet
+func Stored(messageID string) ([]Reservation, bool, error) {
+	props, err := notmuch.GetProperties(messageID, PropertyPrefix)
+	if err != nil {
+		return nil, false, err
+	}
+
+	reservations, ok := FromProperties(messageID, props)
+	return reservations, ok, nil
+}
+
+// Store persists the reservations of a message as message properties,
+// replacing any stored earlier
+func Store(messageID string, reservations []Reservation) error {
+	return notmuch.SetProperties(messageID, PropertyPrefix, Properties(reservations, time.Now()))
+}
+
+// Extract returns the reservations of a message, reading them from its
+// properties when it was extracted before. Otherwise the email is parsed
+// and the result stored on the message for next time.
+func Extract(ctx context.Context, messageID string, filename string) ([]Reservation, error) {
+	reservations, ok, err := Stored(messageID)
+	if err != nil && !errors.Is(err, notmuch.ErrNotFound) {
+		slog.WarnContext(ctx, "Failed to read stored reservations", "message_id", messageID, "error", err)
+	}
+	if ok {
+		return reservations, nil
+	}
+
+	reservations, err = FromFile(messageID, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// A read-only or busy database only costs a parse on the next start
+	if err := Store(messageID, reservations); err != nil {
+		slog.WarnContext(ctx, "Failed to store reservations", "message_id", messageID, "error", err)
+	}
+
+	return reservations, nil
+}
+
+// timeKeys names the start and end time properties of a reservation type
+func timeKeys(reservationType string) (string, string) {
+	switch reservationType {
+	case TypeFlight:
+		return "depart_at", "arrive_at"
+	case TypeHotel:
+		return "checkin_at", "checkout_at"
+	default:
+		return "start_at", "end_at"
+	}
+}
+
+// zoneKey names the property holding the zone of a time property, such as
+// depart_zone for depart_at
+func zoneKey(timeKey string) string {
+	return strings.TrimSuffix(timeKey, "_at") + "_zone"
+}
+
+// floatingLayout stores FloatingZone times, which have no offset
+const floatingLayout = "2006-01-02T15:04:05"
+
+// formatTime formats a reservation time keeping its UTC offset, or as the
+// bare wall clock time when it is floating
+func formatTime(t time.Time, zone string) string {
+	switch {
+	case t.IsZero():
+		return ""
+	case zone == FloatingZone:
+		return t.Format(floatingLayout)
+	}
+	return t.Format(time.RFC3339)
+}
+
+// parseStored parses a time written by formatTime in the zone stored along
+// with it
+func parseStored(value string, zone string) time.Time {
+	if zone == FloatingZone {
+		t, err := time.Parse(floatingLayout, value)
+		if err != nil {
+			return time.Time{}
+		}
+		return t
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	if loc := loadZone(zone); loc != nil {
+		t = t.In(loc)
+	}
+	return t
+}
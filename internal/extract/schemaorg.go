@@ -0,0 +1,243 @@
+package extract
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// SchemaOrgParser extracts schema.org FlightReservation and LodgingReservation
+// markup, which most airlines and hotel chains embed in their confirmation
+// emails as JSON-LD
+type SchemaOrgParser struct{}
+
+// Name identifies the parser
+func (p *SchemaOrgParser) Name() string {
+	return "schema.org"
+}
+
+// Parse returns the reservations described by the message's JSON-LD blocks
+func (p *SchemaOrgParser) Parse(msg *Message) ([]Reservation, error) {
+	var reservations []Reservation
+
+	for _, doc := range msg.JSONLD {
+		var v interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(doc)), &v); err != nil {
+			// Broken markup in one block should not hide the others
+			continue
+		}
+
+		for _, node := range flattenNodes(v) {
+			switch schemaType(node) {
+			case "FlightReservation":
+				if res, ok := parseFlight(node); ok {
+					reservations = append(reservations, res)
+				}
+			case "LodgingReservation":
+				if res, ok := parseLodging(node); ok {
+					reservations = append(reservations, res)
+				}
+			}
+		}
+	}
+
+	return reservations, nil
+}
+
+// parseFlight maps a FlightReservation node to a Reservation
+func parseFlight(node map[string]interface{}) (Reservation, bool) {
+	flight := object(node, "reservationFor")
+	if flight == nil {
+		return Reservation{}, false
+	}
+
+	departure := object(flight, "departureAirport")
+	arrival := object(flight, "arrivalAirport")
+	res := Reservation{
+		Type:         TypeFlight,
+		Confirmation: text(node, "reservationNumber"),
+		Status:       status(node),
+		Provider:     text(object(flight, "airline"), "name"),
+		Origin:       airport(departure),
+		Destination:  airport(arrival),
+	}
+	res.StartAt, res.StartZone = parseTime(text(flight, "departureTime"), venueZone(departure))
+	res.EndAt, res.EndZone = parseTime(text(flight, "arrivalTime"), venueZone(arrival))
+
+	res.Name = text(flight, "flightNumber")
+	if code := text(object(flight, "airline"), "iataCode"); code != "" && !strings.HasPrefix(res.Name, code) {
+		res.Name = strings.TrimSpace(code + " " + res.Name)
+	}
+
+	return res, !res.StartAt.IsZero()
+}
+
+// parseLodging maps a LodgingReservation node to a Reservation
+func parseLodging(node map[string]interface{}) (Reservation, bool) {
+	hotel := object(node, "reservationFor")
+
+	res := Reservation{
+		Type:         TypeHotel,
+		Confirmation: text(node, "reservationNumber"),
+		Status:       status(node),
+		Provider:     text(hotel, "name"),
+		Name:         text(hotel, "name"),
+	}
+	zone := venueZone(hotel)
+	res.StartAt, res.StartZone = parseDay(firstOf(text(node, "checkinTime"), text(node, "checkinDate")), 15, zone)
+	res.EndAt, res.EndZone = parseDay(firstOf(text(node, "checkoutTime"), text(node, "checkoutDate")), 11, zone)
+	if brand := text(object(hotel, "brand"), "name"); brand != "" {
+		res.Provider = brand
+	}
+
+	return res, !res.StartAt.IsZero()
+}
+
+// status normalizes schema.org reservation statuses
+func status(node map[string]interface{}) string {
+	s := text(node, "reservationStatus")
+	if strings.HasSuffix(s, "ReservationCancelled") {
+		return StatusCancelled
+	}
+	return StatusConfirmed
+}
+
+// airport returns the IATA code of an airport node, or its name
+func airport(node map[string]interface{}) string {
+	return firstOf(text(node, "iataCode"), text(node, "name"))
+}
+
+// offsetLayouts are the ISO 8601 forms with a UTC offset found in the
+// wild, most specific first
+var offsetLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04Z07:00",
+}
+
+// localLayouts are the forms without an offset, which read as the wall
+// clock at the venue
+var localLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseTime parses an ISO 8601 timestamp at a venue in zone loc, which is
+// nil when unknown, and returns it with the name of its zone for
+// Reservation.StartZone or EndZone. A time with a UTC offset keeps it, or
+// is moved into loc when known. A time without one is the venue's wall
+// clock: it is read in loc when known, and kept as a FloatingZone time
+// otherwise, as the zone of the server says nothing about the venue.
+func parseTime(value string, loc *time.Location) (time.Time, string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, ""
+	}
+
+	for _, layout := range offsetLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			if loc == nil {
+				return t, ""
+			}
+			return t.In(loc), loc.String()
+		}
+	}
+	for _, layout := range localLayouts {
+		if loc == nil {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t, FloatingZone
+			}
+		} else if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, loc.String()
+		}
+	}
+	return time.Time{}, ""
+}
+
+// parseDay parses a check-in or check-out time. Hotels often only give the
+// date, in which case the customary local hour is assumed.
+func parseDay(value string, hour int, loc *time.Location) (time.Time, string) {
+	t, zone := parseTime(value, loc)
+	if len(strings.TrimSpace(value)) == len("2006-01-02") && !t.IsZero() {
+		t = time.Date(t.Year(), t.Month(), t.Day(), hour, 0, 0, 0, t.Location())
+	}
+	return t, zone
+}
+
+// flattenNodes returns every object in a JSON-LD document, unwrapping
+// arrays and @graph containers
+func flattenNodes(v interface{}) []map[string]interface{} {
+	switch n := v.(type) {
+	case []interface{}:
+		var nodes []map[string]interface{}
+		for _, item := range n {
+			nodes = append(nodes, flattenNodes(item)...)
+		}
+		return nodes
+	case map[string]interface{}:
+		if graph, ok := n["@graph"]; ok {
+			return flattenNodes(graph)
+		}
+		return []map[string]interface{}{n}
+	}
+	return nil
+}
+
+// schemaType returns the unqualified @type of a node
+func schemaType(node map[string]interface{}) string {
+	t := text(node, "@type")
+	if i := strings.LastIndex(t, "/"); i >= 0 {
+		t = t[i+1:]
+	}
+	return t
+}
+
+// object returns a nested object property, or nil
+func object(node map[string]interface{}, key string) map[string]interface{} {
+	if node == nil {
+		return nil
+	}
+	switch v := node[key].(type) {
+	case map[string]interface{}:
+		return v
+	case []interface{}:
+		if len(v) > 0 {
+			if m, ok := v[0].(map[string]interface{}); ok {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// text returns a string property, or the @id or name of an object value
+func text(node map[string]interface{}, key string) string {
+	if node == nil {
+		return ""
+	}
+	switch v := node[key].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case []interface{}:
+		if len(v) > 0 {
+			if s, ok := v[0].(string); ok {
+				return strings.TrimSpace(s)
+			}
+		}
+	case map[string]interface{}:
+		return firstOf(text(v, "@id"), text(v, "name"))
+	}
+	return ""
+}
+
+// firstOf returns the first non-empty value
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
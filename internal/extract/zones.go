@@ -0,0 +1,140 @@
+package extract
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	// Venue zones must resolve even where the host has no zoneinfo
+	_ "time/tzdata"
+)
+
+// FloatingZone marks a reservation time given without a UTC offset at a
+// venue whose time zone is unknown. Such a time holds the venue's wall clock
+// reading, stored as if it were UTC.
+const FloatingZone = "floating"
+
+// airportZones maps the IATA codes of the busiest airports to their IANA
+// time zone
+var airportZones = map[string]string{
+	// North America
+	"ATL": "America/New_York", "BOS": "America/New_York", "BWI": "America/New_York",
+	"CLT": "America/New_York", "DCA": "America/New_York", "DTW": "America/Detroit",
+	"EWR": "America/New_York", "FLL": "America/New_York", "IAD": "America/New_York",
+	"JFK": "America/New_York", "LGA": "America/New_York", "MCO": "America/New_York",
+	"MIA": "America/New_York", "PHL": "America/New_York", "TPA": "America/New_York",
+	"AUS": "America/Chicago", "BNA": "America/Chicago", "DFW": "America/Chicago",
+	"IAH": "America/Chicago", "HOU": "America/Chicago", "MDW": "America/Chicago",
+	"MSP": "America/Chicago", "MSY": "America/Chicago", "ORD": "America/Chicago",
+	"STL": "America/Chicago", "DEN": "America/Denver", "SLC": "America/Denver",
+	"PHX": "America/Phoenix", "LAS": "America/Los_Angeles", "LAX": "America/Los_Angeles",
+	"OAK": "America/Los_Angeles", "PDX": "America/Los_Angeles", "SAN": "America/Los_Angeles",
+	"SEA": "America/Los_Angeles", "SFO": "America/Los_Angeles", "SJC": "America/Los_Angeles",
+	"SMF": "America/Los_Angeles", "ANC": "America/Anchorage", "HNL": "Pacific/Honolulu",
+	"OGG": "Pacific/Honolulu", "YUL": "America/Toronto", "YYZ": "America/Toronto",
+	"YOW": "America/Toronto", "YYC": "America/Edmonton", "YEG": "America/Edmonton",
+	"YVR": "America/Vancouver", "MEX": "America/Mexico_City", "CUN": "America/Cancun",
+	"GDL": "America/Mexico_City", "SJD": "America/Mazatlan",
+
+	// Central and South America, Caribbean
+	"BOG": "America/Bogota", "EZE": "America/Argentina/Buenos_Aires", "GIG": "America/Sao_Paulo",
+	"GRU": "America/Sao_Paulo", "LIM": "America/Lima", "PTY": "America/Panama",
+	"SCL": "America/Santiago", "SJO": "America/Costa_Rica", "SJU": "America/Puerto_Rico",
+	"NAS": "America/Nassau", "MBJ": "America/Jamaica", "PUJ": "America/Santo_Domingo",
+
+	// Europe
+	"AMS": "Europe/Amsterdam", "ARN": "Europe/Stockholm", "ATH": "Europe/Athens",
+	"BCN": "Europe/Madrid", "BER": "Europe/Berlin", "BRU": "Europe/Brussels",
+	"BUD": "Europe/Budapest", "CDG": "Europe/Paris", "CPH": "Europe/Copenhagen",
+	"DUB": "Europe/Dublin", "DUS": "Europe/Berlin", "EDI": "Europe/London",
+	"FCO": "Europe/Rome", "FRA": "Europe/Berlin", "GVA": "Europe/Zurich",
+	"HAM": "Europe/Berlin", "HEL": "Europe/Helsinki", "IST": "Europe/Istanbul",
+	"KEF": "Atlantic/Reykjavik", "LGW": "Europe/London", "LHR": "Europe/London",
+	"LIS": "Europe/Lisbon", "LTN": "Europe/London", "MAD": "Europe/Madrid",
+	"MAN": "Europe/London", "MUC": "Europe/Berlin", "MXP": "Europe/Rome",
+	"NCE": "Europe/Paris", "ORY": "Europe/Paris", "OSL": "Europe/Oslo",
+	"PMI": "Europe/Madrid", "PRG": "Europe/Prague", "SAW": "Europe/Istanbul",
+	"STN": "Europe/London", "VIE": "Europe/Vienna", "WAW": "Europe/Warsaw",
+	"ZRH": "Europe/Zurich",
+
+	// Africa and the Middle East
+	"ADD": "Africa/Addis_Ababa", "CAI": "Africa/Cairo", "CMN": "Africa/Casablanca",
+	"CPT": "Africa/Johannesburg", "JNB": "Africa/Johannesburg", "LOS": "Africa/Lagos",
+	"NBO": "Africa/Nairobi", "AUH": "Asia/Dubai", "DOH": "Asia/Qatar",
+	"DXB": "Asia/Dubai", "JED": "Asia/Riyadh", "RUH": "Asia/Riyadh",
+	"TLV": "Asia/Jerusalem", "AMM": "Asia/Amman",
+
+	// Asia and Oceania
+	"BKK": "Asia/Bangkok", "BLR": "Asia/Kolkata", "BOM": "Asia/Kolkata",
+	"CAN": "Asia/Shanghai", "CGK": "Asia/Jakarta", "CTU": "Asia/Shanghai",
+	"DEL": "Asia/Kolkata", "DPS": "Asia/Makassar", "HAN": "Asia/Ho_Chi_Minh",
+	"HKG": "Asia/Hong_Kong", "HND": "Asia/Tokyo", "ICN": "Asia/Seoul",
+	"KIX": "Asia/Tokyo", "KUL": "Asia/Kuala_Lumpur", "MNL": "Asia/Manila",
+	"NRT": "Asia/Tokyo", "PEK": "Asia/Shanghai", "PKX": "Asia/Shanghai",
+	"PVG": "Asia/Shanghai", "SGN": "Asia/Ho_Chi_Minh", "SIN": "Asia/Singapore",
+	"SZX": "Asia/Shanghai", "TPE": "Asia/Taipei", "AKL": "Pacific/Auckland",
+	"BNE": "Australia/Brisbane", "MEL": "Australia/Melbourne", "PER": "Australia/Perth",
+	"SYD": "Australia/Sydney", "NAN": "Pacific/Fiji",
+}
+
+// countryZones maps the ISO 3166 codes of countries spanning a single time
+// zone to it. Countries with several zones are left out, as the country
+// alone does not tell which applies.
+var countryZones = map[string]string{
+	"AE": "Asia/Dubai", "AR": "America/Argentina/Buenos_Aires", "AT": "Europe/Vienna",
+	"BE": "Europe/Brussels", "BG": "Europe/Sofia", "CH": "Europe/Zurich",
+	"CN": "Asia/Shanghai", "CO": "America/Bogota", "CR": "America/Costa_Rica",
+	"CZ": "Europe/Prague", "DE": "Europe/Berlin", "DK": "Europe/Copenhagen",
+	"EG": "Africa/Cairo", "FI": "Europe/Helsinki", "FR": "Europe/Paris",
+	"GB": "Europe/London", "GR": "Europe/Athens", "HK": "Asia/Hong_Kong",
+	"HR": "Europe/Zagreb", "HU": "Europe/Budapest", "IE": "Europe/Dublin",
+	"IL": "Asia/Jerusalem", "IN": "Asia/Kolkata", "IS": "Atlantic/Reykjavik",
+	"IT": "Europe/Rome", "JP": "Asia/Tokyo", "KE": "Africa/Nairobi",
+	"KR": "Asia/Seoul", "MA": "Africa/Casablanca", "MY": "Asia/Kuala_Lumpur",
+	"NL": "Europe/Amsterdam", "NO": "Europe/Oslo", "PE": "America/Lima",
+	"PH": "Asia/Manila", "PL": "Europe/Warsaw", "QA": "Asia/Qatar",
+	"RO": "Europe/Bucharest", "SA": "Asia/Riyadh", "SE": "Europe/Stockholm",
+	"SG": "Asia/Singapore", "TH": "Asia/Bangkok", "TR": "Europe/Istanbul",
+	"TW": "Asia/Taipei", "VN": "Asia/Ho_Chi_Minh", "ZA": "Africa/Johannesburg",
+}
+
+// locations caches the zones loaded so far
+var locations sync.Map
+
+// loadZone returns the location of an IANA zone name, or nil
+func loadZone(name string) *time.Location {
+	if name == "" || name == FloatingZone {
+		return nil
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+	locations.Store(name, loc)
+	return loc
+}
+
+// venueZone returns the time zone of a schema.org Airport or LodgingBusiness
+// node, from its IATA code or the country of its address, or nil when it
+// cannot be told
+func venueZone(node map[string]interface{}) *time.Location {
+	if node == nil {
+		return nil
+	}
+	if zone, ok := airportZones[strings.ToUpper(text(node, "iataCode"))]; ok {
+		return loadZone(zone)
+	}
+
+	address := object(node, "address")
+	country := text(address, "addressCountry")
+	if len(country) != 2 {
+		country = text(object(address, "addressCountry"), "identifier")
+	}
+	if zone, ok := countryZones[strings.ToUpper(country)]; ok {
+		return loadZone(zone)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Package logging sets up the log/slog logger shared by the API, the
+// background workers and the command line tool. Attributes added to a
+// context with With, such as the request ID, are logged with every record
+// logged through that context, so the logs of a request, a sync or a reindex
+// job can be followed into the store.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Output formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Options configures the logger
+type Options struct {
+	// Level is the minimum level logged
+	Level slog.Level
+	// Format is FormatJSON or FormatText
+	Format string
+	// Redact is the redaction policy, one of the Redact constants
+	Redact string
+}
+
+// ParseLevel parses debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return level, nil
+}
+
+// New returns a logger writing to w
+func New(w io.Writer, opts Options) *slog.Logger {
+	handlerOpts := &slog.HandlerOptions{
+		Level:       opts.Level,
+		ReplaceAttr: redactor(opts.Redact),
+	}
+
+	var h slog.Handler
+	if strings.EqualFold(opts.Format, FormatText) {
+		h = slog.NewTextHandler(w, handlerOpts)
+	} else {
+		h = slog.NewJSONHandler(w, handlerOpts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+// Setup makes a logger writing to w the default, which also routes the
+// standard log package through it
+func Setup(w io.Writer, opts Options) {
+	slog.SetDefault(New(w, opts))
+}
+
+// contextKey is the context key of the attributes added by With
+type contextKey struct{}
+
+// With returns a copy of ctx carrying attributes logged with every record
+// logged through it. args are key-value pairs or slog.Attrs, as for
+// slog.Logger.With.
+func With(ctx context.Context, args ...any) context.Context {
+	attrs := append([]slog.Attr{}, attrsFrom(ctx)...)
+	r := slog.Record{}
+	r.Add(args...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, contextKey{}, attrs)
+}
+
+// attrsFrom returns the attributes added to ctx by With
+func attrsFrom(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	return attrs
+}
+
+// contextHandler adds the attributes of the record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle adds the context attributes to r and passes it on
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs := attrsFrom(ctx); len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs keeps the context attributes on loggers made with Logger.With
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup keeps the context attributes on loggers made with
+// Logger.WithGroup
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
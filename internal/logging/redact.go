@@ -0,0 +1,161 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redaction policies
+const (
+	// RedactNone logs queries and email addresses as they are
+	RedactNone = "none"
+	// RedactEmails hides the local part of email addresses
+	RedactEmails = "emails"
+	// RedactQueries hides email addresses and the terms of logged queries,
+	// except for the fields in SafeFields
+	RedactQueries = "queries"
+)
+
+// Redacted replaces hidden values
+const Redacted = "[redacted]"
+
+// SafeFields are the query fields whose values are logged under
+// RedactQueries: they name tags, dates and mail folders rather than what
+// the mail says or who sent it
+var SafeFields = map[string]bool{
+	"tag":      true,
+	"is":       true,
+	"date":     true,
+	"lastmod":  true,
+	"mimetype": true,
+	"id":       true,
+	"mid":      true,
+	"thread":   true,
+	"folder":   true,
+	"path":     true,
+	"query":    true,
+	"property": true,
+}
+
+// queryOperators are the bare words of a query kept under RedactQueries
+var queryOperators = map[string]bool{
+	"and": true, "or": true, "not": true, "xor": true, "near": true, "adj": true, "*": true,
+}
+
+// sexpHeads are the operators and fields opening an s-expression. Any
+// other word after a parenthesis is the first term of a Xapian group.
+var sexpHeads = map[string]bool{
+	"and": true, "or": true, "not": true, "of": true, "matching": true, "query": true,
+	"infix": true, "regex": true, "rx": true, "starts-with": true, "macro": true,
+	"attachment": true, "body": true, "date": true, "from": true, "folder": true,
+	"id": true, "is": true, "lastmod": true, "mid": true, "mimetype": true,
+	"path": true, "property": true, "subject": true, "tag": true, "thread": true,
+	"to": true,
+}
+
+// Attributes holding notmuch queries, and ones never redacted
+var (
+	queryKeys     = map[string]bool{"query": true, "filter": true}
+	preservedKeys = map[string]bool{"message_id": true, "thread_id": true}
+)
+
+// redactor returns the slog.HandlerOptions.ReplaceAttr function applying
+// policy, or nil when nothing is redacted
+func redactor(policy string) func(groups []string, a slog.Attr) slog.Attr {
+	if policy == RedactNone {
+		return nil
+	}
+
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if preservedKeys[a.Key] {
+			return a
+		}
+		if policy == RedactQueries && queryKeys[a.Key] && a.Value.Kind() == slog.KindString {
+			return slog.String(a.Key, MaskQuery(a.Value.String()))
+		}
+
+		switch a.Value.Kind() {
+		case slog.KindString:
+			return slog.String(a.Key, MaskEmails(a.Value.String()))
+		case slog.KindAny:
+			if err, ok := a.Value.Any().(error); ok {
+				return slog.String(a.Key, MaskEmails(err.Error()))
+			}
+		}
+		return a
+	}
+}
+
+// emailPattern matches email addresses, capturing the domain
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@([A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)+)`)
+
+// MaskEmails hides the local part of every email address in s, keeping
+// the domain so the provider is still known
+func MaskEmails(s string) string {
+	return emailPattern.ReplaceAllString(s, Redacted+"@$1")
+}
+
+// queryToken matches a parenthesis, or a term with an optional field prefix
+var queryToken = regexp.MustCompile(`[()]|([A-Za-z_][\w-]*:)?("(?:[^"\\]|\\.)*"|[^\s()"]+)`)
+
+// MaskQuery hides the terms of a Xapian or s-expression query, keeping its
+// structure: operators, field names and the values of SafeFields
+func MaskQuery(q string) string {
+	var b strings.Builder
+	// heads holds the operator or field of every open s-expression
+	var heads []string
+	head := false
+	last := 0
+
+	for _, m := range queryToken.FindAllStringSubmatchIndex(q, -1) {
+		b.WriteString(q[last:m[0]])
+		last = m[1]
+		token := q[m[0]:m[1]]
+
+		switch {
+		case token == "(":
+			head = true
+			heads = append(heads, "")
+			b.WriteString(token)
+			continue
+		case token == ")":
+			head = false
+			if len(heads) > 0 {
+				heads = heads[:len(heads)-1]
+			}
+			b.WriteString(token)
+			continue
+		case head:
+			// The first word of an s-expression is its operator or field
+			head = false
+			if word := strings.ToLower(token); sexpHeads[word] {
+				heads[len(heads)-1] = word
+				b.WriteString(token)
+				continue
+			}
+		}
+
+		prefix := ""
+		if m[2] >= 0 {
+			prefix = q[m[2]:m[3]]
+		}
+		value := q[m[4]:m[5]]
+		field := strings.TrimSuffix(prefix, ":")
+		if field == "" && len(heads) > 0 {
+			field = heads[len(heads)-1]
+		}
+
+		switch {
+		case SafeFields[strings.ToLower(field)]:
+			b.WriteString(token)
+		case prefix == "" && queryOperators[strings.ToLower(value)]:
+			b.WriteString(token)
+		default:
+			b.WriteString(prefix + Redacted)
+		}
+	}
+	b.WriteString(q[last:])
+
+	return b.String()
+}
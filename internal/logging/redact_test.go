@@ -0,0 +1,59 @@
+package logging
+
+import "testing"
+
+func TestMaskQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"bare term", "lisbon", Redacted},
+		{"address", "from:alice@example.com and tag:travel", "from:" + Redacted + " and tag:travel"},
+		{"safe fields", "tag:travel and date:2024-05..2024-06 and folder:Travel", "tag:travel and date:2024-05..2024-06 and folder:Travel"},
+		{"field case", "Tag:travel OR Subject:hotel", "Tag:travel OR Subject:" + Redacted},
+		{"message id", "id:123@example.com", "id:123@example.com"},
+		{"quoted phrase", `"booking confirmed"`, Redacted},
+		{"quoted field value", `subject:"flight to Lisbon" or tag:flight`, "subject:" + Redacted + " or tag:flight"},
+		{"quoted safe value", `folder:"Travel/Bookings 2024"`, `folder:"Travel/Bookings 2024"`},
+		{"escaped quote", `subject:"the \"grand\" hotel"`, "subject:" + Redacted},
+		{"operators", "not tag:spam and (hotel or flight)", "not tag:spam and (" + Redacted + " or " + Redacted + ")"},
+		{"proximity", "lisbon near hotel", Redacted + " near " + Redacted},
+		{"wildcard", "*", "*"},
+		{"grouping", "(from:united.com or from:delta.com) and not tag:spam", "(from:" + Redacted + " or from:" + Redacted + ") and not tag:spam"},
+		{"group", "(lisbon)", "(" + Redacted + ")"},
+		{"sexp", "(and (tag travel) (from alice))", "(and (tag travel) (from " + Redacted + "))"},
+		{"sexp phrase", `(or (subject "hotel booking") (tag hotel))`, "(or (subject " + Redacted + ") (tag hotel))"},
+		{"sexp bare term", "(and lisbon (not (tag spam)))", "(and " + Redacted + " (not (tag spam)))"},
+		{"sexp date", "(date 2024-05 2024-06)", "(date 2024-05 2024-06)"},
+		{"sexp prefix", "(and from:alice (tag travel))", "(and from:" + Redacted + " (tag travel))"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaskQuery(tt.query); got != tt.want {
+				t.Errorf("MaskQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaskEmails(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"no address here", "no address here"},
+		{"alice@example.com", Redacted + "@example.com"},
+		{"From: Bob <bob.smith+travel@mail.example.co.uk>", "From: Bob <" + Redacted + "@mail.example.co.uk>"},
+		{"a@example.com, b@example.org", Redacted + "@example.com, " + Redacted + "@example.org"},
+		{"from:alice@example.com and tag:travel", "from:" + Redacted + "@example.com and tag:travel"},
+		{"user@localhost", "user@localhost"},
+	}
+	for _, tt := range tests {
+		if got := MaskEmails(tt.in); got != tt.want {
+			t.Errorf("MaskEmails(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package mailsync
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zachatrocity/voyage/internal/events"
+	"github.com/zachatrocity/voyage/internal/extract"
+	"github.com/zachatrocity/voyage/internal/logging"
+	"github.com/zachatrocity/voyage/internal/metrics"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+)
+
+// Result is the outcome of a sync
+// @Description Outcome of syncing the database with the mail directory
+type Result struct {
+	notmuch.SyncReport
+	// Reservations counts the reservations extracted from new emails
+	Reservations int `json:"reservations" example:"2"`
+	// Failed counts the new emails whose reservations could not be extracted
+	Failed int `json:"failed" example:"0"`
+}
+
+// Sync indexes new mail with newTags, drops deleted files and, when
+// extractNew is set, extracts and stores the reservations of the new emails.
+// Once ctx is done no more files are indexed.
+func Sync(ctx context.Context, newTags []string, extractNew bool) (*Result, error) {
+	start := time.Now()
+	result, err := run(ctx, newTags, extractNew)
+	metrics.SyncDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.SyncRuns.WithLabelValues(metrics.ResultFailure).Inc()
+		return nil, err
+	}
+
+	metrics.SyncRuns.WithLabelValues(metrics.ResultSuccess).Inc()
+	metrics.SyncMessages.WithLabelValues("added").Add(float64(len(result.Added)))
+	metrics.SyncMessages.WithLabelValues("removed").Add(float64(result.Removed))
+	return result, nil
+}
+
+// run syncs without recording metrics
+func run(ctx context.Context, newTags []string, extractNew bool) (*Result, error) {
+	report, err := notmuch.Sync(ctx, newTags)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{SyncReport: *report}
+	if !extractNew {
+		return result, nil
+	}
+
+	gauge := metrics.Pending.WithLabelValues(metrics.QueueExtract)
+	gauge.Set(float64(len(report.Added)))
+	pending.Store(int64(len(report.Added)))
+	defer func() {
+		gauge.Set(0)
+		pending.Store(0)
+	}()
+	for _, messageID := range report.Added {
+		reservations, err := extractMessage(messageID)
+		gauge.Dec()
+		pending.Add(-1)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to extract reservations", "message_id", messageID, "error", err)
+			result.Failed++
+			continue
+		}
+		slog.DebugContext(ctx, "Extracted reservations", "message_id", messageID, "reservations", len(reservations))
+		result.Reservations += len(reservations)
+		for _, r := range reservations {
+			publishReservation(r)
+		}
+	}
+
+	return result, nil
+}
+
+// pending counts the new emails of the running sync awaiting extraction
+var pending atomic.Int64
+
+// Pending returns the number of new emails a running sync has yet to
+// extract reservations from
+func Pending() int {
+	return int(pending.Load())
+}
+
+// extractMessage extracts and stores the reservations of a single email
+func extractMessage(messageID string) ([]extract.Reservation, error) {
+	email, err := notmuch.GetEmail(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	reservations, err := extract.FromFile(email.MessageID, email.Filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := extract.Store(email.MessageID, reservations); err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+// publishReservation publishes a reservation found in new mail, so
+// webhooks can announce new flights and stays
+func publishReservation(r extract.Reservation) {
+	data := map[string]interface{}{
+		"type":         r.Type,
+		"parser":       r.Parser,
+		"confirmation": r.Confirmation,
+		"status":       r.Status,
+		"provider":     r.Provider,
+		"name":         r.Name,
+		"origin":       r.Origin,
+		"destination":  r.Destination,
+		"start_zone":   r.StartZone,
+		"end_zone":     r.EndZone,
+	}
+	if !r.StartAt.IsZero() {
+		data["start_at"] = r.StartAt.Format(time.RFC3339)
+	}
+	if !r.EndAt.IsZero() {
+		data["end_at"] = r.EndAt.Format(time.RFC3339)
+	}
+	events.Publish(events.Event{
+		Type:      events.TypeReservationExtracted,
+		MessageID: r.MessageID,
+		Data:      data,
+	})
+}
+
+// Scheduler syncs the database every Interval and remembers the last run
+type Scheduler struct {
+	Interval time.Duration
+	NewTags  []string
+	// Extract extracts the reservations of new emails
+	Extract bool
+
+	mu      sync.Mutex
+	lastRun time.Time
+	last    *Result
+	lastErr error
+}
+
+// Run syncs every Interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		// Everything logged by the run carries its ID
+		runCtx := logging.With(ctx, "sync_id", events.NewID())
+		start := time.Now()
+		result, err := Sync(runCtx, s.NewTags, s.Extract)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(runCtx, "Mail sync failed", "error", err)
+		} else {
+			slog.InfoContext(runCtx, "Mail sync finished", "added", len(result.Added), "removed", result.Removed, "unreadable", result.Unreadable,
+				"reservations", result.Reservations, "failed", result.Failed, "duration", time.Since(start).String())
+		}
+
+		s.mu.Lock()
+		s.lastRun, s.last, s.lastErr = start, result, err
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Last returns the time, result and error of the last sync. The time is
+// zero before the first sync.
+func (s *Scheduler) Last() (time.Time, *Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastRun, s.last, s.lastErr
+}
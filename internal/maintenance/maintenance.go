@@ -0,0 +1,174 @@
+package maintenance
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/zachatrocity/voyage/internal/events"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+)
+
+// Operation statuses
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// maxMessages bounds the compaction messages kept on an operation
+const maxMessages = 20
+
+// ErrBusy is returned when starting an operation while another one runs
+var ErrBusy = errors.New("a maintenance operation is already running")
+
+// Operation is a background upgrade or compaction of the database
+// @Description Database maintenance operation
+type Operation struct {
+	ID     string `json:"id" example:"6f1c2a9e4b7d3e10"`
+	Type   string `json:"type" example:"compact"`
+	Status string `json:"status" example:"running"`
+	// Progress runs from 0 to 1 during an upgrade
+	Progress float64 `json:"progress" example:"0.5"`
+	// Messages are the latest status messages reported by the compaction
+	Messages []string `json:"messages,omitempty" example:"copying document 1000"`
+	// BackupPath is where a compaction moved the original database
+	BackupPath string `json:"backup_path,omitempty" example:"/mail/.notmuch/backups/xapian-20230101T120000"`
+	// Upgraded reports whether an upgrade was needed
+	Upgraded   bool       `json:"upgraded,omitempty" example:"true"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at" example:"2023-01-01T12:00:00Z"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" example:"2023-01-01T12:03:00Z"`
+}
+
+// Runner runs one maintenance operation at a time in the background and
+// remembers the last one
+type Runner struct {
+	// BackupDir receives the original database on every compaction. It must
+	// be on the same file system as the database.
+	BackupDir string
+
+	mu   sync.Mutex
+	last *Operation
+	wg   sync.WaitGroup
+}
+
+// NewRunner creates a runner keeping backups in dir, by default
+// <notmuch database>/.notmuch/backups
+func NewRunner(dir string) *Runner {
+	if dir == "" {
+		dir = filepath.Join(notmuch.GetDatabasePath(), ".notmuch", "backups")
+	}
+	return &Runner{BackupDir: dir}
+}
+
+// Last returns the running or most recently finished operation
+func (r *Runner) Last() (Operation, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.last == nil {
+		return Operation{}, false
+	}
+	return r.copy(r.last), true
+}
+
+// Wait blocks until the running operation, if any, has finished. Upgrades
+// and compactions can not be interrupted, so a stopping server waits for them.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+// Upgrade starts upgrading the database to the latest version supported by
+// libnotmuch
+func (r *Runner) Upgrade() (Operation, error) {
+	return r.start(notmuch.MaintenanceUpgrade, func(op *Operation) error {
+		upgraded, err := notmuch.Upgrade(func(progress float64) {
+			r.mu.Lock()
+			op.Progress = progress
+			r.mu.Unlock()
+		})
+		r.mu.Lock()
+		op.Upgraded = upgraded
+		r.mu.Unlock()
+		return err
+	})
+}
+
+// Compact starts compacting the database, moving the original into a new
+// timestamped directory below BackupDir
+func (r *Runner) Compact() (Operation, error) {
+	if err := os.MkdirAll(r.BackupDir, 0o700); err != nil {
+		return Operation{}, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	backupPath := filepath.Join(r.BackupDir, "xapian-"+time.Now().UTC().Format("20060102T150405"))
+
+	return r.start(notmuch.MaintenanceCompact, func(op *Operation) error {
+		r.mu.Lock()
+		op.BackupPath = backupPath
+		r.mu.Unlock()
+
+		return notmuch.Compact(backupPath, func(message string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			op.Messages = append(op.Messages, message)
+			if len(op.Messages) > maxMessages {
+				op.Messages = op.Messages[len(op.Messages)-maxMessages:]
+			}
+		})
+	})
+}
+
+// start runs fn in the background as a new operation of the given type
+func (r *Runner) start(opType string, fn func(op *Operation) error) (Operation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.last != nil && r.last.Status == StatusRunning {
+		return Operation{}, ErrBusy
+	}
+
+	op := &Operation{
+		ID:        events.NewID(),
+		Type:      opType,
+		Status:    StatusRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	r.last = op
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		err := fn(op)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		now := time.Now().UTC()
+		op.FinishedAt = &now
+		if err != nil {
+			op.Status = StatusFailed
+			op.Error = err.Error()
+			slog.Error("Database maintenance failed", "operation", op.Type, "id", op.ID, "error", err)
+			return
+		}
+		op.Status = StatusCompleted
+		if op.Type == notmuch.MaintenanceUpgrade {
+			op.Progress = 1
+		}
+		slog.Info("Database maintenance completed", "operation", op.Type, "id", op.ID)
+	}()
+
+	return r.copy(op), nil
+}
+
+// copy returns a snapshot of op that is safe to use without the lock
+func (r *Runner) copy(op *Operation) Operation {
+	c := *op
+	c.Messages = append([]string(nil), op.Messages...)
+	return c
+}
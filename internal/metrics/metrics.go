@@ -0,0 +1,114 @@
+// Package metrics holds the Prometheus metrics Voyage exports on /metrics
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// namespace prefixes every metric name
+const namespace = "voyage"
+
+// Results of sync runs and extractions
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	// ResultNone is an extraction that ran but found no reservation
+	ResultNone = "none"
+)
+
+// Queues of messages awaiting processing
+const (
+	QueueExtract = "extract"
+	QueueReindex = "reindex"
+)
+
+var (
+	// Requests counts HTTP requests by method, route and status code
+	Requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	// RequestDuration observes the time spent serving HTTP requests
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time spent serving HTTP requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// SearchResults observes the number of messages matching each search;
+	// streamed searches report the messages they sent instead
+	SearchResults = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "search_results",
+		Help:      "Number of messages matching a search, or sent by a streamed search.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	})
+
+	// DatabaseOpenDuration observes the time taken to open the database, by
+	// mode
+	DatabaseOpenDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "database_open_duration_seconds",
+		Help:      "Time taken to open the notmuch database by mode.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 4, 8),
+	}, []string{"mode"})
+
+	// DatabaseQueryDuration observes the time taken to run a query and
+	// collect its results, by operation
+	DatabaseQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "database_query_duration_seconds",
+		Help:      "Time taken to run a notmuch query and collect its results by operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"operation"})
+
+	// TagMutations counts tags added to and removed from messages
+	TagMutations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tag_mutations_total",
+		Help:      "Tags added to or removed from messages.",
+	}, []string{"action"})
+
+	// SyncRuns counts syncs of the database with the mail directory by
+	// result
+	SyncRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sync_runs_total",
+		Help:      "Syncs of the database with the mail directory by result.",
+	}, []string{"result"})
+
+	// SyncDuration observes the time taken by syncs, extraction included
+	SyncDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sync_duration_seconds",
+		Help:      "Time taken to sync the database with the mail directory.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 3, 8),
+	})
+
+	// SyncMessages counts the messages syncs added and removed
+	SyncMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sync_messages_total",
+		Help:      "Messages added to or removed from the database by syncs.",
+	}, []string{"action"})
+
+	// Extractions counts the runs of every parser over an email by result:
+	// success when it found reservations, none when it found nothing and
+	// failure when it failed
+	Extractions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "extractions_total",
+		Help:      "Runs of a reservation parser over an email by parser and result.",
+	}, []string{"parser", "result"})
+
+	// Pending is the number of messages awaiting processing, by queue
+	Pending = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "messages_pending",
+		Help:      "Messages awaiting reservation extraction or reindexing by queue.",
+	}, []string{"queue"})
+)
@@ -0,0 +1,125 @@
+package notmuch
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/zachatrocity/voyage/internal/metrics"
+	"github.com/zachatrocity/voyage/notmuch"
+)
+
+// Tx gives a WithAtomic function write access to the database
+type Tx struct {
+	db *notmuch.Database
+	// retagged lists the messages whose Maildir flags are synced once the
+	// transaction commits
+	retagged []string
+}
+
+// WithAtomic opens the database for writing and runs fn inside an atomic
+// section. The changes made by fn are committed together when it returns
+// nil. When fn returns an error or panics the section is left open, so
+// closing the database discards every change fn made. Once committed the
+// changes are durable, so renaming Maildir files afterwards can only fail
+// with a warning in the log; the flags catch up the next time the message
+// is retagged.
+func WithAtomic(fn func(tx *Tx) error) error {
+	// Open the database
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_WRITE)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.BeginAtomic(); err != nil {
+		return newError("begin atomic section", err)
+	}
+
+	tx := &Tx{db: db}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := db.EndAtomic(); err != nil {
+		return newError("end atomic section", err)
+	}
+
+	// Files are renamed only after the commit, since a discarded
+	// transaction can not undo a rename
+	if SyncMaildirFlags {
+		for _, messageID := range tx.retagged {
+			msg, err := db.FindMessage(messageID)
+			if err != nil || msg == nil {
+				continue
+			}
+			err = syncMaildirFlags(db, msg)
+			msg.Destroy()
+			if err != nil {
+				slog.Warn("Failed to sync Maildir flags after commit", "message_id", messageID, "error", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CountMessages returns the number of messages matching query as the
+// transaction sees them, leaving out those opts excludes
+func (tx *Tx) CountMessages(query string, opts QueryOptions) (int, error) {
+	return countQuery(context.Background(), tx.db, query, OutputMessages, opts)
+}
+
+// TagMessages adds and removes tags on every message matching filter and
+// returns the number of messages changed
+func (tx *Tx) TagMessages(filter string, add []string, remove []string) (int, error) {
+	q := tx.db.CreateQuery(filter)
+	if q == nil {
+		return 0, newError("create query", notmuch.ErrOutOfMemory)
+	}
+	defer q.Destroy()
+
+	messages, err := q.SearchMessages()
+	if err != nil {
+		return 0, newError("execute query", err)
+	}
+
+	changed := 0
+	for msg := range messages.All() {
+		if err := retag(msg, add, remove); err != nil {
+			err = fmt.Errorf("message %s: %w", msg.GetMessageId(), err)
+			msg.Destroy()
+			return changed, err
+		}
+		tx.retagged = append(tx.retagged, msg.GetMessageId())
+		msg.Destroy()
+
+		changed++
+	}
+
+	return changed, nil
+}
+
+// retag applies tag changes to a message while it is frozen
+func retag(msg *notmuch.Message, add []string, remove []string) error {
+	if err := msg.Freeze(); err != nil {
+		return newError("freeze message", err)
+	}
+	for _, tag := range remove {
+		if err := msg.RemoveTag(tag); err != nil {
+			return newError("remove tag", err)
+		}
+	}
+	for _, tag := range add {
+		if err := msg.AddTag(tag); err != nil {
+			return newError("add tag", err)
+		}
+	}
+	if err := msg.Thaw(); err != nil {
+		return newError("thaw message", err)
+	}
+
+	metrics.TagMutations.WithLabelValues("add").Add(float64(len(add)))
+	metrics.TagMutations.WithLabelValues("remove").Add(float64(len(remove)))
+	return nil
+}
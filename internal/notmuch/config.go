@@ -0,0 +1,101 @@
+package notmuch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zachatrocity/voyage/notmuch"
+)
+
+// NotmuchConfig is the notmuch config file handed to libnotmuch whenever the
+// database is opened, so settings such as named queries apply. Empty opens
+// the database without a config file.
+var NotmuchConfig string
+
+// UserConfig holds the settings of a notmuch config file that voyage shares
+// with the notmuch command line tool
+type UserConfig struct {
+	// Path is the config file that was read
+	Path string
+	// DatabasePath is database.path, or where libnotmuch looks by default
+	DatabasePath string
+	// ExcludeTags is search.exclude_tags; empty when not set
+	ExcludeTags []string
+	// NewTags is new.tags
+	NewTags []string
+	// SyncMaildirFlags is maildir.synchronize_flags, or nil when the file
+	// leaves it to libnotmuch's default of true
+	SyncMaildirFlags *bool
+}
+
+// ReadUserConfig reads the notmuch config file at path. The database it
+// names need not exist yet.
+func ReadUserConfig(path string) (*UserConfig, error) {
+	db, err := notmuch.LoadConfig("", path, "")
+	if err != nil && !errors.Is(err, notmuch.ErrNoDatabase) {
+		if errors.Is(err, notmuch.ErrNoConfig) {
+			db.Close()
+			return nil, fmt.Errorf("no notmuch config found at %s", path)
+		}
+		return nil, newError("load notmuch config", err)
+	}
+	defer db.Close()
+
+	cfg := &UserConfig{
+		Path:         db.ConfigPath(),
+		DatabasePath: db.ConfigGet(notmuch.CONFIG_DATABASE_PATH),
+		ExcludeTags:  configValues(db, notmuch.CONFIG_EXCLUDE_TAGS),
+		NewTags:      configValues(db, notmuch.CONFIG_NEW_TAGS),
+	}
+
+	if keyFileSets(cfg.Path, "maildir", "synchronize_flags") {
+		flags, err := db.ConfigGetBool(notmuch.CONFIG_SYNC_MAILDIR_FLAGS)
+		if err != nil {
+			return nil, newError("read maildir.synchronize_flags", err)
+		}
+		cfg.SyncMaildirFlags = &flags
+	}
+
+	return cfg, nil
+}
+
+// keyFileSets reports whether the notmuch config file at path sets key in
+// section. libnotmuch fills in defaults for what the file leaves out, so
+// only the file tells them apart.
+func keyFileSets(path string, section string, key string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	current := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			current = strings.TrimSpace(line[1 : len(line)-1])
+		case current == section:
+			if name, _, ok := strings.Cut(line, "="); ok && strings.TrimSpace(name) == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// configValues returns the non-empty values of a list setting
+func configValues(db *notmuch.Database, key notmuch.ConfigKey) []string {
+	values := db.ConfigGetValues(key)
+	defer values.Destroy()
+
+	result := []string{}
+	for value := range values.All() {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
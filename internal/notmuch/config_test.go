@@ -0,0 +1,37 @@
+package notmuch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyFileSets(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   bool
+	}{
+		{"unset", "[database]\npath=/mail\n", false},
+		{"set", "[maildir]\nsynchronize_flags=false\n", true},
+		{"spaces", "[ maildir ]\n  synchronize_flags = true\n", true},
+		{"other section", "[maildir]\n[new]\nsynchronize_flags=true\n", false},
+		{"comment", "[maildir]\n# synchronize_flags=true\n", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config")
+			if err := os.WriteFile(path, []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if got := keyFileSets(path, "maildir", "synchronize_flags"); got != tt.want {
+				t.Errorf("keyFileSets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if keyFileSets(filepath.Join(t.TempDir(), "missing"), "maildir", "synchronize_flags") {
+		t.Error("keyFileSets() = true for a missing file")
+	}
+}
@@ -0,0 +1,59 @@
+package notmuch
+
+import (
+	"fmt"
+
+	"github.com/zachatrocity/voyage/notmuch"
+	"golang.org/x/sys/unix"
+)
+
+// CheckWriter reports whether a write could start now: no upgrade or
+// compaction holds the database and the Xapian index is writable. It does
+// not take the writer lock, so probing it never makes notmuch new or
+// another writer fail: the database is only opened read-only to find the
+// index.
+func CheckWriter() error {
+	maintenance.Lock()
+	op := maintenance.op
+	maintenance.Unlock()
+	if op != "" {
+		return fmt.Errorf("%w: %s", ErrMaintenance, op)
+	}
+
+	db, err := openNotmuch(notmuch.DATABASE_MODE_READ_ONLY)
+	if err != nil {
+		return err
+	}
+	dir := indexDir(db.GetPath())
+	db.Close()
+
+	if err := unix.Access(dir, unix.W_OK); err != nil {
+		return fmt.Errorf("database index %s is not writable: %w", dir, err)
+	}
+	return nil
+}
+
+// DiskUsage is the space on the file system holding the database
+// @Description Space on the file system holding the database
+type DiskUsage struct {
+	Path string `json:"path" example:"/mail"`
+	// FreeBytes is the space available to voyage
+	FreeBytes  uint64 `json:"free_bytes" example:"10737418240"`
+	TotalBytes uint64 `json:"total_bytes" example:"107374182400"`
+}
+
+// GetDiskUsage returns the space on the file system holding the database
+func GetDiskUsage() (*DiskUsage, error) {
+	path := GetDatabasePath()
+
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return nil, fmt.Errorf("failed to stat file system of %s: %w", path, err)
+	}
+
+	return &DiskUsage{
+		Path:       path,
+		FreeBytes:  uint64(st.Bavail) * uint64(st.Bsize),
+		TotalBytes: uint64(st.Blocks) * uint64(st.Bsize),
+	}, nil
+}
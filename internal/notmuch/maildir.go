@@ -0,0 +1,98 @@
+package notmuch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/zachatrocity/voyage/notmuch"
+)
+
+// SyncMaildirFlags renames the Maildir files of a message after its tags
+// change, so the next mbsync run pushes the seen, flagged, replied and
+// trashed state back to the IMAP server.
+var SyncMaildirFlags = false
+
+// DeletedTag is mirrored by the Maildir trashed (T) flag
+const DeletedTag = "deleted"
+
+// syncMaildirFlags encodes the tags of msg in the names of its Maildir files
+func syncMaildirFlags(db *notmuch.Database, msg *notmuch.Message) error {
+	if err := msg.TagsToMaildirFlags(); err != nil {
+		return newError("sync maildir flags", err)
+	}
+
+	// libnotmuch leaves the trashed flag alone, so it follows the deleted
+	// tag here
+	deleted := false
+	for tag := range msg.GetTags().All() {
+		if tag == DeletedTag {
+			deleted = true
+		}
+	}
+
+	// Collect the names first, since renaming changes the list
+	filenames := slices.Collect(msg.GetFileNames().All())
+
+	for _, filename := range filenames {
+		renamed, ok := withTrashFlag(filename, deleted)
+		if !ok || renamed == filename {
+			continue
+		}
+		if err := renameMessageFile(db, filename, renamed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withTrashFlag returns filename with the Maildir T flag set or cleared. It
+// reports false for files outside a Maildir cur directory or without
+// Maildir info.
+func withTrashFlag(filename string, trashed bool) (string, bool) {
+	if filepath.Base(filepath.Dir(filename)) != "cur" {
+		return "", false
+	}
+	i := strings.LastIndex(filename, ":2,")
+	if i < 0 || strings.ContainsRune(filename[i:], os.PathSeparator) {
+		return "", false
+	}
+
+	flags := strings.ReplaceAll(filename[i+3:], "T", "")
+	if trashed {
+		// Flags are kept in ASCII order
+		chars := strings.Split(flags+"T", "")
+		sort.Strings(chars)
+		flags = strings.Join(chars, "")
+	}
+
+	return filename[:i+3] + flags, true
+}
+
+// renameMessageFile renames a message file and moves its database entry to
+// the new name
+func renameMessageFile(db *notmuch.Database, from string, to string) error {
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", from, err)
+	}
+
+	// The new name is a duplicate of the indexed message, which keeps its tags
+	added, err := db.AddMessage(to)
+	if err != nil && !errors.Is(err, notmuch.ErrDuplicateMessageID) {
+		os.Rename(to, from)
+		return newError("index renamed file", err)
+	}
+	added.Destroy()
+
+	err = db.RemoveMessage(from)
+	if err != nil && !errors.Is(err, notmuch.ErrDuplicateMessageID) {
+		return newError("remove old file name", err)
+	}
+
+	return nil
+}
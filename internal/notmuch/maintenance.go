@@ -0,0 +1,294 @@
+package notmuch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/zachatrocity/voyage/internal/metrics"
+	"github.com/zachatrocity/voyage/notmuch"
+)
+
+// Maintenance operations
+const (
+	MaintenanceUpgrade = "upgrade"
+	MaintenanceCompact = "compact"
+)
+
+// ErrMaintenance is returned while an upgrade or compaction holds the
+// database. Writes are refused during both; reads keep working during a
+// compaction, which leaves the original database in place until it is done.
+var ErrMaintenance = errors.New("database maintenance in progress")
+
+// maintenance is the operation currently holding the database, if any
+var maintenance struct {
+	sync.Mutex
+	op string
+}
+
+// beginMaintenance marks the database as held by op, failing when another
+// operation already holds it
+func beginMaintenance(op string) error {
+	maintenance.Lock()
+	defer maintenance.Unlock()
+
+	if maintenance.op != "" {
+		return fmt.Errorf("%w: %s", ErrMaintenance, maintenance.op)
+	}
+	maintenance.op = op
+	return nil
+}
+
+// endMaintenance releases the database after beginMaintenance
+func endMaintenance() {
+	maintenance.Lock()
+	defer maintenance.Unlock()
+	maintenance.op = ""
+}
+
+// openDatabase opens the notmuch database, refusing while maintenance holds
+// it. Opening for writing takes the Xapian writer lock, so a maintenance
+// operation started by another process makes it fail as well.
+func openDatabase(mode notmuch.DatabaseMode) (*notmuch.Database, error) {
+	maintenance.Lock()
+	op := maintenance.op
+	maintenance.Unlock()
+
+	if op != "" && (mode == notmuch.DATABASE_MODE_READ_WRITE || op == MaintenanceUpgrade) {
+		return nil, fmt.Errorf("%w: %s", ErrMaintenance, op)
+	}
+
+	return openNotmuch(mode)
+}
+
+// openNotmuch opens the notmuch database with NotmuchConfig, if set
+func openNotmuch(mode notmuch.DatabaseMode) (*notmuch.Database, error) {
+	label := "read_only"
+	if mode == notmuch.DATABASE_MODE_READ_WRITE {
+		label = "read_write"
+	}
+	defer observeSince(metrics.DatabaseOpenDuration.WithLabelValues(label), time.Now())
+
+	var db *notmuch.Database
+	var err error
+	if NotmuchConfig != "" {
+		db, err = notmuch.OpenDatabaseWithConfig(GetDatabasePath(), mode, NotmuchConfig, "")
+	} else {
+		db, err = notmuch.OpenDatabase(GetDatabasePath(), mode)
+	}
+	if err != nil {
+		return nil, newError("open notmuch database", err)
+	}
+	return db, nil
+}
+
+// DatabaseInfo describes the notmuch database
+// @Description Notmuch database information
+type DatabaseInfo struct {
+	Path    string `json:"path" example:"/mail"`
+	Version uint   `json:"version" example:"3"`
+	// NeedsUpgrade is only reported when asked for, since libnotmuch needs
+	// the writer lock to tell. It is left out while another writer holds
+	// the database.
+	NeedsUpgrade *bool  `json:"needs_upgrade,omitempty" example:"false"`
+	Revision     uint64 `json:"revision" example:"1234"`
+	UUID         string `json:"uuid" example:"4e0a9b2e-2d63-4c1c-9f3e-7d0b5a6c1f2a"`
+	Messages     int    `json:"messages" example:"15230"`
+	// SizeBytes is the size of the Xapian index on disk
+	SizeBytes int64 `json:"size_bytes" example:"524288000"`
+	// Maintenance is the operation holding the database, if any
+	Maintenance string `json:"maintenance,omitempty" example:"compact"`
+}
+
+// GetDatabaseInfo returns the version, size and message count of the
+// database. When checkUpgrade is set the database is briefly opened for
+// writing to find out whether it needs an upgrade.
+func GetDatabaseInfo(checkUpgrade bool) (*DatabaseInfo, error) {
+	maintenance.Lock()
+	op := maintenance.op
+	maintenance.Unlock()
+
+	// libnotmuch only reports a pending upgrade on a writable database
+	var db *notmuch.Database
+	var err error
+	writable := false
+	if checkUpgrade {
+		db, err = openDatabase(notmuch.DATABASE_MODE_READ_WRITE)
+		writable = err == nil
+	}
+	if !writable {
+		db, err = openDatabase(notmuch.DATABASE_MODE_READ_ONLY)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer db.Close()
+
+	info := &DatabaseInfo{
+		Path:        db.GetPath(),
+		Version:     db.GetVersion(),
+		Maintenance: op,
+	}
+	if writable {
+		needsUpgrade := db.NeedsUpgrade()
+		info.NeedsUpgrade = &needsUpgrade
+	}
+	info.Revision, info.UUID = db.GetRevision()
+
+	q := db.CreateQuery("*")
+	if q == nil {
+		return nil, newError("create query", notmuch.ErrOutOfMemory)
+	}
+	defer q.Destroy()
+	q.SetOmitExcluded(notmuch.EXCLUDE_FALSE)
+
+	count, err := q.CountMessages()
+	if err != nil {
+		return nil, newError("count messages", err)
+	}
+	info.Messages = int(count)
+
+	info.SizeBytes, err = indexSize(indexDir(info.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// indexDir returns the Xapian index of the database at path, as reported by
+// libnotmuch. Like libnotmuch it looks in <path>/.notmuch when that exists,
+// and otherwise directly in path, which is where the XDG layout
+// ($XDG_DATA_HOME/notmuch/<profile>) keeps it.
+func indexDir(path string) string {
+	if info, err := os.Stat(filepath.Join(path, ".notmuch")); err == nil && info.IsDir() {
+		return filepath.Join(path, ".notmuch", "xapian")
+	}
+	return filepath.Join(path, "xapian")
+}
+
+// indexSize returns the size of the Xapian index in dir
+func indexSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("failed to measure index: %w", err)
+	}
+	return size, nil
+}
+
+// Upgrade upgrades the database to the latest version supported by
+// libnotmuch, reporting progress between 0 and 1. It reports false when no
+// upgrade was needed.
+func Upgrade(progress func(float64)) (bool, error) {
+	if err := beginMaintenance(MaintenanceUpgrade); err != nil {
+		return false, err
+	}
+	defer endMaintenance()
+
+	db, err := openNotmuch(notmuch.DATABASE_MODE_READ_WRITE)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	if !db.NeedsUpgrade() {
+		return false, nil
+	}
+	if err := db.Upgrade(progress); err != nil {
+		return false, newError("upgrade database", err)
+	}
+	return true, db.Close()
+}
+
+// Compact rewrites the database into a smaller copy, moving the original to
+// backupPath, which must not exist yet and must be on the same file system
+func Compact(backupPath string, status func(string)) error {
+	if err := beginMaintenance(MaintenanceCompact); err != nil {
+		return err
+	}
+	defer endMaintenance()
+
+	if err := notmuch.Compact(GetDatabasePath(), backupPath, status); err != nil {
+		return newError("compact database", err)
+	}
+	return nil
+}
+
+// maxMissingFiles bounds the missing files listed in a CheckReport
+const maxMissingFiles = 100
+
+// CheckReport is the outcome of an integrity check of the database
+// @Description Database integrity check
+type CheckReport struct {
+	OK       bool `json:"ok" example:"false"`
+	Messages int  `json:"messages" example:"15230"`
+	// MessagesWithoutFiles counts messages none of whose files exist
+	MessagesWithoutFiles int `json:"messages_without_files" example:"1"`
+	// MissingFileCount counts indexed files that no longer exist
+	MissingFileCount int `json:"missing_file_count" example:"2"`
+	// MissingFiles lists up to 100 of the missing files
+	MissingFiles []string `json:"missing_files"`
+}
+
+// Check verifies that every indexed file of every message still exists on
+// disk, so mail deleted behind notmuch's back is noticed
+func Check() (*CheckReport, error) {
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_ONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	q := db.CreateQuery("*")
+	if q == nil {
+		return nil, newError("create query", notmuch.ErrOutOfMemory)
+	}
+	defer q.Destroy()
+	q.SetOmitExcluded(notmuch.EXCLUDE_FALSE)
+
+	messages, err := q.SearchMessages()
+	if err != nil {
+		return nil, newError("execute query", err)
+	}
+
+	report := &CheckReport{MissingFiles: []string{}}
+	for msg := range messages.All() {
+		report.Messages++
+
+		found := false
+		for filename := range msg.GetFileNames().All() {
+			if _, err := os.Stat(filename); err == nil {
+				found = true
+				continue
+			}
+			report.MissingFileCount++
+			if len(report.MissingFiles) < maxMissingFiles {
+				report.MissingFiles = append(report.MissingFiles, filename)
+			}
+		}
+		if !found {
+			report.MessagesWithoutFiles++
+		}
+		msg.Destroy()
+	}
+	report.OK = report.MissingFileCount == 0
+
+	return report, nil
+}
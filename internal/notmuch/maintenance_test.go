@@ -0,0 +1,54 @@
+package notmuch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIndexDir(t *testing.T) {
+	tests := []struct {
+		name string
+		// dirs are created below the temporary root before the lookup
+		dirs  []string
+		path  string
+		index string
+	}{
+		{"mail root", []string{"mail/.notmuch/xapian"}, "mail", "mail/.notmuch/xapian"},
+		{"xdg", []string{"data/notmuch/default/xapian", "mail/cur"}, "data/notmuch/default", "data/notmuch/default/xapian"},
+		{"xdg profile", []string{"data/notmuch/work/xapian"}, "data/notmuch/work", "data/notmuch/work/xapian"},
+		{"missing", nil, "mail", "mail/xapian"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, dir := range tt.dirs {
+				if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got, want := indexDir(filepath.Join(root, tt.path)), filepath.Join(root, tt.index); got != want {
+				t.Errorf("indexDir() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestIndexSizeXDG(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notmuch", "default")
+	if err := os.MkdirAll(filepath.Join(path, "xapian"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "xapian", "postlist.glass"), make([]byte, 4096), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := indexSize(indexDir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 4096 {
+		t.Errorf("indexSize() = %d, want 4096", size)
+	}
+}
@@ -1,11 +1,18 @@
 package notmuch
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
-	"os"
+	"log/slog"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zachatrocity/voyage/internal/metrics"
+	"github.com/zachatrocity/voyage/internal/query"
 	"github.com/zachatrocity/voyage/notmuch"
 )
 
@@ -24,28 +31,71 @@ type EmailResult struct {
 // SearchResults represents the results of a search query
 // @Description Search results containing matching emails
 type SearchResults struct {
-	Query   string        `json:"query" example:"subject:flight"`
-	Count   int           `json:"count" example:"42"`
-	Results []EmailResult `json:"results"`
+	Query string `json:"query" example:"subject:flight"`
+	// ExcludeTags are the tags hidden from the results unless the query
+	// names them
+	ExcludeTags []string      `json:"exclude_tags" example:"deleted,spam,voyage-ignored"`
+	Count       int           `json:"count" example:"42"`
+	Results     []EmailResult `json:"results"`
 }
 
+// ErrNotFound is returned when a message does not exist in the database
+var ErrNotFound = errors.New("message not found")
+
+// Error is returned when a notmuch operation fails, carrying the status
+// reported by libnotmuch. It unwraps to the status, so errors.Is(err,
+// notmuch.ErrReadOnly) works on it.
+type Error struct {
+	Op     string
+	Status notmuch.Status
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("failed to %s: %s", e.Op, e.Status)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Status
+}
+
+// newError records the operation that failed with an error returned by the
+// notmuch bindings
+func newError(op string, err error) error {
+	var status notmuch.Status
+	if errors.As(err, &status) {
+		return &Error{Op: op, Status: status}
+	}
+	return fmt.Errorf("failed to %s: %w", op, err)
+}
+
+// DatabasePath is the mail root holding the notmuch database
+var DatabasePath = "/mail"
+
 // GetDatabasePath returns the path to the notmuch database
 func GetDatabasePath() string {
-	// Check environment variable first
-	path := os.Getenv("NOTMUCH_DATABASE")
-	if path != "" {
-		return path
-	}
+	return DatabasePath
+}
+
+// DefaultExcludeTags hide messages from searches and counts unless the query
+// names the tag explicitly, e.g. tag:spam
+var DefaultExcludeTags = []string{"deleted", "spam", "voyage-ignored"}
 
-	// Default to /mail
-	return "/mail"
+// ParseTagList splits a comma-separated list of tags, dropping empty entries
+func ParseTagList(value string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(value, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
 }
 
 // CheckDatabaseConnection checks if the notmuch database is accessible
 func CheckDatabaseConnection() error {
-	db, status := notmuch.OpenDatabase(GetDatabasePath(), notmuch.DATABASE_MODE_READ_ONLY)
-	if status != notmuch.STATUS_SUCCESS {
-		return fmt.Errorf("failed to open notmuch database: %s", status)
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_ONLY)
+	if err != nil {
+		return err
 	}
 	defer db.Close()
 	return nil
@@ -65,25 +115,160 @@ const (
 	SortUnsorted
 )
 
-// Search performs a search against the notmuch database
-func Search(query string, limitStr string, sortType SortType) (*SearchResults, error) {
+// Syntax is the language a query string is written in
+type Syntax string
+
+const (
+	// SyntaxXapian is the classic notmuch search syntax, e.g. from:united and tag:travel
+	SyntaxXapian Syntax = "xapian"
+	// SyntaxSexp is the s-expression syntax, e.g. (and (from united) (tag travel))
+	SyntaxSexp Syntax = "sexp"
+)
+
+// ParseSyntax returns the syntax with the given name, defaulting to Xapian
+func ParseSyntax(name string) (Syntax, error) {
+	switch Syntax(name) {
+	case "", SyntaxXapian:
+		return SyntaxXapian, nil
+	case SyntaxSexp:
+		return SyntaxSexp, nil
+	}
+	return "", fmt.Errorf("unknown query syntax %q", name)
+}
+
+// QueryOptions control how a query string is parsed and which messages it
+// leaves out
+type QueryOptions struct {
+	// Syntax of the query string; empty means Xapian
+	Syntax Syntax
+	// Exclude hides messages with these tags unless the query names them
+	Exclude []string
+}
+
+// DefaultQueryOptions parses queries with the Xapian syntax and hides
+// DefaultExcludeTags
+func DefaultQueryOptions() QueryOptions {
+	return QueryOptions{Syntax: SyntaxXapian, Exclude: DefaultExcludeTags}
+}
+
+// Search performs a search against the notmuch database, hiding messages
+// tagged with one of DefaultExcludeTags
+func Search(ctx context.Context, query string, limitStr string, sortType SortType) (*SearchResults, error) {
+	return SearchWithOptions(ctx, query, limitStr, sortType, DefaultQueryOptions())
+}
+
+// SearchWithOptions performs a search against the notmuch database, parsing
+// the query and hiding messages as set by opts. Collecting the results stops
+// with ctx's error once ctx is done.
+func SearchWithOptions(ctx context.Context, query string, limitStr string, sortType SortType, opts QueryOptions) (*SearchResults, error) {
 	// Convert limit to int
 	limit, err := strconv.Atoi(limitStr)
 	if err != nil {
 		limit = 50 // Default limit
 	}
 
+	return search(ctx, query, limit, sortType, opts)
+}
+
+// SearchAll returns every message matching query, oldest first, hiding
+// messages tagged with one of DefaultExcludeTags
+func SearchAll(ctx context.Context, query string) ([]EmailResult, error) {
+	results, err := search(ctx, query, -1, SortOldestFirst, DefaultQueryOptions())
+	if err != nil {
+		return nil, err
+	}
+	return results.Results, nil
+}
+
+// MessageIDs returns the IDs of every message matching query, oldest first,
+// parsing the query and hiding messages as set by opts. Collecting the IDs
+// stops with ctx's error once ctx is done.
+func MessageIDs(ctx context.Context, query string, opts QueryOptions) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// Open the database
-	db, status := notmuch.OpenDatabase(GetDatabasePath(), notmuch.DATABASE_MODE_READ_ONLY)
-	if status != notmuch.STATUS_SUCCESS {
-		return nil, fmt.Errorf("failed to open notmuch database: %s", status)
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_ONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	q, err := createQuery(db, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer q.Destroy()
+	q.SetSort(notmuch.SORT_OLDEST_FIRST)
+
+	defer observeSince(metrics.DatabaseQueryDuration.WithLabelValues("search"), time.Now())
+	messages, err := q.SearchMessages()
+	if err != nil {
+		return nil, newError("execute query", err)
+	}
+
+	ids := []string{}
+	for msg := range messages.All() {
+		if err := ctx.Err(); err != nil {
+			msg.Destroy()
+			return nil, err
+		}
+		ids = append(ids, msg.GetMessageId())
+		msg.Destroy()
+	}
+	return ids, nil
+}
+
+// StreamSearch runs query like SearchWithOptions, but hands every result
+// to emit as it is read from the database instead of collecting them. A
+// negative limit streams every matching message. Streaming stops with the
+// error of emit, or with ctx's error once ctx is done.
+func StreamSearch(ctx context.Context, query string, limit int, sortType SortType, opts QueryOptions, emit func(EmailResult) error) error {
+	_, err := searchEach(ctx, query, limit, sortType, opts, false, emit)
+	return err
+}
+
+// search runs query and collects up to limit results. A negative limit
+// collects every matching message.
+func search(ctx context.Context, query string, limit int, sortType SortType, opts QueryOptions) (*SearchResults, error) {
+	results := &SearchResults{
+		Query:       query,
+		ExcludeTags: append([]string{}, opts.Exclude...),
+		Results:     []EmailResult{},
+	}
+
+	count, err := searchEach(ctx, query, limit, sortType, opts, true, func(emailResult EmailResult) error {
+		results.Results = append(results.Results, emailResult)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	results.Count = count
+
+	return results, nil
+}
+
+// searchEach runs query and hands up to limit results to emit, in order.
+// With count it returns the number of messages the query matches, otherwise
+// the number handed to emit, which spares a second pass over the index.
+func searchEach(ctx context.Context, query string, limit int, sortType SortType, opts QueryOptions, count bool, emit func(EmailResult) error) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// Open the database
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_ONLY)
+	if err != nil {
+		return 0, err
 	}
 	defer db.Close()
 
 	// Create a query
-	q := db.CreateQuery(query)
-	if q == nil {
-		return nil, fmt.Errorf("failed to create query")
+	q, err := createQuery(db, query, opts)
+	if err != nil {
+		return 0, err
 	}
 	defer q.Destroy()
 
@@ -101,67 +286,393 @@ func Search(query string, limitStr string, sortType SortType) (*SearchResults, e
 	// Set the sort order
 	q.SetSort(notmuchSort)
 
-	// Log the sort order for debugging
-	fmt.Printf("Search with query: %s notmuch sort: %d\n", query, notmuchSort)
+	slog.DebugContext(ctx, "Searching", "query", query, "sort", int(notmuchSort), "limit", limit)
 
 	// Execute the query
-	var messages *notmuch.Messages
-	status = notmuch.STATUS_SUCCESS
-	messages, status = q.SearchMessages()
-	if status != notmuch.STATUS_SUCCESS {
-		return nil, fmt.Errorf("failed to execute query: %s", status)
+	defer observeSince(metrics.DatabaseQueryDuration.WithLabelValues("search"), time.Now())
+	messages, err := q.SearchMessages()
+	if err != nil {
+		return 0, newError("execute query", err)
 	}
 
 	// Get the count of messages
-	var count uint
-	count, status = q.CountMessages()
-	if status != notmuch.STATUS_SUCCESS {
-		return nil, fmt.Errorf("failed to count messages: %s", status)
+	total := -1
+	if count {
+		n, err := q.CountMessages()
+		if err != nil {
+			return 0, newError("count messages", err)
+		}
+		total = int(n)
 	}
 
-	// Create results
-	results := &SearchResults{
-		Query:   query,
-		Count:   int(count),
-		Results: []EmailResult{},
+	// Iterate through messages
+	emitted := 0
+	for msg := range messages.All() {
+		if limit >= 0 && emitted >= limit {
+			msg.Destroy()
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			msg.Destroy()
+			return 0, err
+		}
+
+		// Create email result using helper function and hand it over
+		emailResult := createEmailResultFromMessage(msg)
+		msg.Destroy()
+		if err := emit(*emailResult); err != nil {
+			return 0, err
+		}
+		emitted++
 	}
 
-	// Iterate through messages
-	i := 0
-	for messages.Valid() && i < limit {
-		msg := messages.Get()
-		if msg == nil {
-			messages.MoveToNext()
+	if total < 0 {
+		total = emitted
+	}
+	metrics.SearchResults.Observe(float64(total))
+
+	return total, nil
+}
+
+// Changes are the messages modified after a database revision
+// @Description Messages whose tags, properties or content changed since a revision
+type Changes struct {
+	// Since is the revision the changes were requested from
+	Since uint64 `json:"since" example:"1200"`
+	// Revision is the committed database revision; pass it as since to
+	// fetch the next changes
+	Revision uint64 `json:"revision" example:"1234"`
+	// UUID identifies the database. Revisions of different databases can
+	// not be compared.
+	UUID    string        `json:"uuid" example:"4e0a9b2e-2d63-4c1c-9f3e-7d0b5a6c1f2a"`
+	Count   int           `json:"count" example:"3"`
+	Results []EmailResult `json:"results"`
+	// Next continues a listing cut short by its limit; it is empty on the
+	// last page, after which Revision is passed as since
+	Next string `json:"next,omitempty" example:"MTIzNCA8MTIzNDVAZXhhbXBsZS5jb20-"`
+}
+
+// ErrInvalidCursor is returned for a changes cursor that was not returned
+// as Changes.Next
+var ErrInvalidCursor = errors.New("invalid changes cursor")
+
+// ErrStaleCursor is returned for a changes cursor ahead of the database,
+// which means the database was replaced since it was handed out
+var ErrStaleCursor = errors.New("changes cursor is ahead of the database")
+
+// changesCursor is where a paged listing of changes resumes: the changes up
+// to revision, after the message with ID after
+type changesCursor struct {
+	revision uint64
+	after    string
+}
+
+// encode returns the cursor as an opaque string
+func (c changesCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatUint(c.revision, 10) + " " + c.after))
+}
+
+// parseCursor decodes a cursor made by encode
+func parseCursor(value string) (changesCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return changesCursor{}, ErrInvalidCursor
+	}
+	revision, after, ok := strings.Cut(string(raw), " ")
+	if !ok || after == "" {
+		return changesCursor{}, ErrInvalidCursor
+	}
+	c := changesCursor{after: after}
+	if c.revision, err = strconv.ParseUint(revision, 10, 64); err != nil {
+		return changesCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// GetRevision returns the committed database revision and the database UUID
+func GetRevision() (uint64, string, error) {
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_ONLY)
+	if err != nil {
+		return 0, "", err
+	}
+	defer db.Close()
+
+	revision, uuid := db.GetRevision()
+	return revision, uuid, nil
+}
+
+// GetChanges returns the messages matching filter that were modified after
+// revision since, in message ID order. An empty filter matches every
+// message. Messages tagged with one of exclude are left out unless the
+// filter names the tag. At most limit messages are returned, or all of them
+// when limit is 0; a listing cut short carries a Next cursor to pass back
+// with the same since and filter. Collecting the changes stops with ctx's
+// error once ctx is done.
+func GetChanges(ctx context.Context, since uint64, filter string, exclude []string, limit int, cursor string) (*Changes, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var resume changesCursor
+	if cursor != "" {
+		var err error
+		if resume, err = parseCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	// Open the database
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_ONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	revision, uuid := db.GetRevision()
+	if cursor != "" {
+		if resume.revision > revision {
+			return nil, ErrStaleCursor
+		}
+		// Every page lists the changes up to the revision of the first,
+		// which messages changed again since can only leave
+		revision = resume.revision
+	}
+	changes := &Changes{
+		Since:    since,
+		Revision: revision,
+		UUID:     uuid,
+		Results:  []EmailResult{},
+	}
+	if since >= revision {
+		return changes, nil
+	}
+
+	// Bound the range by the revision read above so the caller does not
+	// skip changes committed while the query runs
+	lastmod := fmt.Sprintf("lastmod:%d..%d", since+1, revision)
+	if filter != "" {
+		lastmod += " and (" + filter + ")"
+	}
+	q := db.CreateQuery(lastmod)
+	if q == nil {
+		return nil, newError("create query", notmuch.ErrOutOfMemory)
+	}
+	defer q.Destroy()
+	q.SetSort(notmuch.SORT_MESSAGE_ID)
+
+	if err := excludeTags(q, exclude); err != nil {
+		return nil, err
+	}
+
+	defer observeSince(metrics.DatabaseQueryDuration.WithLabelValues("changes"), time.Now())
+	messages, err := q.SearchMessages()
+	if err != nil {
+		return nil, newError("execute query", err)
+	}
+	// Messages up to the cursor were listed on earlier pages
+	last := resume.after
+	for msg := range messages.All() {
+		if err := ctx.Err(); err != nil {
+			msg.Destroy()
+			return nil, err
+		}
+		id := msg.GetMessageId()
+		if id <= resume.after {
+			msg.Destroy()
 			continue
 		}
+		if limit > 0 && len(changes.Results) == limit {
+			changes.Next = changesCursor{revision: revision, after: last}.encode()
+			msg.Destroy()
+			break
+		}
+		changes.Results = append(changes.Results, *createEmailResultFromMessage(msg))
+		last = id
+		msg.Destroy()
+	}
+	changes.Count = len(changes.Results)
 
-		// Create email result using helper function and add to results
-		emailResult := createEmailResultFromMessage(msg)
-		results.Results = append(results.Results, *emailResult)
+	return changes, nil
+}
+
+// Count outputs, selecting what Count counts
+const (
+	OutputMessages = "messages"
+	OutputThreads  = "threads"
+	OutputFiles    = "files"
+)
+
+// CountMessages returns the number of messages matching query, leaving out
+// messages tagged with one of DefaultExcludeTags
+func CountMessages(query string) (int, error) {
+	return Count(context.Background(), query, OutputMessages, DefaultQueryOptions())
+}
 
-		messages.MoveToNext()
-		i++
+// Count returns the number of messages, threads or files matching query
+// without building the search results, parsing the query and hiding
+// messages as set by opts. Counting files stops with ctx's error once ctx is
+// done.
+func Count(ctx context.Context, query string, output string, opts QueryOptions) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
 	}
 
-	return results, nil
+	// Open the database
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_ONLY)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	return countQuery(ctx, db, query, output, opts)
+}
+
+// CountRequest is a query counted by CountAll
+type CountRequest struct {
+	Query   string
+	Options QueryOptions
 }
 
-// GetEmail retrieves a single email by its message ID
+// CountAll returns the number of messages matching each request, in order,
+// opening the database once for all of them
+func CountAll(ctx context.Context, requests []CountRequest) ([]int, error) {
+	counts := make([]int, len(requests))
+	if len(requests) == 0 {
+		return counts, ctx.Err()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Open the database
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_ONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	for i, req := range requests {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		counts[i], err = countQuery(ctx, db, req.Query, OutputMessages, req.Options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// countQuery counts the matches of a query in an open database, as Count
+func countQuery(ctx context.Context, db *notmuch.Database, query string, output string, opts QueryOptions) (int, error) {
+	q, err := createQuery(db, query, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer q.Destroy()
+
+	defer observeSince(metrics.DatabaseQueryDuration.WithLabelValues("count"), time.Now())
+	var count uint
+	switch output {
+	case OutputMessages:
+		count, err = q.CountMessages()
+		if err != nil {
+			return 0, newError("count messages", err)
+		}
+	case OutputThreads:
+		count, err = q.CountThreads()
+		if err != nil {
+			return 0, newError("count threads", err)
+		}
+	case OutputFiles:
+		// A message stored in several folders has one file in each
+		messages, err := q.SearchMessages()
+		if err != nil {
+			return 0, newError("execute query", err)
+		}
+		for msg := range messages.All() {
+			if err := ctx.Err(); err != nil {
+				msg.Destroy()
+				return 0, err
+			}
+			if files := msg.CountFiles(); files > 0 {
+				count += uint(files)
+			}
+			msg.Destroy()
+		}
+	default:
+		return 0, fmt.Errorf("unknown count output %q", output)
+	}
+
+	return int(count), nil
+}
+
+// AllTags returns every tag in the database that starts with prefix
+func AllTags(prefix string) ([]string, error) {
+	// Open the database
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_ONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	tags := db.GetAllTags()
+	if tags == nil {
+		return nil, newError("list tags", notmuch.ErrXapianException)
+	}
+	defer tags.Destroy()
+
+	result := []string{}
+	for tag := range tags.All() {
+		if strings.HasPrefix(tag, prefix) {
+			result = append(result, tag)
+		}
+	}
+
+	return result, nil
+}
+
+// MatchesQuery reports whether the message with the given ID is matched by filter
+func MatchesQuery(messageID string, filter string) (bool, error) {
+	// Open the database
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_ONLY)
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	// Restrict the query to the single message
+	q := db.CreateQuery(fmt.Sprintf("id:%s and (%s)", query.Quote(messageID), filter))
+	if q == nil {
+		return false, newError("create query", notmuch.ErrOutOfMemory)
+	}
+	defer q.Destroy()
+
+	count, err := q.CountMessages()
+	if err != nil {
+		return false, newError("count messages", err)
+	}
+
+	return count > 0, nil
+}
+
+// GetEmail retrieves a single email by its message ID, returning ErrNotFound
+// when the database has no such message
 func GetEmail(messageID string) (*EmailResult, error) {
 	// Open the database
-	db, status := notmuch.OpenDatabase(GetDatabasePath(), notmuch.DATABASE_MODE_READ_ONLY)
-	if status != notmuch.STATUS_SUCCESS {
-		return nil, fmt.Errorf("failed to open notmuch database: %s", status)
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_ONLY)
+	if err != nil {
+		return nil, err
 	}
 	defer db.Close()
 
 	// Find the message
-	msg, status := db.FindMessage(messageID)
-	if status != notmuch.STATUS_SUCCESS {
-		return nil, fmt.Errorf("failed to find message: %s", status)
+	msg, err := db.FindMessage(messageID)
+	if err != nil {
+		return nil, newError("find message", err)
 	}
 	if msg == nil {
-		return nil, nil // Message not found
+		return nil, ErrNotFound
 	}
 	defer msg.Destroy()
 
@@ -172,34 +683,165 @@ func GetEmail(messageID string) (*EmailResult, error) {
 }
 
 // TagEmail sets a tag on a particular messageID email
-func TagEmail(messageID string, tag string) (*EmailResult, error) {
+func TagEmail(ctx context.Context, messageID string, tag string) (*EmailResult, error) {
+	return retagEmail(ctx, messageID, []string{tag}, nil)
+}
+
+// UntagEmail removes a tag from a particular messageID email
+func UntagEmail(ctx context.Context, messageID string, tag string) (*EmailResult, error) {
+	return retagEmail(ctx, messageID, nil, []string{tag})
+}
+
+// retagEmail adds and removes tags on a single email, renaming its Maildir
+// files to match when SyncMaildirFlags is set. A failed rename is logged
+// rather than returned, since the tags are already written.
+func retagEmail(ctx context.Context, messageID string, add []string, remove []string) (*EmailResult, error) {
 	// Open the database
-	db, status := notmuch.OpenDatabase(GetDatabasePath(), notmuch.DATABASE_MODE_READ_WRITE)
-	if status != notmuch.STATUS_SUCCESS {
-		return nil, fmt.Errorf("failed to open notmuch database: %s", status)
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_WRITE)
+	if err != nil {
+		return nil, err
 	}
 	defer db.Close()
 
 	// Find the message
-	msg, status := db.FindMessage(messageID)
-	if status != notmuch.STATUS_SUCCESS {
-		return nil, fmt.Errorf("failed to find message: %s", status)
+	msg, err := db.FindMessage(messageID)
+	if err != nil {
+		return nil, newError("find message", err)
 	}
 	if msg == nil {
-		return nil, nil // Message not found
+		return nil, ErrNotFound
 	}
 	defer msg.Destroy()
 
-	tagStatus := msg.AddTag(tag)
-	if tagStatus != notmuch.STATUS_SUCCESS {
-		return nil, fmt.Errorf("failed to add tag: %s", status)
+	if err := retag(msg, add, remove); err != nil {
+		return nil, err
+	}
+
+	if SyncMaildirFlags {
+		if err := syncMaildirFlags(db, msg); err != nil {
+			slog.WarnContext(ctx, "Failed to sync Maildir flags after retagging", "message_id", messageID, "error", err)
+		}
 	}
+	slog.InfoContext(ctx, "Retagged message", "message_id", messageID, "add", add, "remove", remove)
 
 	result := createEmailResultFromMessage(msg)
 
 	return result, nil
 }
 
+// GetProperties returns the properties of a message whose keys start with
+// prefix, returning ErrNotFound when the database has no such message
+func GetProperties(messageID string, prefix string) (map[string][]string, error) {
+	// Open the database
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_ONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// Find the message
+	msg, err := db.FindMessage(messageID)
+	if err != nil {
+		return nil, newError("find message", err)
+	}
+	if msg == nil {
+		return nil, ErrNotFound
+	}
+	defer msg.Destroy()
+
+	properties := map[string][]string{}
+	props := msg.GetProperties(prefix, false)
+	for key, value := range props.All() {
+		properties[key] = append(properties[key], value)
+	}
+	props.Destroy()
+
+	return properties, nil
+}
+
+// SetProperties replaces every property of a message whose key starts with
+// prefix by properties. The change runs in an atomic section, so readers
+// see either the old or the new set; on error the section is left open and
+// closing the database discards it.
+func SetProperties(messageID string, prefix string, properties map[string][]string) error {
+	// Open the database
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_WRITE)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Find the message
+	msg, err := db.FindMessage(messageID)
+	if err != nil {
+		return newError("find message", err)
+	}
+	if msg == nil {
+		return ErrNotFound
+	}
+	defer msg.Destroy()
+
+	if err := db.BeginAtomic(); err != nil {
+		return newError("begin atomic section", err)
+	}
+	if err := msg.RemoveAllPropertiesWithPrefix(prefix); err != nil {
+		return newError("remove properties", err)
+	}
+	for key, values := range properties {
+		for _, value := range values {
+			if err := msg.AddProperty(key, value); err != nil {
+				return newError("add property", err)
+			}
+		}
+	}
+	if err := db.EndAtomic(); err != nil {
+		return newError("end atomic section", err)
+	}
+
+	return nil
+}
+
+// observeSince records the time elapsed since start
+func observeSince(o prometheus.Observer, start time.Time) {
+	o.Observe(time.Since(start).Seconds())
+}
+
+// createQuery parses query in the syntax set by opts and applies its tag
+// excludes
+func createQuery(db *notmuch.Database, query string, opts QueryOptions) (*notmuch.Query, error) {
+	var q *notmuch.Query
+	if opts.Syntax == SyntaxSexp {
+		var err error
+		q, err = db.CreateQueryWithSyntax(query, notmuch.QUERY_SYNTAX_SEXP)
+		if err != nil {
+			return nil, newError("parse sexp query", err)
+		}
+	} else {
+		q = db.CreateQuery(query)
+		if q == nil {
+			return nil, newError("create query", notmuch.ErrOutOfMemory)
+		}
+	}
+
+	if err := excludeTags(q, opts.Exclude); err != nil {
+		q.Destroy()
+		return nil, err
+	}
+	return q, nil
+}
+
+// excludeTags hides messages with the given tags from the results of q
+func excludeTags(q *notmuch.Query, tags []string) error {
+	for _, tag := range tags {
+		// Tags named in the query are ignored rather than excluded
+		err := q.AddTagExclude(tag)
+		if err != nil && !errors.Is(err, notmuch.ErrIgnored) {
+			return newError("exclude tag "+tag, err)
+		}
+	}
+	return nil
+}
+
 // createEmailResultFromMessage creates an EmailResult from a notmuch Message
 func createEmailResultFromMessage(msg *notmuch.Message) *EmailResult {
 	// Get message date
@@ -208,10 +850,8 @@ func createEmailResultFromMessage(msg *notmuch.Message) *EmailResult {
 
 	// Get tags
 	tags := []string{}
-	msgTags := msg.GetTags()
-	for msgTags.Valid() {
-		tags = append(tags, msgTags.Get())
-		msgTags.MoveToNext()
+	for tag := range msg.GetTags().All() {
+		tags = append(tags, tag)
 	}
 
 	// Create result
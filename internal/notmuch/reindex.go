@@ -0,0 +1,87 @@
+package notmuch
+
+import (
+	"fmt"
+
+	"github.com/zachatrocity/voyage/notmuch"
+)
+
+// decryptPolicies maps the index.decrypt values of notmuch-config(1) to
+// libnotmuch policies
+var decryptPolicies = map[string]notmuch.DecryptionPolicy{
+	"false":   notmuch.DECRYPT_FALSE,
+	"true":    notmuch.DECRYPT_TRUE,
+	"auto":    notmuch.DECRYPT_AUTO,
+	"nostash": notmuch.DECRYPT_NOSTASH,
+}
+
+// ReindexOptions control how messages are indexed again
+type ReindexOptions struct {
+	// Decrypt is the policy for encrypted parts: false, true, auto or
+	// nostash. Empty keeps the database default.
+	Decrypt string
+}
+
+// Validate checks the options before a reindex is started
+func (o ReindexOptions) Validate() error {
+	if _, ok := decryptPolicies[o.Decrypt]; o.Decrypt != "" && !ok {
+		return fmt.Errorf("unknown decrypt policy %q, expected false, true, auto or nostash", o.Decrypt)
+	}
+	return nil
+}
+
+// Reindex indexes the messages with the given IDs again, keeping their tags
+// and properties. fn is called after each message with the name of one of
+// its files and the error for that message, ErrNotFound when it no longer
+// exists; returning false stops the reindex. The returned error is set when
+// the database could not be used at all.
+func Reindex(messageIDs []string, opts ReindexOptions, fn func(messageID string, filename string, err error) bool) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	// Open the database
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_WRITE)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	indexOpts := db.GetDefaultIndexOpts()
+	if indexOpts == nil {
+		return newError("get index options", notmuch.ErrXapianException)
+	}
+	defer indexOpts.Destroy()
+	if opts.Decrypt != "" {
+		if err := indexOpts.SetDecryptPolicy(decryptPolicies[opts.Decrypt]); err != nil {
+			return newError("set decrypt policy", err)
+		}
+	}
+
+	for _, messageID := range messageIDs {
+		filename, err := reindexMessage(db, messageID, indexOpts)
+		if !fn(messageID, filename, err) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// reindexMessage indexes a single message again and returns the name of
+// one of its files
+func reindexMessage(db *notmuch.Database, messageID string, opts *notmuch.IndexOpts) (string, error) {
+	msg, err := db.FindMessage(messageID)
+	if err != nil {
+		return "", newError("find message", err)
+	}
+	if msg == nil {
+		return "", ErrNotFound
+	}
+	defer msg.Destroy()
+
+	if err := msg.Reindex(opts); err != nil {
+		return "", newError("reindex message", err)
+	}
+	return msg.GetFileName(), nil
+}
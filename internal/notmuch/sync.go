@@ -0,0 +1,455 @@
+package notmuch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zachatrocity/voyage/notmuch"
+)
+
+// SyncReport summarises a Sync of the database with the mail directory
+// @Description Outcome of syncing the database with the mail directory
+type SyncReport struct {
+	// Added lists the message IDs of the messages new to the database
+	Added []string `json:"added"`
+	// AddedFiles counts the indexed files, including new copies of known
+	// messages
+	AddedFiles int `json:"added_files" example:"4"`
+	// RemovedFiles counts the indexed files that no longer exist
+	RemovedFiles int `json:"removed_files" example:"1"`
+	// Removed counts the messages none of whose files exist any more
+	Removed int `json:"removed" example:"1"`
+	// Ignored counts the files that do not look like email
+	Ignored int `json:"ignored" example:"0"`
+	// Unreadable counts the files that could not be read. They are tried
+	// again once their directory changes.
+	Unreadable int `json:"unreadable" example:"0"`
+}
+
+// syncBatch is how many files Sync indexes or removes before committing
+// them and closing the database, so other writers are not locked out for a
+// whole sync
+const syncBatch = 1000
+
+// Sync brings the database in line with the mail directory, as notmuch new
+// does: files not indexed yet are added, with newTags on new messages, and
+// files that no longer exist are removed. Only directories whose mtime
+// differs from the one stored by the last sync are listed against the
+// database. Maildir flags are turned into tags on new messages when
+// SyncMaildirFlags is set. With NotmuchConfig the mail root and the
+// new.ignore patterns of the config are honoured. Files that cannot be read
+// are logged and skipped. The database is closed and opened again every
+// syncBatch files. Once ctx is done Sync stops with
+// ctx's error; every file indexed until then is kept.
+func Sync(ctx context.Context, newTags []string) (*SyncReport, error) {
+	// Open the database
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_WRITE)
+	if err != nil {
+		return nil, err
+	}
+	s := &syncer{
+		ctx:     ctx,
+		db:      db,
+		newTags: newTags,
+		report:  &SyncReport{Added: []string{}},
+		start:   time.Now().Unix(),
+	}
+	// s.db changes between batches
+	defer func() { s.db.Close() }()
+
+	s.root = db.ConfigGet(notmuch.CONFIG_MAIL_ROOT)
+	if s.root == "" {
+		s.root = db.GetPath()
+	}
+	if s.ignore, err = ignorePatterns(db); err != nil {
+		return nil, err
+	}
+
+	if err := s.syncDirectory(s.root); err != nil {
+		return nil, err
+	}
+	// Files moved between directories are added before their old names
+	// are removed, so their messages keep their tags
+	if err := s.removeMissing(); err != nil {
+		return nil, err
+	}
+	if err := s.storeMtimes(); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Close(); err != nil {
+		return nil, newError("close database", err)
+	}
+	return s.report, nil
+}
+
+// syncer holds the state of a Sync
+type syncer struct {
+	ctx     context.Context
+	db      *notmuch.Database
+	root    string
+	ignore  *ignoreList
+	newTags []string
+	report  *SyncReport
+
+	// start is when the sync began, in Unix seconds. Directory mtimes from
+	// that second on are not stored, as files may still arrive within it.
+	start int64
+	// pending counts the files indexed or removed since the database was
+	// opened
+	pending int
+
+	// The files and directories gone from disk, and the directory mtimes to
+	// store once they are removed
+	missingFiles []string
+	missingDirs  []string
+	mtimes       map[string]int64
+}
+
+// syncDirectory adds the new files of the directory at path when its mtime
+// changed, noting the files gone from it, then syncs its subdirectories,
+// which are always visited since changes inside them leave path's mtime
+// alone
+func (s *syncer) syncDirectory(path string) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	mtime := info.ModTime().Unix()
+	changed, files, dirs, err := s.indexed(path, mtime)
+	if err != nil {
+		return err
+	}
+
+	var subdirs []string
+	onDisk := make(map[string]bool, len(entries))
+	for _, d := range entries {
+		name := d.Name()
+		onDisk[name] = true
+		// Skip the database, hidden files such as sync state, and
+		// messages still being delivered into a Maildir tmp directory
+		if strings.HasPrefix(name, ".") || s.ignore.match(s.root, filepath.Join(path, name)) {
+			continue
+		}
+		if d.IsDir() {
+			if name != "tmp" || !isMaildir(path) {
+				subdirs = append(subdirs, name)
+			}
+			continue
+		}
+		if changed && d.Type().IsRegular() && !files[name] {
+			if err := s.addFile(filepath.Join(path, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if changed {
+		for name := range files {
+			if !onDisk[name] {
+				s.missingFiles = append(s.missingFiles, filepath.Join(path, name))
+			}
+		}
+		for name := range dirs {
+			if !onDisk[name] {
+				s.missingDirs = append(s.missingDirs, filepath.Join(path, name))
+			}
+		}
+		// A timestamp of 0 cannot be told from a missing one
+		if mtime != 0 && mtime < s.start {
+			if s.mtimes == nil {
+				s.mtimes = map[string]int64{}
+			}
+			s.mtimes[path] = mtime
+		}
+	}
+
+	for _, name := range subdirs {
+		if err := s.syncDirectory(filepath.Join(path, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexed reports whether the directory at path changed since its mtime was
+// stored and, if so, the names of its files and subdirectories known to the
+// database
+func (s *syncer) indexed(path string, mtime int64) (changed bool, files, dirs map[string]bool, err error) {
+	dir, err := s.db.GetDirectory(path)
+	if err != nil {
+		return false, nil, nil, newError("get directory", err)
+	}
+	if dir == nil {
+		return true, nil, nil, nil
+	}
+	defer dir.Destroy()
+	if dir.GetMtime() == mtime {
+		return false, nil, nil, nil
+	}
+
+	if files, err = childNames(dir.GetChildFiles()); err != nil {
+		return false, nil, nil, newError("get directory files", err)
+	}
+	if dirs, err = childNames(dir.GetChildDirectories()); err != nil {
+		return false, nil, nil, newError("get subdirectories", err)
+	}
+	return true, files, dirs, nil
+}
+
+// childNames collects the names listed by a directory
+func childNames(names *notmuch.Filenames) (map[string]bool, error) {
+	if names == nil {
+		return nil, notmuch.ErrXapianException
+	}
+	defer names.Destroy()
+	set := map[string]bool{}
+	for name := range names.All() {
+		set[name] = true
+	}
+	return set, nil
+}
+
+// addFile indexes a file the database does not know, tagging a new message
+// in the same atomic section so an interrupted sync does not leave it
+// without its tags
+func (s *syncer) addFile(filename string) error {
+	if err := s.db.BeginAtomic(); err != nil {
+		return newError("begin atomic section", err)
+	}
+	if err := s.indexFile(filename); err != nil {
+		// Closing the database is the only way to abort the section; the
+		// files indexed before it are kept
+		s.db.Close()
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := s.db.EndAtomic(); err != nil {
+		s.db.Close()
+		return fmt.Errorf("%s: %w", filename, newError("end atomic section", err))
+	}
+	return s.changed()
+}
+
+// indexFile adds a file inside addFile's atomic section
+func (s *syncer) indexFile(filename string) error {
+	msg, err := s.db.AddMessage(filename)
+	switch {
+	case errors.Is(err, notmuch.ErrDuplicateMessageID):
+		// A new copy of a known message keeps the tags it has
+		msg.Destroy()
+		s.report.AddedFiles++
+		return nil
+	case errors.Is(err, notmuch.ErrFileNotEmail):
+		s.report.Ignored++
+		return nil
+	case errors.Is(err, notmuch.ErrFileError):
+		// Like notmuch new, carry on with the other files
+		slog.WarnContext(s.ctx, "Failed to read mail file", "file", filename, "error", err)
+		s.report.Unreadable++
+		return nil
+	case err != nil:
+		return newError("index file", err)
+	}
+	defer msg.Destroy()
+
+	s.report.AddedFiles++
+	s.report.Added = append(s.report.Added, msg.GetMessageId())
+	if err := retag(msg, s.newTags, nil); err != nil {
+		return err
+	}
+	if SyncMaildirFlags {
+		if err := msg.MaildirFlagsToTags(); err != nil {
+			return newError("sync maildir flags", err)
+		}
+	}
+	return nil
+}
+
+// removeMissing removes the files and directories found missing from the
+// database
+func (s *syncer) removeMissing() error {
+	for _, filename := range s.missingFiles {
+		if err := s.removeFile(filename); err != nil {
+			return err
+		}
+	}
+	for _, path := range s.missingDirs {
+		if err := s.removeDirectory(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeFile removes an indexed file that no longer exists
+func (s *syncer) removeFile(filename string) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	err := s.db.RemoveMessage(filename)
+	switch {
+	case err == nil:
+		// That was the last file of the message
+		s.report.Removed++
+	case !errors.Is(err, notmuch.ErrDuplicateMessageID):
+		return fmt.Errorf("%s: %w", filename, newError("remove file", err))
+	}
+	s.report.RemovedFiles++
+	return s.changed()
+}
+
+// removeDirectory removes a directory that no longer exists, with the files
+// and subdirectories the database knows in it
+func (s *syncer) removeDirectory(path string) error {
+	dir, err := s.db.GetDirectory(path)
+	if err != nil {
+		return newError("get directory", err)
+	}
+	if dir == nil {
+		return nil
+	}
+	// Collect the names first, since the database may be reopened while
+	// they are removed
+	files, err := childNames(dir.GetChildFiles())
+	var dirs map[string]bool
+	if err == nil {
+		dirs, err = childNames(dir.GetChildDirectories())
+	}
+	dir.Destroy()
+	if err != nil {
+		return newError("list directory", err)
+	}
+
+	for name := range files {
+		if err := s.removeFile(filepath.Join(path, name)); err != nil {
+			return err
+		}
+	}
+	for name := range dirs {
+		if err := s.removeDirectory(filepath.Join(path, name)); err != nil {
+			return err
+		}
+	}
+
+	if dir, err = s.db.GetDirectory(path); err != nil {
+		return newError("get directory", err)
+	}
+	if dir == nil {
+		return nil
+	}
+	if err := dir.Delete(); err != nil {
+		return newError("delete directory", err)
+	}
+	return nil
+}
+
+// storeMtimes stores the mtimes of the directories listed, so the next sync
+// skips them while they stay unchanged
+func (s *syncer) storeMtimes() error {
+	for path, mtime := range s.mtimes {
+		dir, err := s.db.GetDirectory(path)
+		if err != nil {
+			return newError("get directory", err)
+		}
+		if dir == nil {
+			// Nothing was ever indexed in it
+			continue
+		}
+		err = dir.SetMtime(mtime)
+		dir.Destroy()
+		if err != nil {
+			return newError("store directory mtime", err)
+		}
+	}
+	return nil
+}
+
+// changed counts a file indexed or removed, committing the batch and
+// opening the database again once it is full
+func (s *syncer) changed() error {
+	s.pending++
+	if s.pending < syncBatch {
+		return nil
+	}
+	s.pending = 0
+
+	if err := s.db.Close(); err != nil {
+		return newError("close database", err)
+	}
+	db, err := openDatabase(notmuch.DATABASE_MODE_READ_WRITE)
+	if err != nil {
+		return err
+	}
+	s.db = db
+	return nil
+}
+
+// ignoreList holds the new.ignore entries of the notmuch config: plain
+// names match any file or directory with that name, and /regex/ entries
+// match paths relative to the mail root
+type ignoreList struct {
+	names    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// ignorePatterns reads new.ignore
+func ignorePatterns(db *notmuch.Database) (*ignoreList, error) {
+	ignore := &ignoreList{names: map[string]bool{}}
+
+	values := db.ConfigGetValues(notmuch.CONFIG_NEW_IGNORE)
+	defer values.Destroy()
+	for value := range values.All() {
+		if len(value) > 2 && strings.HasPrefix(value, "/") && strings.HasSuffix(value, "/") {
+			re, err := regexp.Compile(value[1 : len(value)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid new.ignore pattern %s: %w", value, err)
+			}
+			ignore.patterns = append(ignore.patterns, re)
+		} else if value != "" {
+			ignore.names[value] = true
+		}
+	}
+
+	return ignore, nil
+}
+
+// match reports whether path is ignored
+func (l *ignoreList) match(root string, path string) bool {
+	if l.names[filepath.Base(path)] {
+		return true
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	for _, re := range l.patterns {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// isMaildir reports whether dir has the cur and new directories of a Maildir
+func isMaildir(dir string) bool {
+	for _, sub := range []string{"cur", "new"} {
+		if info, err := os.Stat(filepath.Join(dir, sub)); err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
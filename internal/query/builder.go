@@ -0,0 +1,115 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Node is a structured search query. Leaf fields set on the same node are
+// combined with AND; And, Or and Not combine child nodes.
+// @Description Structured search query
+type Node struct {
+	And     []Node     `json:"and,omitempty"`
+	Or      []Node     `json:"or,omitempty"`
+	Not     *Node      `json:"not,omitempty"`
+	From    string     `json:"from,omitempty" example:"united.com"`
+	To      string     `json:"to,omitempty" example:"me@example.com"`
+	Subject string     `json:"subject,omitempty" example:"flight confirmation"`
+	Tag     string     `json:"tag,omitempty" example:"travel"`
+	Body    string     `json:"body,omitempty" example:"confirmation number"`
+	Date    *DateRange `json:"date,omitempty"`
+}
+
+// DateRange restricts a query to messages sent within a date range. Either
+// bound may be left empty for an open range.
+// @Description Date range
+type DateRange struct {
+	After  string `json:"after,omitempty" example:"2023-01-01"`
+	Before string `json:"before,omitempty" example:"2023-12-31"`
+}
+
+// ErrEmptyQuery is returned when a node has nothing to search for
+var ErrEmptyQuery = errors.New("query node is empty")
+
+// Compile turns a structured query into notmuch query syntax
+func Compile(n Node) (string, error) {
+	return compile(n, "query")
+}
+
+// compile renders a node, using path to point at the offending node in errors
+func compile(n Node, path string) (string, error) {
+	var parts []string
+
+	fields := []struct {
+		prefix string
+		value  string
+	}{
+		{"from", n.From},
+		{"to", n.To},
+		{"subject", n.Subject},
+		{"tag", n.Tag},
+		{"body", n.Body},
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		parts = append(parts, f.prefix+":"+Quote(f.value))
+	}
+
+	if n.Date != nil {
+		if n.Date.After == "" && n.Date.Before == "" {
+			return "", fmt.Errorf("%s.date: at least one of after or before is required", path)
+		}
+		parts = append(parts, "date:"+quoteDate(n.Date.After)+".."+quoteDate(n.Date.Before))
+	}
+
+	for i, child := range n.And {
+		s, err := compile(child, fmt.Sprintf("%s.and[%d]", path, i))
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "("+s+")")
+	}
+
+	if len(n.Or) > 0 {
+		var alternatives []string
+		for i, child := range n.Or {
+			s, err := compile(child, fmt.Sprintf("%s.or[%d]", path, i))
+			if err != nil {
+				return "", err
+			}
+			alternatives = append(alternatives, "("+s+")")
+		}
+		parts = append(parts, "("+strings.Join(alternatives, " or ")+")")
+	}
+
+	if n.Not != nil {
+		s, err := compile(*n.Not, path+".not")
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, "not ("+s+")")
+	}
+
+	if len(parts) == 0 {
+		return "", fmt.Errorf("%s: %w", path, ErrEmptyQuery)
+	}
+
+	return strings.Join(parts, " and "), nil
+}
+
+// Quote quotes a value as a notmuch phrase, doubling embedded quotes
+func Quote(value string) string {
+	return `"` + strings.ReplaceAll(value, `"`, `""`) + `"`
+}
+
+// quoteDate quotes a date range bound only when needed, since notmuch
+// accepts bare dates such as 2023-01-01 or yesterday
+func quoteDate(value string) string {
+	if value == "" || !strings.ContainsAny(value, " \t\"()") {
+		return value
+	}
+	return Quote(value)
+}
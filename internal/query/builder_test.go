@@ -0,0 +1,133 @@
+package query
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"travel", `"travel"`},
+		{"flight confirmation", `"flight confirmation"`},
+		{`say "hi"`, `"say ""hi"""`},
+		{`"`, `""""`},
+		{"(draft)", `"(draft)"`},
+		{"re: flight", `"re: flight"`},
+		{"", `""`},
+	}
+
+	for _, tt := range tests {
+		if got := Quote(tt.value); got != tt.want {
+			t.Errorf("Quote(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		node Node
+		want string
+	}{
+		{
+			name: "single field",
+			node: Node{Tag: "travel"},
+			want: `tag:"travel"`,
+		},
+		{
+			name: "fields are anded",
+			node: Node{From: "united.com", Subject: "flight confirmation"},
+			want: `from:"united.com" and subject:"flight confirmation"`,
+		},
+		{
+			name: "quote in value",
+			node: Node{Subject: `your "UA 123" itinerary`},
+			want: `subject:"your ""UA 123"" itinerary"`,
+		},
+		{
+			name: "parenthesis in value",
+			node: Node{Subject: "receipt (copy)"},
+			want: `subject:"receipt (copy)"`,
+		},
+		{
+			name: "colon in value",
+			node: Node{Subject: "re: flight", To: "me@example.com"},
+			want: `to:"me@example.com" and subject:"re: flight"`,
+		},
+		{
+			name: "open date range",
+			node: Node{Date: &DateRange{After: "2023-01-01"}},
+			want: "date:2023-01-01..",
+		},
+		{
+			name: "date with spaces",
+			node: Node{Date: &DateRange{After: "last week", Before: "today"}},
+			want: `date:"last week"..today`,
+		},
+		{
+			name: "or",
+			node: Node{Or: []Node{{Tag: "flight"}, {Tag: "hotel"}}},
+			want: `((tag:"flight") or (tag:"hotel"))`,
+		},
+		{
+			name: "and with not",
+			node: Node{
+				Tag: "travel",
+				And: []Node{{From: "united.com"}},
+				Not: &Node{Tag: "cancelled"},
+			},
+			want: `tag:"travel" and (from:"united.com") and not (tag:"cancelled")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Compile(tt.node)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Compile = %s, want %s", got, tt.want)
+			}
+
+			// Whatever the builder emits must pass the validator
+			if report := Validate(got); !report.Valid || len(report.Warnings) > 0 {
+				t.Errorf("Validate(%s) = errors %v, warnings %v", got, report.Errors, report.Warnings)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		node Node
+		path string
+	}{
+		{"empty", Node{}, "query"},
+		{"empty date", Node{Date: &DateRange{}}, "query.date"},
+		{"empty and child", Node{Tag: "travel", And: []Node{{Tag: "a"}, {}}}, "query.and[1]"},
+		{"empty or child", Node{Or: []Node{{}}}, "query.or[0]"},
+		{"empty not", Node{Tag: "travel", Not: &Node{}}, "query.not"},
+		{"nested", Node{Or: []Node{{Not: &Node{Date: &DateRange{}}}}}, "query.or[0].not.date"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.node)
+			if err == nil {
+				t.Fatal("Compile succeeded")
+			}
+			if !strings.HasPrefix(err.Error(), tt.path+":") {
+				t.Errorf("error %q does not point at %s", err, tt.path)
+			}
+			if tt.node.Date == nil && !strings.Contains(tt.path, "date") && !errors.Is(err, ErrEmptyQuery) {
+				t.Errorf("error %q is not ErrEmptyQuery", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package query
+
+// ValidateSexp checks the structure of an s-expression query, reporting
+// unbalanced parentheses and unterminated quoted strings. Field names and
+// operators are left for notmuch to check.
+func ValidateSexp(q string) Report {
+	p := &parser{input: q}
+
+	var open []int
+	for i := 0; i < len(q); i++ {
+		switch q[i] {
+		case '"':
+			end := scanSexpString(q, i)
+			if end < 0 {
+				p.errorf(i, "unterminated quoted string")
+				i = len(q)
+				break
+			}
+			i = end
+		case '(':
+			open = append(open, i)
+		case ')':
+			if len(open) == 0 {
+				p.errorf(i, "unexpected ')' without matching '('")
+				continue
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	for _, pos := range open {
+		p.errorf(pos, "unclosed '('")
+	}
+
+	return Report{
+		Query:    q,
+		Valid:    len(p.errors) == 0,
+		Errors:   append([]ParseError{}, p.errors...),
+		Warnings: []ParseError{},
+	}
+}
+
+// scanSexpString returns the offset of the quote closing the string that
+// starts at i, or -1 when it is not closed. A backslash escapes the next byte.
+func scanSexpString(s string, i int) int {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '"':
+			return j
+		}
+	}
+	return -1
+}
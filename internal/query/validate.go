@@ -0,0 +1,319 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError describes a problem found in a query string
+// @Description Query parse error
+type ParseError struct {
+	// Position is the zero-based byte offset of the problem in the query
+	Position int    `json:"position" example:"12"`
+	Message  string `json:"message" example:"unterminated quoted phrase"`
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Position, e.Message)
+}
+
+// Report is the outcome of validating a query string
+// @Description Query validation report
+type Report struct {
+	Query    string       `json:"query" example:"subject:flight and (tag:travel"`
+	Valid    bool         `json:"valid" example:"false"`
+	Errors   []ParseError `json:"errors"`
+	Warnings []ParseError `json:"warnings"`
+}
+
+// Prefixes are the search prefixes understood by notmuch
+var Prefixes = map[string]bool{
+	"attachment": true,
+	"body":       true,
+	"date":       true,
+	"folder":     true,
+	"from":       true,
+	"id":         true,
+	"is":         true,
+	"lastmod":    true,
+	"mid":        true,
+	"mimetype":   true,
+	"path":       true,
+	"property":   true,
+	"query":      true,
+	"subject":    true,
+	"tag":        true,
+	"thread":     true,
+	"to":         true,
+}
+
+// Validate checks a notmuch query string for syntax errors before it is
+// handed to Xapian, reporting the position of every problem found
+func Validate(q string) Report {
+	p := &parser{input: q}
+	p.tokens = p.lex()
+	if strings.TrimSpace(q) != "" && strings.TrimSpace(q) != "*" {
+		p.parseExpr()
+		if t := p.peek(); t.kind != tokEOF {
+			if t.kind == tokRParen {
+				p.errorf(t.pos, "unexpected ')' without matching '('")
+			} else {
+				p.errorf(t.pos, "unexpected %q", t.text)
+			}
+		}
+	}
+
+	return Report{
+		Query:    q,
+		Valid:    len(p.errors) == 0,
+		Errors:   append([]ParseError{}, p.errors...),
+		Warnings: append([]ParseError{}, p.warnings...),
+	}
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokTerm
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type parser struct {
+	input    string
+	tokens   []token
+	next     int
+	errors   []ParseError
+	warnings []ParseError
+}
+
+func (p *parser) errorf(pos int, format string, args ...interface{}) {
+	p.errors = append(p.errors, ParseError{Position: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) warnf(pos int, format string, args ...interface{}) {
+	p.warnings = append(p.warnings, ParseError{Position: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// lex splits the query into terms, parentheses and boolean operators
+func (p *parser) lex() []token {
+	var tokens []token
+	s := p.input
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\n\r()", rune(s[i])) {
+				if s[i] == '"' {
+					end, ok := scanQuoted(s, i)
+					if !ok {
+						p.errorf(i, "unterminated quoted phrase")
+						i = len(s)
+						break
+					}
+					i = end
+					continue
+				}
+				i++
+			}
+			tokens = append(tokens, p.classify(s[start:i], start))
+
+			// prefix:( groups the parenthesized terms under the prefix
+			if i < len(s) && s[i] == '(' && strings.HasSuffix(s[start:i], ":") {
+				tokens[len(tokens)-1].text += "(...)"
+			}
+		}
+	}
+
+	return append(tokens, token{tokEOF, "", len(s)})
+}
+
+// scanQuoted returns the offset just past the quoted phrase starting at i.
+// A doubled quote inside the phrase stands for a literal quote.
+func scanQuoted(s string, i int) (int, bool) {
+	for j := i + 1; j < len(s); j++ {
+		if s[j] != '"' {
+			continue
+		}
+		if j+1 < len(s) && s[j+1] == '"' {
+			j++
+			continue
+		}
+		return j + 1, true
+	}
+	return len(s), false
+}
+
+// classify turns a bare word into an operator or term token
+func (p *parser) classify(word string, pos int) token {
+	switch strings.ToLower(word) {
+	case "and":
+		return token{tokAnd, word, pos}
+	case "or", "xor":
+		return token{tokOr, word, pos}
+	case "not":
+		return token{tokNot, word, pos}
+	}
+	if strings.ToUpper(word) == word && (strings.HasPrefix(word, "NEAR") || strings.HasPrefix(word, "ADJ")) {
+		return token{tokOr, word, pos}
+	}
+	return token{tokTerm, word, pos}
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokEOF {
+		p.next++
+	}
+	return t
+}
+
+// parseExpr parses alternatives joined by or/xor
+func (p *parser) parseExpr() {
+	p.parseAnd()
+	for p.peek().kind == tokOr {
+		op := p.advance()
+		if !p.startsOperand() {
+			p.errorf(op.pos, "missing right operand for %q", op.text)
+			return
+		}
+		p.parseAnd()
+	}
+}
+
+// parseAnd parses operands joined by and, or simply juxtaposed
+func (p *parser) parseAnd() {
+	if !p.startsOperand() {
+		t := p.peek()
+		switch t.kind {
+		case tokAnd, tokOr:
+			p.errorf(t.pos, "missing left operand for %q", t.text)
+			p.advance()
+			if p.startsOperand() {
+				p.parseAnd()
+			}
+		case tokRParen:
+			// reported by the caller
+		case tokEOF:
+			p.errorf(t.pos, "unexpected end of query")
+		}
+		return
+	}
+
+	p.parseUnary()
+	for {
+		t := p.peek()
+		if t.kind == tokAnd {
+			p.advance()
+			if !p.startsOperand() {
+				p.errorf(t.pos, "missing right operand for %q", t.text)
+				return
+			}
+		} else if !p.startsOperand() {
+			return
+		}
+		p.parseUnary()
+	}
+}
+
+// parseUnary parses an optionally negated operand
+func (p *parser) parseUnary() {
+	if t := p.peek(); t.kind == tokNot {
+		p.advance()
+		if !p.startsOperand() {
+			p.errorf(t.pos, "missing operand for %q", t.text)
+			return
+		}
+		p.parseUnary()
+		return
+	}
+	p.parsePrimary()
+}
+
+// parsePrimary parses a parenthesized group or a single term
+func (p *parser) parsePrimary() {
+	t := p.advance()
+	switch t.kind {
+	case tokLParen:
+		if p.peek().kind == tokRParen {
+			p.errorf(t.pos, "empty parentheses")
+			p.advance()
+			return
+		}
+		p.parseExpr()
+		if p.peek().kind != tokRParen {
+			p.errorf(t.pos, "unclosed '('")
+			return
+		}
+		p.advance()
+	case tokTerm:
+		p.checkTerm(t)
+		if strings.HasSuffix(t.text, "(...)") {
+			p.parsePrimary()
+		}
+	}
+}
+
+// startsOperand reports whether the next token can begin an operand
+func (p *parser) startsOperand() bool {
+	switch p.peek().kind {
+	case tokTerm, tokLParen, tokNot:
+		return true
+	}
+	return false
+}
+
+// checkTerm validates the prefix and value of a single term
+func (p *parser) checkTerm(t token) {
+	word := strings.TrimSuffix(t.text, "(...)")
+	trimmed := strings.TrimLeft(word, "+-")
+	pos := t.pos + len(word) - len(trimmed)
+	word = trimmed
+
+	// Only a colon before any quote introduces a prefix
+	colon := strings.IndexByte(word, ':')
+	if colon <= 0 || strings.ContainsRune(word[:colon], '"') {
+		return
+	}
+
+	prefix, value := word[:colon], word[colon+1:]
+	if !Prefixes[strings.ToLower(prefix)] {
+		p.warnf(pos, "unknown prefix %q is searched as plain text", prefix)
+		return
+	}
+	if value == "" && !strings.HasSuffix(t.text, "(...)") {
+		p.errorf(pos+colon+1, "missing value for %q", prefix+":")
+		return
+	}
+	if value == `""` {
+		p.errorf(pos+colon+1, "empty quoted value for %q", prefix+":")
+		return
+	}
+	if value == ".." {
+		p.errorf(pos+colon+1, "range for %q needs at least one bound", prefix+":")
+	}
+}
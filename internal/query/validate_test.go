@@ -0,0 +1,103 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		query    string
+		errors   []ParseError
+		warnings []ParseError
+	}{
+		{query: ""},
+		{query: "*"},
+		{query: "tag:travel"},
+		{query: "subject:flight and (tag:travel or tag:hotel)"},
+		{query: "from:united.com not tag:spam"},
+		{query: "tag:( travel hotel )"},
+		{query: `subject:"flight ""UA 123"" confirmed"`},
+		{query: `subject:"a (b) c:d"`},
+		{query: "date:2023-01-01.."},
+		{query: "+tag:travel -tag:spam"},
+		{query: "flight NEAR/3 confirmation"},
+		{
+			query:  "subject:flight and (tag:travel",
+			errors: []ParseError{{19, "unclosed '('"}},
+		},
+		{
+			query:  "tag:travel)",
+			errors: []ParseError{{10, "unexpected ')' without matching '('"}},
+		},
+		{
+			query:  `subject:"flight`,
+			errors: []ParseError{{8, "unterminated quoted phrase"}},
+		},
+		{
+			query:  "()",
+			errors: []ParseError{{0, "empty parentheses"}},
+		},
+		{
+			query:  "and tag:travel",
+			errors: []ParseError{{0, `missing left operand for "and"`}},
+		},
+		{
+			query:  "tag:travel or",
+			errors: []ParseError{{11, `missing right operand for "or"`}},
+		},
+		{
+			query:  "tag:travel and",
+			errors: []ParseError{{11, `missing right operand for "and"`}},
+		},
+		{
+			query:  "tag:travel not",
+			errors: []ParseError{{11, `missing operand for "not"`}},
+		},
+		{
+			query:  "from:united.com tag:",
+			errors: []ParseError{{20, `missing value for "tag:"`}},
+		},
+		{
+			query:  `-subject:""`,
+			errors: []ParseError{{9, `empty quoted value for "subject:"`}},
+		},
+		{
+			query:  "date:..",
+			errors: []ParseError{{5, `range for "date:" needs at least one bound`}},
+		},
+		{
+			query:    "flight colour:blue",
+			warnings: []ParseError{{7, `unknown prefix "colour" is searched as plain text`}},
+		},
+		{
+			// A colon inside a quoted phrase is not a prefix
+			query: `"re: flight" subject:"a:b"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			report := Validate(tt.query)
+			if report.Query != tt.query {
+				t.Errorf("Query = %q, want %q", report.Query, tt.query)
+			}
+			if report.Valid != (len(tt.errors) == 0) {
+				t.Errorf("Valid = %v with errors %v", report.Valid, report.Errors)
+			}
+			if want := append([]ParseError{}, tt.errors...); !reflect.DeepEqual(report.Errors, want) {
+				t.Errorf("Errors = %v, want %v", report.Errors, want)
+			}
+			if want := append([]ParseError{}, tt.warnings...); !reflect.DeepEqual(report.Warnings, want) {
+				t.Errorf("Warnings = %v, want %v", report.Warnings, want)
+			}
+		})
+	}
+}
+
+func TestParseErrorString(t *testing.T) {
+	err := ParseError{Position: 12, Message: "unclosed '('"}
+	if got, want := err.Error(), "position 12: unclosed '('"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
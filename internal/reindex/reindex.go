@@ -0,0 +1,320 @@
+package reindex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/zachatrocity/voyage/internal/events"
+	"github.com/zachatrocity/voyage/internal/extract"
+	"github.com/zachatrocity/voyage/internal/logging"
+	"github.com/zachatrocity/voyage/internal/metrics"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+)
+
+// Job statuses
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusCancelled = "cancelled"
+	StatusFailed    = "failed"
+)
+
+// maxFinishedJobs bounds the number of finished jobs kept for inspection
+const maxFinishedJobs = 20
+
+var (
+	// ErrNotFound is returned when a job does not exist
+	ErrNotFound = errors.New("reindex job not found")
+	// ErrBusy is returned when starting a job while another one runs, since
+	// both would compete for the database write lock
+	ErrBusy = errors.New("a reindex job is already running")
+	// ErrFinished is returned when cancelling a job that already finished
+	ErrFinished = errors.New("reindex job already finished")
+)
+
+// Job is a background run of notmuch indexing and reservation extraction
+// over the messages matching a query
+// @Description Reindex job
+type Job struct {
+	ID      string `json:"id" example:"6f1c2a9e4b7d3e10"`
+	Query   string `json:"query" example:"tag:travel"`
+	Syntax  string `json:"syntax" example:"xapian"`
+	Decrypt string `json:"decrypt,omitempty" example:"auto"`
+	Status  string `json:"status" example:"running"`
+	// Total is the number of messages matching the query when the job
+	// started, 0 until the job has looked them up
+	Total int `json:"total" example:"120"`
+	// Done counts the messages processed so far, including failed ones
+	Done int `json:"done" example:"40"`
+	// Failed counts the messages that could not be reindexed or extracted
+	Failed     int        `json:"failed" example:"1"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at" example:"2023-01-01T12:00:00Z"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" example:"2023-01-01T12:03:00Z"`
+}
+
+// Manager runs reindex jobs one at a time and keeps their progress
+type Manager struct {
+	// BatchSize is the number of messages reindexed per database write
+	// session. The write lock is released between batches, so other
+	// writers are not locked out for the whole job.
+	BatchSize int
+
+	mu      sync.Mutex
+	jobs    []*Job
+	cancels map[string]context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewManager creates a manager without jobs
+func NewManager() *Manager {
+	return &Manager{
+		BatchSize: 50,
+		cancels:   map[string]context.CancelFunc{},
+	}
+}
+
+// Start begins reindexing the messages matching query in the background.
+// The messages are looked up by the job itself, which runs until it is
+// done, cancelled or the manager is closed; a query that fails fails the
+// job.
+func (m *Manager) Start(ctx context.Context, query string, syntax notmuch.Syntax, opts notmuch.ReindexOptions) (Job, error) {
+	if err := opts.Validate(); err != nil {
+		return Job{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, job := range m.jobs {
+		if job.Status == StatusRunning {
+			return Job{}, ErrBusy
+		}
+	}
+
+	job := &Job{
+		ID:        events.NewID(),
+		Query:     query,
+		Syntax:    string(syntax),
+		Decrypt:   opts.Decrypt,
+		Status:    StatusRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	jobCtx, cancel := context.WithCancel(logging.With(context.Background(), "job_id", job.ID))
+	m.cancels[job.ID] = cancel
+	m.jobs = append(m.jobs, job)
+	m.prune()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.run(jobCtx, job, syntax, opts)
+	}()
+	slog.InfoContext(ctx, "Reindex job started", "job_id", job.ID, "query", query)
+
+	return *job, nil
+}
+
+// List returns every known job, newest first
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := make([]Job, 0, len(m.jobs))
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, *m.jobs[i])
+	}
+	return jobs
+}
+
+// Get returns the job with the given ID
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if job := m.find(id); job != nil {
+		return *job, nil
+	}
+	return Job{}, ErrNotFound
+}
+
+// Cancel stops a running job after the message it is processing
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job := m.find(id)
+	if job == nil {
+		return Job{}, ErrNotFound
+	}
+	cancel, ok := m.cancels[id]
+	if !ok {
+		return *job, ErrFinished
+	}
+	cancel()
+	return *job, nil
+}
+
+// Pending returns the number of messages the running job has yet to
+// process, or 0 when no job runs
+func (m *Manager) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	pending := 0
+	for _, job := range m.jobs {
+		if job.Status == StatusRunning {
+			pending += job.Total - job.Done
+		}
+	}
+	return pending
+}
+
+// Close cancels the running job and waits for it to stop after the message
+// it is processing
+func (m *Manager) Close() {
+	m.mu.Lock()
+	for _, cancel := range m.cancels {
+		cancel()
+	}
+	m.mu.Unlock()
+
+	m.wg.Wait()
+}
+
+// run finds the messages matching the query of job and processes them batch
+// by batch until done or cancelled
+func (m *Manager) run(ctx context.Context, job *Job, syntax notmuch.Syntax, opts notmuch.ReindexOptions) {
+	// Excluded messages are reindexed too
+	ids, err := notmuch.MessageIDs(ctx, job.Query, notmuch.QueryOptions{Syntax: syntax})
+	if err == nil {
+		m.mu.Lock()
+		job.Total = len(ids)
+		m.mu.Unlock()
+		metrics.Pending.WithLabelValues(metrics.QueueReindex).Set(float64(len(ids)))
+		slog.InfoContext(ctx, "Reindexing messages", "messages", len(ids))
+	}
+
+	for start := 0; start < len(ids) && ctx.Err() == nil && err == nil; start += m.BatchSize {
+		end := min(start+m.BatchSize, len(ids))
+		err = m.runBatch(ctx, job, ids[start:end], opts)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	switch {
+	case ctx.Err() != nil:
+		job.Status = StatusCancelled
+	case err != nil:
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	default:
+		job.Status = StatusCompleted
+	}
+	m.cancels[job.ID]()
+	delete(m.cancels, job.ID)
+	metrics.Pending.WithLabelValues(metrics.QueueReindex).Set(0)
+
+	slog.InfoContext(ctx, "Reindex job finished", "status", job.Status, "done", job.Done, "total", job.Total, "failed", job.Failed)
+}
+
+// runBatch reindexes a batch of messages, then extracts their reservations
+// again. Extraction writes message properties, so it runs once the reindex
+// has released the database.
+func (m *Manager) runBatch(ctx context.Context, job *Job, batch []string, opts notmuch.ReindexOptions) error {
+	// filenames holds a file of every message reindexed
+	filenames := map[string]string{}
+	err := notmuch.Reindex(batch, opts, func(messageID string, filename string, err error) bool {
+		if err != nil {
+			m.fail(ctx, job, messageID, err)
+		} else {
+			filenames[messageID] = filename
+		}
+		return ctx.Err() == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, messageID := range batch {
+		filename, ok := filenames[messageID]
+		if !ok {
+			continue
+		}
+		if err := extractAgain(messageID, filename); err != nil {
+			m.fail(ctx, job, messageID, err)
+			continue
+		}
+
+		m.mu.Lock()
+		job.Done++
+		m.mu.Unlock()
+		metrics.Pending.WithLabelValues(metrics.QueueReindex).Dec()
+	}
+
+	return nil
+}
+
+// fail counts a message that could not be processed. Messages deleted
+// since the job started are skipped without counting as failed.
+func (m *Manager) fail(ctx context.Context, job *Job, messageID string, err error) {
+	deleted := errors.Is(err, notmuch.ErrNotFound)
+	if !deleted {
+		slog.WarnContext(ctx, "Failed to reindex message", "message_id", messageID, "error", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.Done++
+	metrics.Pending.WithLabelValues(metrics.QueueReindex).Dec()
+	if !deleted {
+		job.Failed++
+	}
+}
+
+// extractAgain parses a message ignoring the reservations stored on it and
+// replaces them with the result
+func extractAgain(messageID string, filename string) error {
+	reservations, err := extract.FromFile(messageID, filename)
+	if err != nil {
+		return fmt.Errorf("extract reservations: %w", err)
+	}
+	return extract.Store(messageID, reservations)
+}
+
+// find returns the job with the given ID, or nil
+func (m *Manager) find(id string) *Job {
+	for _, job := range m.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// prune forgets the oldest finished jobs beyond maxFinishedJobs
+func (m *Manager) prune() {
+	finished := 0
+	for _, job := range m.jobs {
+		if job.Status != StatusRunning {
+			finished++
+		}
+	}
+
+	jobs := m.jobs[:0]
+	for _, job := range m.jobs {
+		if job.Status != StatusRunning && finished > maxFinishedJobs {
+			finished--
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	m.jobs = jobs
+}
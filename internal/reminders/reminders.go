@@ -0,0 +1,441 @@
+package reminders
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zachatrocity/voyage/internal/events"
+	"github.com/zachatrocity/voyage/internal/extract"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+	"github.com/zachatrocity/voyage/internal/state"
+)
+
+const (
+	// Anchor a rule to the start (departure, check-in) of a reservation
+	AnchorStart = "start"
+	// Anchor a rule to the end (arrival, check-out) of a reservation
+	AnchorEnd = "end"
+
+	// CancelledTag marks every reservation in a message as cancelled
+	CancelledTag = "cancelled"
+
+	stateFile = "reminders.json"
+
+	// firedRetention is how long fired reminders are remembered
+	firedRetention = 90 * 24 * time.Hour
+)
+
+// Reminder statuses
+const (
+	StatusPending   = "pending"
+	StatusFired     = "fired"
+	StatusCancelled = "cancelled"
+	StatusMissed    = "missed"
+)
+
+// Rule describes when a reminder fires relative to a reservation
+type Rule struct {
+	Name    string
+	Type    string
+	Anchor  string
+	Lead    time.Duration
+	Message string
+}
+
+// DefaultRules are the reminders Voyage fires out of the box
+var DefaultRules = []Rule{
+	{Name: "checkin-opens", Type: extract.TypeFlight, Anchor: AnchorStart, Lead: 24 * time.Hour, Message: "Online check-in opens"},
+	{Name: "departure", Type: extract.TypeFlight, Anchor: AnchorStart, Lead: 3 * time.Hour, Message: "Flight departs soon"},
+	{Name: "hotel-checkin", Type: extract.TypeHotel, Anchor: AnchorStart, Lead: 6 * time.Hour, Message: "Hotel check-in today"},
+	{Name: "checkout-today", Type: extract.TypeHotel, Anchor: AnchorEnd, Lead: 4 * time.Hour, Message: "Check-out today"},
+}
+
+// Reminder is a single scheduled notification for a reservation
+// @Description Reminder for an upcoming reservation
+type Reminder struct {
+	Key          string    `json:"key" example:"flight|ABC123|UA 123|checkin-opens|1672588800"`
+	Rule         string    `json:"rule" example:"checkin-opens"`
+	Message      string    `json:"message" example:"Online check-in opens"`
+	Type         string    `json:"type" example:"flight"`
+	MessageID    string    `json:"message_id" example:"<12345@example.com>"`
+	Confirmation string    `json:"confirmation" example:"ABC123"`
+	Name         string    `json:"name" example:"UA 123"`
+	FireAt       time.Time `json:"fire_at" example:"2022-12-31T08:00:00-08:00"`
+	EventAt      time.Time `json:"event_at" example:"2023-01-01T08:00:00-08:00"`
+	EventZone    string    `json:"event_zone,omitempty" example:"America/Los_Angeles"`
+	Status       string    `json:"status" example:"pending"`
+}
+
+// Scheduler extracts reservations from travel emails and fires reminders
+// through the event system when they become due
+type Scheduler struct {
+	// Query selects the travel emails to extract reservations from
+	Query string
+	// Interval is the time between scans
+	Interval time.Duration
+	// Rules are the reminders to schedule for each reservation
+	Rules []Rule
+	// Now returns the current time
+	Now func() time.Time
+
+	// mu guards reminders, which Upcoming reads while a scan runs
+	mu        sync.Mutex
+	reminders []Reminder
+
+	// scan serializes Tick and guards everything below, so the database
+	// and emails are read without holding mu
+	scan      sync.Mutex
+	fired     map[string]time.Time
+	extracted map[string][]extract.Reservation
+
+	// messages are the travel emails as of revision of the database
+	// identified by uuid
+	messages map[string]notmuch.EmailResult
+	revision uint64
+	uuid     string
+}
+
+// NewScheduler creates a scheduler computing reminders for the emails
+// matching query, with the lead times overridden as in RulesFromEnv, and
+// loads the reminders that already fired from the state directory
+func NewScheduler(query string, leadTimes string) (*Scheduler, error) {
+	rules, err := RulesFromEnv(DefaultRules, leadTimes)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Scheduler{
+		Query:     "tag:travel",
+		Interval:  time.Minute,
+		Rules:     rules,
+		Now:       time.Now,
+		fired:     map[string]time.Time{},
+		extracted: map[string][]extract.Reservation{},
+		messages:  map[string]notmuch.EmailResult{},
+	}
+	if query != "" {
+		s.Query = query
+	}
+
+	if err := state.Load(stateFile, &s.fired); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// RulesFromEnv applies lead time overrides of the form
+// "flight.checkin-opens=24h,hotel.checkout-today=3h" to rules
+func RulesFromEnv(rules []Rule, value string) ([]Rule, error) {
+	result := make([]Rule, len(rules))
+	copy(result, rules)
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, lead, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid reminder lead time %q", entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(lead))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid reminder lead time %q", entry)
+		}
+
+		found := false
+		for i, r := range result {
+			if r.Type+"."+r.Name == strings.TrimSpace(name) {
+				result[i].Lead = d
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown reminder %q", name)
+		}
+	}
+
+	return result, nil
+}
+
+// Run scans for due reminders every Interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Tick(ctx); err != nil {
+			slog.ErrorContext(ctx, "Reminder scan failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Upcoming returns the reminders computed by the last scan, soonest first
+func (s *Scheduler) Upcoming() []Reminder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reminders := make([]Reminder, len(s.reminders))
+	copy(reminders, s.reminders)
+	return reminders
+}
+
+// Tick extracts reservations from new travel emails, recomputes every
+// reminder and fires the ones that are due
+func (s *Scheduler) Tick(ctx context.Context) error {
+	s.scan.Lock()
+	defer s.scan.Unlock()
+
+	messages, err := s.sync(ctx)
+	if err != nil {
+		return err
+	}
+
+	var reservations []extract.Reservation
+	cancelledByTag := map[string]bool{}
+	for _, msg := range messages {
+		found, ok := s.extracted[msg.MessageID]
+		if !ok {
+			found, err = extract.Extract(ctx, msg.MessageID, msg.Filename)
+			if err != nil {
+				slog.WarnContext(ctx, "Failed to extract reservations", "message_id", msg.MessageID, "error", err)
+			}
+			s.extracted[msg.MessageID] = found
+		}
+
+		for _, t := range msg.Tags {
+			if t == CancelledTag {
+				for _, res := range found {
+					cancelledByTag[res.Type+"|"+res.Confirmation] = true
+				}
+			}
+		}
+		reservations = append(reservations, found...)
+	}
+
+	// Forget the reservations of emails that no longer match Query
+	for id := range s.extracted {
+		if _, ok := s.messages[id]; !ok {
+			delete(s.extracted, id)
+		}
+	}
+
+	now := s.Now()
+	reminders := s.schedule(reservations, cancelledByTag, now)
+
+	var due []int
+	for i, r := range reminders {
+		if r.Status == StatusPending && !now.Before(r.FireAt) {
+			due = append(due, i)
+		}
+	}
+
+	// Remember the reminders before publishing them so a crash can never
+	// make one fire twice
+	if len(due) > 0 {
+		for _, i := range due {
+			s.fired[reminders[i].Key] = now
+		}
+		if err := s.save(now); err != nil {
+			for _, i := range due {
+				delete(s.fired, reminders[i].Key)
+			}
+			return err
+		}
+		for _, i := range due {
+			reminders[i].Status = StatusFired
+		}
+	}
+
+	s.mu.Lock()
+	s.reminders = reminders
+	s.mu.Unlock()
+
+	for _, i := range due {
+		r := reminders[i]
+		events.Publish(events.Event{
+			Type:      events.TypeReminderDue,
+			MessageID: r.MessageID,
+			Data: map[string]interface{}{
+				"rule":         r.Rule,
+				"message":      r.Message,
+				"type":         r.Type,
+				"confirmation": r.Confirmation,
+				"name":         r.Name,
+				"fire_at":      r.FireAt.Format(time.RFC3339),
+				"event_at":     r.EventAt.Format(time.RFC3339),
+				"event_zone":   r.EventZone,
+			},
+		})
+	}
+
+	return nil
+}
+
+// sync brings the tracked travel emails up to date and returns them, oldest
+// first. The first call, or one after the database was replaced, scans every
+// email matching Query; later calls only look at the emails changed since
+// the last sync.
+func (s *Scheduler) sync(ctx context.Context) ([]notmuch.EmailResult, error) {
+	revision, uuid, err := notmuch.GetRevision()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case uuid != s.uuid:
+		found, err := notmuch.SearchAll(ctx, s.Query)
+		if err != nil {
+			return nil, err
+		}
+		s.messages = map[string]notmuch.EmailResult{}
+		s.extracted = map[string][]extract.Reservation{}
+		for _, msg := range found {
+			s.messages[msg.MessageID] = msg
+		}
+	case revision > s.revision:
+		changed, err := notmuch.GetChanges(ctx, s.revision, "", nil, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		matching, err := notmuch.GetChanges(ctx, s.revision, s.Query, notmuch.DefaultExcludeTags, 0, "")
+		if err != nil {
+			return nil, err
+		}
+
+		// Changed emails are extracted again, which reads the stored
+		// reservations back from their properties
+		for _, msg := range changed.Results {
+			delete(s.messages, msg.MessageID)
+			delete(s.extracted, msg.MessageID)
+		}
+		for _, msg := range matching.Results {
+			s.messages[msg.MessageID] = msg
+		}
+
+		// Changes committed between the two reads are looked at again
+		// next time
+		revision = changed.Revision
+		if matching.Revision < revision {
+			revision = matching.Revision
+		}
+	}
+	s.revision, s.uuid = revision, uuid
+
+	messages := make([]notmuch.EmailResult, 0, len(s.messages))
+	for _, msg := range s.messages {
+		messages = append(messages, msg)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].Date.Equal(messages[j].Date) {
+			return messages[i].Date.Before(messages[j].Date)
+		}
+		return messages[i].MessageID < messages[j].MessageID
+	})
+
+	return messages, nil
+}
+
+// schedule computes the reminders for every reservation segment. When the
+// same segment appears in several emails, such as a confirmation followed by
+// a schedule change, the most recently extracted one wins, while a
+// cancellation in any of them cancels the segment.
+func (s *Scheduler) schedule(reservations []extract.Reservation, cancelledByTag map[string]bool, now time.Time) []Reminder {
+	segments := map[string]extract.Reservation{}
+	cancelled := map[string]bool{}
+	var order []string
+	for _, res := range reservations {
+		key := segmentKey(res)
+		if res.Cancelled() || cancelledByTag[res.Type+"|"+res.Confirmation] {
+			cancelled[key] = true
+		}
+		if _, ok := segments[key]; !ok {
+			order = append(order, key)
+		}
+		if !res.Cancelled() {
+			segments[key] = res
+		} else if _, ok := segments[key]; !ok {
+			segments[key] = res
+		}
+	}
+
+	var reminders []Reminder
+	for _, key := range order {
+		res := segments[key]
+		for _, rule := range s.Rules {
+			if rule.Type != res.Type {
+				continue
+			}
+
+			eventAt, zone := res.StartAt, res.StartZone
+			if rule.Anchor == AnchorEnd {
+				eventAt, zone = res.EndAt, res.EndZone
+			}
+			if eventAt.IsZero() {
+				continue
+			}
+			instant := extract.Instant(eventAt, zone)
+
+			r := Reminder{
+				Key:          fmt.Sprintf("%s|%s|%d", key, rule.Name, eventAt.Unix()),
+				Rule:         rule.Name,
+				Message:      rule.Message,
+				Type:         res.Type,
+				MessageID:    res.MessageID,
+				Confirmation: res.Confirmation,
+				Name:         res.Name,
+				FireAt:       instant.Add(-rule.Lead),
+				EventAt:      eventAt,
+				EventZone:    zone,
+				Status:       StatusPending,
+			}
+			switch {
+			case !s.fired[r.Key].IsZero():
+				r.Status = StatusFired
+			case cancelled[key]:
+				r.Status = StatusCancelled
+			case !now.Before(instant):
+				r.Status = StatusMissed
+			}
+			reminders = append(reminders, r)
+		}
+	}
+
+	sort.Slice(reminders, func(i, j int) bool {
+		return reminders[i].FireAt.Before(reminders[j].FireAt)
+	})
+	return reminders
+}
+
+// save persists the fired reminders, forgetting ones old enough that they
+// can no longer come due again
+func (s *Scheduler) save(now time.Time) error {
+	for key, at := range s.fired {
+		if now.Sub(at) > firedRetention {
+			delete(s.fired, key)
+		}
+	}
+	return state.Save(stateFile, s.fired)
+}
+
+// segmentKey identifies a reservation segment across emails
+func segmentKey(res extract.Reservation) string {
+	id := res.Confirmation
+	if id == "" {
+		id = res.MessageID
+	}
+	return strings.Join([]string{res.Type, id, res.Name}, "|")
+}
@@ -0,0 +1,194 @@
+package saved
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zachatrocity/voyage/internal/notmuch"
+	"github.com/zachatrocity/voyage/internal/query"
+	"github.com/zachatrocity/voyage/internal/state"
+)
+
+const stateFile = "saved-searches.json"
+
+var (
+	// ErrNotFound is returned when a saved search does not exist
+	ErrNotFound = errors.New("saved search not found")
+	// ErrExists is returned when creating a saved search whose name is taken
+	ErrExists = errors.New("saved search already exists")
+	// ErrInvalid is wrapped by validation errors
+	ErrInvalid = errors.New("invalid saved search")
+)
+
+// namePattern keeps names safe to use as a URL path segment
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Search is a named notmuch query, such as a smart folder. The query is
+// written in the Xapian syntax unless Syntax is sexp.
+// @Description Saved search
+type Search struct {
+	Name      string    `json:"name" example:"unfiled-airline-confirmations"`
+	Query     string    `json:"query" example:"tag:travel and subject:confirmation and not tag:trip"`
+	Sort      string    `json:"sort" example:"newest_first"`
+	Syntax    string    `json:"syntax,omitempty" example:"xapian"`
+	Pinned    bool      `json:"pinned" example:"true"`
+	CreatedAt time.Time `json:"created_at" example:"2023-01-01T12:00:00Z"`
+	UpdatedAt time.Time `json:"updated_at" example:"2023-01-01T12:00:00Z"`
+}
+
+// Store keeps saved searches in a state file
+type Store struct {
+	mu       sync.Mutex
+	searches []Search
+}
+
+// NewStore loads the saved searches from the state directory
+func NewStore() (*Store, error) {
+	s := &Store{}
+	if err := state.Load(stateFile, &s.searches); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// List returns every saved search, pinned ones first, then by name
+func (s *Store) List() []Search {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	searches := make([]Search, len(s.searches))
+	copy(searches, s.searches)
+	sort.SliceStable(searches, func(i, j int) bool {
+		if searches[i].Pinned != searches[j].Pinned {
+			return searches[i].Pinned
+		}
+		return searches[i].Name < searches[j].Name
+	})
+	return searches
+}
+
+// Get returns the saved search with the given name
+func (s *Store) Get(name string) (*Search, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.index(name); i >= 0 {
+		search := s.searches[i]
+		return &search, nil
+	}
+	return nil, ErrNotFound
+}
+
+// Create validates and stores a new saved search
+func (s *Store) Create(search Search) (*Search, error) {
+	if err := validate(search); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.index(search.Name) >= 0 {
+		return nil, ErrExists
+	}
+
+	search.CreatedAt = time.Now().UTC()
+	search.UpdatedAt = search.CreatedAt
+	searches := append(s.searches[:len(s.searches):len(s.searches)], search)
+	if err := state.Save(stateFile, searches); err != nil {
+		return nil, err
+	}
+	s.searches = searches
+
+	return &search, nil
+}
+
+// Update replaces the query, sort and pinned flag of a saved search. The
+// search may be renamed by giving it a new name.
+func (s *Store) Update(name string, search Search) (*Search, error) {
+	if err := validate(search); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(name)
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	if search.Name != name && s.index(search.Name) >= 0 {
+		return nil, ErrExists
+	}
+
+	search.CreatedAt = s.searches[i].CreatedAt
+	search.UpdatedAt = time.Now().UTC()
+	searches := make([]Search, len(s.searches))
+	copy(searches, s.searches)
+	searches[i] = search
+	if err := state.Save(stateFile, searches); err != nil {
+		return nil, err
+	}
+	s.searches = searches
+
+	return &search, nil
+}
+
+// Delete removes a saved search
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(name)
+	if i < 0 {
+		return ErrNotFound
+	}
+
+	searches := append(s.searches[:i:i], s.searches[i+1:]...)
+	if err := state.Save(stateFile, searches); err != nil {
+		return err
+	}
+	s.searches = searches
+	return nil
+}
+
+// index returns the position of the named search, or -1
+func (s *Store) index(name string) int {
+	for i, search := range s.searches {
+		if search.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// validate checks the fields of a saved search
+func validate(search Search) error {
+	if !namePattern.MatchString(search.Name) {
+		return fmt.Errorf("%w: name %q must be up to 64 letters, digits, '.', '_' or '-'", ErrInvalid, search.Name)
+	}
+	if search.Query == "" {
+		return fmt.Errorf("%w: query is required", ErrInvalid)
+	}
+	syntax, err := notmuch.ParseSyntax(search.Syntax)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalid, err)
+	}
+	report := query.Validate(search.Query)
+	if syntax == notmuch.SyntaxSexp {
+		report = query.ValidateSexp(search.Query)
+	}
+	if !report.Valid {
+		return fmt.Errorf("%w: query %s", ErrInvalid, report.Errors[0])
+	}
+	switch search.Sort {
+	case "", "newest_first", "oldest_first":
+	default:
+		return fmt.Errorf("%w: sort %q must be newest_first or oldest_first", ErrInvalid, search.Sort)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/zachatrocity/voyage/internal/notmuch"
+)
+
+// Dir overrides the directory returned by GetStateDir
+var Dir string
+
+// GetStateDir returns the directory where Voyage keeps its small state files.
+// By default this lives inside the notmuch database directory so it is
+// persisted alongside the index without needing another volume.
+func GetStateDir() string {
+	if Dir != "" {
+		return Dir
+	}
+
+	// Default to <database>/.notmuch/voyage, which notmuch new never scans
+	return filepath.Join(notmuch.GetDatabasePath(), ".notmuch", "voyage")
+}
+
+// Load decodes the named state file into v. A missing file is not an error
+// and leaves v untouched.
+func Load(name string, v interface{}) error {
+	data, err := os.ReadFile(filepath.Join(GetStateDir(), name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state file %s: %w", name, err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode state file %s: %w", name, err)
+	}
+	return nil
+}
+
+// Save encodes v into the named state file. The file is written to a
+// temporary location first and renamed into place so readers never see a
+// partially written file.
+func Save(name string, v interface{}) error {
+	dir := GetStateDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state file %s: %w", name, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create state file %s: %w", name, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write state file %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write state file %s: %w", name, err)
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return fmt.Errorf("failed to replace state file %s: %w", name, err)
+	}
+	return nil
+}
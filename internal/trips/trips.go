@@ -0,0 +1,192 @@
+package trips
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zachatrocity/voyage/internal/extract"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+	"github.com/zachatrocity/voyage/internal/query"
+)
+
+// TagPrefix starts the tag that files an email under a trip, as in
+// trip/lisbon-2024
+const TagPrefix = "trip/"
+
+var (
+	// ErrNotFound is returned when no email is filed under a trip
+	ErrNotFound = errors.New("trip not found")
+	// ErrExists is returned when creating a trip whose name is taken
+	ErrExists = errors.New("trip already exists")
+	// ErrInvalid is wrapped by validation errors
+	ErrInvalid = errors.New("invalid trip")
+)
+
+// namePattern keeps names safe to use as a tag and URL path segment
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Trip is a set of emails filed under the same trip tag
+// @Description Trip
+type Trip struct {
+	Name  string `json:"name" example:"lisbon-2024"`
+	Tag   string `json:"tag" example:"trip/lisbon-2024"`
+	Count int    `json:"count" example:"7"`
+	// StartAt and EndAt span the reservations extracted from the emails
+	StartAt *time.Time `json:"start_at,omitempty" example:"2024-05-01T08:00:00-07:00"`
+	EndAt   *time.Time `json:"end_at,omitempty" example:"2024-05-08T11:00:00+01:00"`
+	// Emails and Reservations are only filled in by Get
+	Emails       []notmuch.EmailResult `json:"emails,omitempty"`
+	Reservations []extract.Reservation `json:"reservations,omitempty"`
+}
+
+// Tag returns the tag of the named trip
+func Tag(name string) string {
+	return TagPrefix + name
+}
+
+// Query returns the notmuch query matching the emails of the named trip
+func Query(name string) string {
+	return "tag:" + query.Quote(Tag(name))
+}
+
+// List returns every trip with its email count
+func List() ([]Trip, error) {
+	tags, err := notmuch.AllTags(TagPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	trips := []Trip{}
+	for _, tag := range tags {
+		name := strings.TrimPrefix(tag, TagPrefix)
+		count, err := notmuch.CountMessages(Query(name))
+		if err != nil {
+			return nil, err
+		}
+		trips = append(trips, Trip{Name: name, Tag: tag, Count: count})
+	}
+
+	return trips, nil
+}
+
+// Get returns a trip with its emails and the reservations stored on them
+func Get(ctx context.Context, name string) (*Trip, error) {
+	emails, err := notmuch.SearchAll(ctx, Query(name))
+	if err != nil {
+		return nil, err
+	}
+	if len(emails) == 0 {
+		return nil, ErrNotFound
+	}
+
+	trip := &Trip{
+		Name:         name,
+		Tag:          Tag(name),
+		Count:        len(emails),
+		Emails:       emails,
+		Reservations: []extract.Reservation{},
+	}
+	for _, email := range emails {
+		reservations, _, err := extract.Stored(email.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		trip.Reservations = append(trip.Reservations, reservations...)
+	}
+
+	for _, res := range trip.Reservations {
+		if res.Cancelled() {
+			continue
+		}
+		if start := res.StartAt; !start.IsZero() && (trip.StartAt == nil || start.Before(*trip.StartAt)) {
+			trip.StartAt = &start
+		}
+		if end := res.EndAt; !end.IsZero() && (trip.EndAt == nil || end.After(*trip.EndAt)) {
+			trip.EndAt = &end
+		}
+	}
+
+	return trip, nil
+}
+
+// Create files every email matching filter under a new trip. The emails are
+// tagged atomically, so either all of them or none end up in the trip.
+func Create(name string, filter string) (*Trip, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(filter) == "" {
+		return nil, fmt.Errorf("%w: query is required", ErrInvalid)
+	}
+	if report := query.Validate(filter); !report.Valid {
+		return nil, fmt.Errorf("%w: query %s", ErrInvalid, report.Errors[0])
+	}
+
+	// The trip is checked for in the same transaction that creates it, so
+	// two requests can not both create it. Emails tagged deleted or spam
+	// still make a trip exist.
+	var count int
+	err := notmuch.WithAtomic(func(tx *notmuch.Tx) error {
+		existing, err := tx.CountMessages(Query(name), notmuch.QueryOptions{Syntax: notmuch.SyntaxXapian})
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrExists
+		}
+
+		count, err = tx.TagMessages(filter, []string{Tag(name)}, nil)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return fmt.Errorf("%w: query matches no email", ErrInvalid)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Trip{Name: name, Tag: Tag(name), Count: count}, nil
+}
+
+// Merge moves every email of trip from into trip into, atomically
+func Merge(into string, from string) (*Trip, error) {
+	if err := validateName(into); err != nil {
+		return nil, err
+	}
+	if from == into {
+		return nil, fmt.Errorf("%w: can not merge a trip into itself", ErrInvalid)
+	}
+
+	var count int
+	err := notmuch.WithAtomic(func(tx *notmuch.Tx) error {
+		moved, err := tx.TagMessages(Query(from), []string{Tag(into)}, []string{Tag(from)})
+		if err != nil {
+			return err
+		}
+		if moved == 0 {
+			return ErrNotFound
+		}
+		count, err = tx.CountMessages(Query(into), notmuch.DefaultQueryOptions())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Trip{Name: into, Tag: Tag(into), Count: count}, nil
+}
+
+// validateName checks that a trip name is usable as a tag
+func validateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("%w: name %q must be up to 64 letters, digits, '.', '_' or '-'", ErrInvalid, name)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Package version reports the build of the running binary
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Version is the release, set at build time with
+//
+//	-ldflags "-X github.com/zachatrocity/voyage/internal/version.Version=v1.2.0"
+//
+// When empty the module version recorded by the go command is used, which
+// is (devel) for builds of a checkout.
+var Version string
+
+// Info describes the build of the running binary
+// @Description Build information
+type Info struct {
+	Version string `json:"version" example:"v1.2.0"`
+	// Revision is the commit the binary was built from, when built from a
+	// git checkout
+	Revision string `json:"revision,omitempty" example:"5d98646f0c1e2b3a4d5e6f708192a3b4c5d6e7f8"`
+	// Time is the commit time of Revision
+	Time string `json:"time,omitempty" example:"2024-05-01T12:00:00Z"`
+	// Modified reports uncommitted changes in the checkout
+	Modified  bool   `json:"modified,omitempty" example:"false"`
+	GoVersion string `json:"go_version" example:"go1.23.4"`
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get returns the build information of the running binary
+func Get() Info {
+	once.Do(func() {
+		info = Info{Version: Version, GoVersion: runtime.Version()}
+
+		bi, ok := debug.ReadBuildInfo()
+		if !ok {
+			if info.Version == "" {
+				info.Version = "unknown"
+			}
+			return
+		}
+		if info.Version == "" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Revision = s.Value
+			case "vcs.time":
+				info.Time = s.Value
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	})
+	return info
+}
@@ -0,0 +1,365 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zachatrocity/voyage/internal/events"
+	"github.com/zachatrocity/voyage/internal/notmuch"
+	"github.com/zachatrocity/voyage/internal/query"
+	"github.com/zachatrocity/voyage/internal/state"
+)
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body
+	SignatureHeader = "X-Voyage-Signature"
+	// EventHeader carries the type of the delivered event
+	EventHeader = "X-Voyage-Event"
+	// DeliveryHeader carries the unique ID of the delivery
+	DeliveryHeader = "X-Voyage-Delivery"
+
+	subscriptionsFile = "webhooks.json"
+	deliveriesFile    = "webhook-deliveries.json"
+
+	// maxDeliveriesPerWebhook bounds the persisted delivery log
+	maxDeliveriesPerWebhook = 100
+)
+
+// ErrNotFound is returned when a webhook subscription does not exist
+var ErrNotFound = errors.New("webhook not found")
+
+// Webhook is a subscription that receives travel events over HTTP
+// @Description Webhook subscription
+type Webhook struct {
+	ID        string    `json:"id" example:"6f1c2a9e4b7d3e10"`
+	URL       string    `json:"url" example:"https://chat.example.com/hooks/voyage"`
+	Secret    string    `json:"secret,omitempty" example:"s3cr3t"`
+	Events    []string  `json:"events" example:"email.tagged"`
+	Query     string    `json:"query,omitempty" example:"tag:flight"`
+	CreatedAt time.Time `json:"created_at" example:"2023-01-01T12:00:00Z"`
+}
+
+// Delivery records a single attempt to deliver an event to a webhook
+// @Description Webhook delivery attempt
+type Delivery struct {
+	ID         string    `json:"id" example:"0c9d8e7f6a5b4c3d"`
+	WebhookID  string    `json:"webhook_id" example:"6f1c2a9e4b7d3e10"`
+	EventID    string    `json:"event_id" example:"1a2b3c4d5e6f7a8b"`
+	EventType  string    `json:"event_type" example:"email.tagged"`
+	Attempt    int       `json:"attempt" example:"1"`
+	StatusCode int       `json:"status_code,omitempty" example:"200"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success" example:"true"`
+	Duration   string    `json:"duration" example:"120ms"`
+	Timestamp  time.Time `json:"timestamp" example:"2023-01-01T12:00:00Z"`
+}
+
+// MatchFunc reports whether the message with the given ID matches query
+type MatchFunc func(messageID string, query string) (bool, error)
+
+// Service manages webhook subscriptions and delivers events to them
+type Service struct {
+	// Client is used to POST events to subscribers
+	Client *http.Client
+	// Match filters events by the subscription's notmuch query
+	Match MatchFunc
+	// MaxAttempts is the number of delivery attempts before giving up
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled on every attempt
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries
+	MaxBackoff time.Duration
+
+	mu         sync.Mutex
+	webhooks   []Webhook
+	deliveries map[string][]Delivery
+	wg         sync.WaitGroup
+	stop       chan struct{}
+	// closed is set by Close, after which events are dropped
+	closed bool
+}
+
+// NewService creates a webhook service and loads the persisted subscriptions
+// and delivery log from the state directory
+func NewService() (*Service, error) {
+	s := &Service{
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Match:       notmuch.MatchesQuery,
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+		MaxBackoff:  5 * time.Minute,
+		deliveries:  map[string][]Delivery{},
+		stop:        make(chan struct{}),
+	}
+
+	if err := state.Load(subscriptionsFile, &s.webhooks); err != nil {
+		return nil, err
+	}
+	if err := state.Load(deliveriesFile, &s.deliveries); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// List returns all webhook subscriptions
+func (s *Service) List() []Webhook {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	webhooks := make([]Webhook, len(s.webhooks))
+	copy(webhooks, s.webhooks)
+	return webhooks
+}
+
+// Get returns the webhook subscription with the given ID
+func (s *Service) Get(id string) (*Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, w := range s.webhooks {
+		if w.ID == id {
+			return &w, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Create validates and stores a new webhook subscription
+func (s *Service) Create(w Webhook) (*Webhook, error) {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url: %q", w.URL)
+	}
+	if report := query.Validate(w.Query); !report.Valid {
+		return nil, fmt.Errorf("invalid webhook query: %s", report.Errors[0])
+	}
+
+	w.ID = events.NewID()
+	w.CreatedAt = time.Now().UTC()
+	if w.Events == nil {
+		w.Events = []string{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.webhooks = append(s.webhooks, w)
+	if err := state.Save(subscriptionsFile, s.webhooks); err != nil {
+		s.webhooks = s.webhooks[:len(s.webhooks)-1]
+		return nil, err
+	}
+
+	return &w, nil
+}
+
+// Delete removes a webhook subscription and its delivery log
+func (s *Service) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, w := range s.webhooks {
+		if w.ID != id {
+			continue
+		}
+
+		s.webhooks = append(s.webhooks[:i:i], s.webhooks[i+1:]...)
+		delete(s.deliveries, id)
+		if err := state.Save(subscriptionsFile, s.webhooks); err != nil {
+			return err
+		}
+		return state.Save(deliveriesFile, s.deliveries)
+	}
+	return ErrNotFound
+}
+
+// Deliveries returns the delivery log of a webhook, newest first
+func (s *Service) Deliveries(id string) ([]Delivery, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := s.deliveries[id]
+	deliveries := make([]Delivery, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, entries[i])
+	}
+	return deliveries, nil
+}
+
+// HandleEvent delivers an event to every matching subscription. Deliveries
+// run in the background; use Close to wait for them to finish. Events
+// handled after Close are dropped.
+func (s *Service) HandleEvent(e events.Event) {
+	// Deliveries are counted under the lock, so Close never waits while
+	// more are being added
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	var subscribers []Webhook
+	for _, w := range s.webhooks {
+		if w.wantsEvent(e.Type) {
+			subscribers = append(subscribers, w)
+		}
+	}
+	s.wg.Add(len(subscribers))
+	s.mu.Unlock()
+
+	for _, w := range subscribers {
+		go func(w Webhook) {
+			defer s.wg.Done()
+
+			if w.Query != "" && e.MessageID != "" {
+				ok, err := s.Match(e.MessageID, w.Query)
+				if err != nil {
+					slog.Warn("Failed to evaluate webhook query", "webhook_id", w.ID, "query", w.Query, "event_id", e.ID, "error", err)
+					return
+				}
+				if !ok {
+					return
+				}
+			}
+
+			s.deliver(w, e)
+		}(w)
+	}
+}
+
+// Close stops pending retries and waits for in-flight deliveries. Calling
+// it again is harmless.
+func (s *Service) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// wantsEvent reports whether the subscription accepts the event type
+func (w Webhook) wantsEvent(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, t := range w.Events {
+		if t == "*" || t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver POSTs the event to the webhook, retrying with exponential backoff
+func (s *Service) deliver(w Webhook, e events.Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("Failed to encode webhook event", "webhook_id", w.ID, "event_id", e.ID, "error", err)
+		return
+	}
+
+	backoff := s.Backoff
+	for attempt := 1; attempt <= s.MaxAttempts; attempt++ {
+		d := s.attempt(w, e, body, attempt)
+		s.record(d)
+		if d.Success {
+			return
+		}
+
+		if attempt == s.MaxAttempts {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+		case <-s.stop:
+			return
+		}
+		backoff *= 2
+		if backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+	}
+
+	slog.Warn("Giving up on webhook delivery", "webhook_id", w.ID, "event_id", e.ID, "attempts", s.MaxAttempts)
+}
+
+// attempt performs a single signed delivery
+func (s *Service) attempt(w Webhook, e events.Event, body []byte, attempt int) Delivery {
+	d := Delivery{
+		ID:        events.NewID(),
+		WebhookID: w.ID,
+		EventID:   e.ID,
+		EventType: e.Type,
+		Attempt:   attempt,
+		Timestamp: time.Now().UTC(),
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, e.Type)
+	req.Header.Set(DeliveryHeader, d.ID)
+	req.Header.Set("X-Voyage-Attempt", strconv.Itoa(attempt))
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	}
+
+	start := time.Now()
+	resp, err := s.Client.Do(req)
+	d.Duration = time.Since(start).Round(time.Millisecond).String()
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	resp.Body.Close()
+
+	d.StatusCode = resp.StatusCode
+	d.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !d.Success {
+		d.Error = "unexpected status: " + resp.Status
+	}
+	return d
+}
+
+// record appends a delivery to the persisted log
+func (s *Service) record(d Delivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := append(s.deliveries[d.WebhookID], d)
+	if len(entries) > maxDeliveriesPerWebhook {
+		entries = entries[len(entries)-maxDeliveriesPerWebhook:]
+	}
+	s.deliveries[d.WebhookID] = entries
+
+	if err := state.Save(deliveriesFile, s.deliveries); err != nil {
+		slog.Error("Failed to persist webhook delivery log", "webhook_id", d.WebhookID, "error", err)
+	}
+}
+
+// Sign returns the signature header value for body: "sha256=" followed by
+// the hex encoded HMAC-SHA256 of the body keyed with the webhook secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,408 @@
+package webhooks_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/zachatrocity/voyage/internal/api/handlers"
+	"github.com/zachatrocity/voyage/internal/events"
+	"github.com/zachatrocity/voyage/internal/state"
+	"github.com/zachatrocity/voyage/internal/webhooks"
+)
+
+// receiver is a local webhook endpoint recording every request it gets
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []received
+	// statuses are answered in order; once used up every request gets 200
+	statuses []int
+}
+
+// received is a request seen by the receiver
+type received struct {
+	header http.Header
+	body   []byte
+	at     time.Time
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	t.Helper()
+
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		r.mu.Lock()
+		r.requests = append(r.requests, received{header: req.Header.Clone(), body: body, at: time.Now()})
+		status := http.StatusOK
+		if len(r.statuses) > 0 {
+			status, r.statuses = r.statuses[0], r.statuses[1:]
+		}
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) received() []received {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]received(nil), r.requests...)
+}
+
+// await waits for the receiver to get n requests. Close stops pending
+// retries, so tests of retries wait before closing the service.
+func (r *receiver) await(t *testing.T, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(r.received()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("receiver got %d requests, want %d", len(r.received()), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newService returns a service keeping its state in a temporary directory,
+// with short retry delays and a query filter that must not be reached
+func newService(t *testing.T) *webhooks.Service {
+	t.Helper()
+
+	state.Dir = t.TempDir()
+	t.Cleanup(func() { state.Dir = "" })
+
+	s, err := webhooks.NewService()
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	s.Backoff = 20 * time.Millisecond
+	s.MaxBackoff = 40 * time.Millisecond
+	s.Match = func(messageID string, query string) (bool, error) {
+		t.Errorf("unexpected query evaluation for %s", messageID)
+		return false, nil
+	}
+	return s
+}
+
+func create(t *testing.T, s *webhooks.Service, w webhooks.Webhook) *webhooks.Webhook {
+	t.Helper()
+
+	created, err := s.Create(w)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return created
+}
+
+func event(eventType string, messageID string) events.Event {
+	return events.Event{
+		ID:        events.NewID(),
+		Type:      eventType,
+		MessageID: messageID,
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+func TestDeliverySignature(t *testing.T) {
+	r := newReceiver(t)
+	s := newService(t)
+	create(t, s, webhooks.Webhook{URL: r.URL, Secret: "s3cr3t"})
+
+	e := event(events.TypeEmailTagged, "<1@example.com>")
+	s.HandleEvent(e)
+	s.Close()
+
+	got := r.received()
+	if len(got) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(got))
+	}
+	req := got[0]
+
+	mac := hmac.New(sha256.New, []byte("s3cr3t"))
+	mac.Write(req.body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if sig := req.header.Get(webhooks.SignatureHeader); sig != want {
+		t.Errorf("%s = %q, want %q", webhooks.SignatureHeader, sig, want)
+	}
+	if sig := webhooks.Sign("s3cr3t", req.body); sig != want {
+		t.Errorf("Sign = %q, want %q", sig, want)
+	}
+	if typ := req.header.Get(webhooks.EventHeader); typ != events.TypeEmailTagged {
+		t.Errorf("%s = %q, want %q", webhooks.EventHeader, typ, events.TypeEmailTagged)
+	}
+	if req.header.Get(webhooks.DeliveryHeader) == "" {
+		t.Errorf("%s is missing", webhooks.DeliveryHeader)
+	}
+
+	var delivered events.Event
+	if err := json.Unmarshal(req.body, &delivered); err != nil {
+		t.Fatalf("body is not an event: %v", err)
+	}
+	if delivered.ID != e.ID || delivered.MessageID != e.MessageID {
+		t.Errorf("delivered %+v, want %+v", delivered, e)
+	}
+}
+
+func TestDeliveryWithoutSecretIsUnsigned(t *testing.T) {
+	r := newReceiver(t)
+	s := newService(t)
+	create(t, s, webhooks.Webhook{URL: r.URL})
+
+	s.HandleEvent(event(events.TypeEmailTagged, ""))
+	s.Close()
+
+	got := r.received()
+	if len(got) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(got))
+	}
+	if sig := got[0].header.Get(webhooks.SignatureHeader); sig != "" {
+		t.Errorf("%s = %q, want none", webhooks.SignatureHeader, sig)
+	}
+}
+
+func TestDeliveryRetriesWithBackoff(t *testing.T) {
+	r := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+	s := newService(t)
+	w := create(t, s, webhooks.Webhook{URL: r.URL})
+
+	s.HandleEvent(event(events.TypeEmailTagged, ""))
+	r.await(t, 3)
+	s.Close()
+
+	got := r.received()
+	if len(got) != 3 {
+		t.Fatalf("receiver got %d requests, want 3", len(got))
+	}
+	// The delay doubles after every failure
+	for i, min := range []time.Duration{s.Backoff, 2 * s.Backoff} {
+		if gap := got[i+1].at.Sub(got[i].at); gap < min {
+			t.Errorf("retry %d came after %v, want at least %v", i+1, gap, min)
+		}
+	}
+
+	deliveries, err := s.Deliveries(w.ID)
+	if err != nil {
+		t.Fatalf("Deliveries: %v", err)
+	}
+	want := []struct {
+		attempt int
+		status  int
+		success bool
+	}{
+		{3, http.StatusOK, true},
+		{2, http.StatusBadGateway, false},
+		{1, http.StatusInternalServerError, false},
+	}
+	if len(deliveries) != len(want) {
+		t.Fatalf("got %d deliveries, want %d", len(deliveries), len(want))
+	}
+	for i, d := range deliveries {
+		if d.Attempt != want[i].attempt || d.StatusCode != want[i].status || d.Success != want[i].success {
+			t.Errorf("delivery %d = attempt %d, status %d, success %v; want %+v", i, d.Attempt, d.StatusCode, d.Success, want[i])
+		}
+	}
+}
+
+func TestDeliveryGivesUp(t *testing.T) {
+	r := newReceiver(t, 500, 500, 500, 500, 500)
+	s := newService(t)
+	s.MaxAttempts = 3
+	w := create(t, s, webhooks.Webhook{URL: r.URL})
+
+	s.HandleEvent(event(events.TypeEmailTagged, ""))
+	r.await(t, 3)
+	s.Close()
+
+	if got := len(r.received()); got != 3 {
+		t.Errorf("receiver got %d requests, want 3", got)
+	}
+	deliveries, _ := s.Deliveries(w.ID)
+	for _, d := range deliveries {
+		if d.Success {
+			t.Errorf("delivery %d succeeded", d.Attempt)
+		}
+	}
+}
+
+func TestEventTypeFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []string
+		want   bool
+	}{
+		{"all events", nil, true},
+		{"wildcard", []string{"*"}, true},
+		{"listed", []string{events.TypeReminderDue, events.TypeEmailTagged}, true},
+		{"not listed", []string{events.TypeReminderDue}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReceiver(t)
+			s := newService(t)
+			create(t, s, webhooks.Webhook{URL: r.URL, Events: tt.events})
+
+			s.HandleEvent(event(events.TypeEmailTagged, ""))
+			s.Close()
+
+			if got := len(r.received()) == 1; got != tt.want {
+				t.Errorf("delivered = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryFilter(t *testing.T) {
+	r := newReceiver(t)
+	s := newService(t)
+
+	var mu sync.Mutex
+	var queries []string
+	s.Match = func(messageID string, query string) (bool, error) {
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+		return messageID == "<flight@example.com>", nil
+	}
+	create(t, s, webhooks.Webhook{URL: r.URL, Query: "tag:flight"})
+
+	s.HandleEvent(event(events.TypeEmailTagged, "<flight@example.com>"))
+	s.HandleEvent(event(events.TypeEmailTagged, "<newsletter@example.com>"))
+	s.Close()
+
+	got := r.received()
+	if len(got) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(got))
+	}
+	var delivered events.Event
+	if err := json.Unmarshal(got[0].body, &delivered); err != nil {
+		t.Fatalf("body is not an event: %v", err)
+	}
+	if delivered.MessageID != "<flight@example.com>" {
+		t.Errorf("delivered event for %s", delivered.MessageID)
+	}
+	for _, q := range queries {
+		if q != "tag:flight" {
+			t.Errorf("matched against %q, want tag:flight", q)
+		}
+	}
+}
+
+func TestReservationExtracted(t *testing.T) {
+	r := newReceiver(t)
+	s := newService(t)
+	create(t, s, webhooks.Webhook{URL: r.URL, Events: []string{events.TypeReservationExtracted}})
+
+	extracted := event(events.TypeReservationExtracted, "<flight@example.com>")
+	extracted.Data = map[string]interface{}{
+		"type":         "flight",
+		"name":         "UA 123",
+		"confirmation": "ABC123",
+		"start_at":     "2024-05-01T08:00:00-07:00",
+	}
+	s.HandleEvent(event(events.TypeEmailTagged, "<flight@example.com>"))
+	s.HandleEvent(extracted)
+	s.Close()
+
+	got := r.received()
+	if len(got) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(got))
+	}
+	if typ := got[0].header.Get(webhooks.EventHeader); typ != events.TypeReservationExtracted {
+		t.Errorf("%s = %q, want %q", webhooks.EventHeader, typ, events.TypeReservationExtracted)
+	}
+	var delivered events.Event
+	if err := json.Unmarshal(got[0].body, &delivered); err != nil {
+		t.Fatalf("body is not an event: %v", err)
+	}
+	if delivered.MessageID != "<flight@example.com>" || delivered.Data["name"] != "UA 123" || delivered.Data["confirmation"] != "ABC123" {
+		t.Errorf("delivered %+v", delivered)
+	}
+}
+
+func TestEventsAfterCloseAreDropped(t *testing.T) {
+	r := newReceiver(t)
+	s := newService(t)
+	create(t, s, webhooks.Webhook{URL: r.URL})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.HandleEvent(event(events.TypeEmailTagged, ""))
+		}()
+	}
+	s.Close()
+	wg.Wait()
+	delivered := len(r.received())
+
+	s.HandleEvent(event(events.TypeEmailTagged, ""))
+	s.Close()
+	if got := len(r.received()); got != delivered {
+		t.Errorf("receiver got %d requests after Close, want %d", got, delivered)
+	}
+}
+
+func TestDeliveryLogIsPersistedAndServed(t *testing.T) {
+	r := newReceiver(t, http.StatusServiceUnavailable)
+	s := newService(t)
+	w := create(t, s, webhooks.Webhook{URL: r.URL, Secret: "s3cr3t"})
+
+	s.HandleEvent(event(events.TypeEmailTagged, ""))
+	r.await(t, 2)
+	s.Close()
+
+	// A new service reads the subscriptions and log back from disk
+	reloaded, err := webhooks.NewService()
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	defer reloaded.Close()
+
+	handlers.Webhooks = reloaded
+	defer func() { handlers.Webhooks = nil }()
+
+	e := echo.New()
+	e.GET("/webhooks/:id/deliveries", handlers.GetWebhookDeliveries)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/webhooks/"+w.ID+"/deliveries", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET deliveries = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	var deliveries []webhooks.Delivery
+	if err := json.Unmarshal(rec.Body.Bytes(), &deliveries); err != nil {
+		t.Fatalf("decode deliveries: %v", err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("got %d deliveries, want 2", len(deliveries))
+	}
+	if d := deliveries[0]; d.Attempt != 2 || !d.Success || d.WebhookID != w.ID {
+		t.Errorf("newest delivery = %+v, want a successful second attempt", d)
+	}
+	if d := deliveries[1]; d.Attempt != 1 || d.Success || d.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("oldest delivery = %+v, want a failed first attempt", d)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/webhooks/missing/deliveries", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET deliveries of a missing webhook = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,366 @@
+// Configuration: opening a database with the notmuch config file and
+// reading its settings
+
+package notmuch
+
+/*
+#include <stdlib.h>
+#include "notmuch.h"
+*/
+import "C"
+import (
+	"fmt"
+	"iter"
+	"runtime"
+	"unsafe"
+)
+
+type ConfigKey C.notmuch_config_key_t
+
+const (
+	CONFIG_DATABASE_PATH             ConfigKey = C.NOTMUCH_CONFIG_DATABASE_PATH
+	CONFIG_MAIL_ROOT                 ConfigKey = C.NOTMUCH_CONFIG_MAIL_ROOT
+	CONFIG_HOOK_DIR                  ConfigKey = C.NOTMUCH_CONFIG_HOOK_DIR
+	CONFIG_BACKUP_DIR                ConfigKey = C.NOTMUCH_CONFIG_BACKUP_DIR
+	CONFIG_EXCLUDE_TAGS              ConfigKey = C.NOTMUCH_CONFIG_EXCLUDE_TAGS
+	CONFIG_NEW_TAGS                  ConfigKey = C.NOTMUCH_CONFIG_NEW_TAGS
+	CONFIG_NEW_IGNORE                ConfigKey = C.NOTMUCH_CONFIG_NEW_IGNORE
+	CONFIG_SYNC_MAILDIR_FLAGS        ConfigKey = C.NOTMUCH_CONFIG_SYNC_MAILDIR_FLAGS
+	CONFIG_PRIMARY_EMAIL             ConfigKey = C.NOTMUCH_CONFIG_PRIMARY_EMAIL
+	CONFIG_OTHER_EMAIL               ConfigKey = C.NOTMUCH_CONFIG_OTHER_EMAIL
+	CONFIG_USER_NAME                 ConfigKey = C.NOTMUCH_CONFIG_USER_NAME
+	CONFIG_AUTOCOMMIT                ConfigKey = C.NOTMUCH_CONFIG_AUTOCOMMIT
+	CONFIG_EXTRA_HEADERS             ConfigKey = C.NOTMUCH_CONFIG_EXTRA_HEADERS
+	CONFIG_INDEX_AS_TEXT             ConfigKey = C.NOTMUCH_CONFIG_INDEX_AS_TEXT
+	CONFIG_AUTHORS_SEPARATOR         ConfigKey = C.NOTMUCH_CONFIG_AUTHORS_SEPARATOR
+	CONFIG_AUTHORS_MATCHED_SEPARATOR ConfigKey = C.NOTMUCH_CONFIG_AUTHORS_MATCHED_SEPARATOR
+)
+
+type ConfigValues struct {
+	values *C.notmuch_config_values_t
+	h      *handle
+}
+
+type ConfigPairs struct {
+	pairs *C.notmuch_config_pairs_t
+	h     *handle
+}
+
+func (self *ConfigValues) live() bool {
+	return self != nil && self.values != nil && self.h.live()
+}
+
+func (self *ConfigPairs) live() bool {
+	return self != nil && self.pairs != nil && self.h.live()
+}
+
+/* Return a C string for 's', or NULL when 's' is empty so libnotmuch
+ * falls back to its default. The caller frees the result. */
+func cStringOrNull(s string) *C.char {
+	if s == "" {
+		return nil
+	}
+	return C.CString(s)
+}
+
+/* Turn the status and error message of an open or load call into an
+ * error, freeing the message. The error unwraps to the status. */
+func openError(st Status, c_msg *C.char) error {
+	if c_msg == nil {
+		return st.Err()
+	}
+	defer C.free(unsafe.Pointer(c_msg))
+	if st == STATUS_SUCCESS {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", st, C.GoString(c_msg))
+}
+
+/* Open an existing notmuch database, reading the configuration from
+ * 'config_path' and the database itself.
+ *
+ * An empty 'database_path' takes the path from the configuration
+ * (database.path, or the NOTMUCH_DATABASE environment variable). An
+ * empty 'config_path' uses NOTMUCH_CONFIG if set, then
+ * $XDG_CONFIG_HOME/notmuch/<profile>/config, then
+ * $HOME/.notmuch-config. An empty 'profile' uses NOTMUCH_PROFILE or
+ * the default profile.
+ *
+ * The error carries the message reported by libnotmuch and unwraps to
+ * the status:
+ *
+ * NOTMUCH_STATUS_NO_CONFIG: No config file was found.
+ *
+ * NOTMUCH_STATUS_FILE_ERROR: An error occurred trying to open the
+ *	database or config file (such as permission denied, or file not
+ *	found, etc.), or the database version is unknown.
+ *
+ * NOTMUCH_STATUS_XAPIAN_EXCEPTION: A Xapian exception occurred.
+ *
+ * Since libnotmuch 5.4 (notmuch 0.32).
+ */
+func OpenDatabaseWithConfig(database_path string, mode DatabaseMode, config_path string, profile string) (*Database, error) {
+	c_path := cStringOrNull(database_path)
+	defer C.free(unsafe.Pointer(c_path))
+	c_config := cStringOrNull(config_path)
+	defer C.free(unsafe.Pointer(c_config))
+	c_profile := cStringOrNull(profile)
+	defer C.free(unsafe.Pointer(c_profile))
+
+	self := &Database{db: nil, h: &handle{}}
+	var c_msg *C.char
+	st := Status(C.notmuch_database_open_with_config(c_path, C.notmuch_database_mode_t(mode), c_config, c_profile, &self.db, &c_msg))
+	if err := openError(st, c_msg); err != nil {
+		return nil, err
+	}
+	runtime.SetFinalizer(self, (*Database).Close)
+	return self, nil
+}
+
+/* Load the configuration from the config file, the database and the
+ * defaults, without requiring either to exist. The arguments are as
+ * for OpenDatabaseWithConfig.
+ *
+ * Only the configuration of the returned database may be used. It is
+ * returned together with ErrNoConfig when no config file was loaded,
+ * and with ErrNoDatabase when no database was found; both are not
+ * fatal. For other errors no database is returned.
+ *
+ * Since libnotmuch 5.4 (notmuch 0.32).
+ */
+func LoadConfig(database_path string, config_path string, profile string) (*Database, error) {
+	c_path := cStringOrNull(database_path)
+	defer C.free(unsafe.Pointer(c_path))
+	c_config := cStringOrNull(config_path)
+	defer C.free(unsafe.Pointer(c_config))
+	c_profile := cStringOrNull(profile)
+	defer C.free(unsafe.Pointer(c_profile))
+
+	self := &Database{db: nil, h: &handle{}}
+	var c_msg *C.char
+	st := Status(C.notmuch_database_load_config(c_path, c_config, c_profile, &self.db, &c_msg))
+	err := openError(st, c_msg)
+	if self.db == nil {
+		if err == nil {
+			err = ErrNullPointer
+		}
+		return nil, err
+	}
+	runtime.SetFinalizer(self, (*Database).Close)
+	return self, err
+}
+
+/* Get a configuration value from an open database.
+ *
+ * This value reflects all configuration information given at the
+ * time the database was opened. An empty string is returned if 'key'
+ * is unknown or no value is known for it.
+ */
+func (self *Database) ConfigGet(key ConfigKey) string {
+	if !self.live() {
+		return ""
+	}
+	return C.GoString(C.notmuch_config_get(self.db, C.notmuch_config_key_t(key)))
+}
+
+/* Get a configuration value from an open database as a boolean.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_ILLEGAL_ARGUMENT: 'key' is unknown or the value
+ *	does not convert to a boolean.
+ */
+func (self *Database) ConfigGetBool(key ConfigKey) (bool, error) {
+	if !self.live() {
+		return false, ErrClosedDatabase
+	}
+	var val C.notmuch_bool_t
+	st := Status(C.notmuch_config_get_bool(self.db, C.notmuch_config_key_t(key), &val))
+	return val != 0, st.Err()
+}
+
+/* Return an iterator over the ';'-delimited list of values of 'key'.
+ *
+ * These values reflect all configuration information given at the
+ * time the database was opened.
+ *
+ * On error this function returns nil.
+ */
+func (self *Database) ConfigGetValues(key ConfigKey) *ConfigValues {
+	if !self.live() {
+		return nil
+	}
+	values := C.notmuch_config_get_values(self.db, C.notmuch_config_key_t(key))
+	if values == nil {
+		return nil
+	}
+	return &ConfigValues{values: values, h: self.child()}
+}
+
+/* Return an iterator over the ';'-delimited list of values of the
+ * configuration item named 'key', which need not be known to
+ * libnotmuch.
+ *
+ * On error this function returns nil.
+ */
+func (self *Database) ConfigGetValuesString(key string) *ConfigValues {
+	if !self.live() {
+		return nil
+	}
+	c_key := C.CString(key)
+	defer C.free(unsafe.Pointer(c_key))
+
+	values := C.notmuch_config_get_values_string(self.db, c_key)
+	if values == nil {
+		return nil
+	}
+	return &ConfigValues{values: values, h: self.child()}
+}
+
+/* Return an iterator over the (key, value) configuration pairs whose
+ * keys start with 'prefix'. Pass "" for all keys.
+ *
+ * On error this function returns nil.
+ */
+func (self *Database) ConfigGetPairs(prefix string) *ConfigPairs {
+	if !self.live() {
+		return nil
+	}
+	c_prefix := C.CString(prefix)
+	defer C.free(unsafe.Pointer(c_prefix))
+
+	pairs := C.notmuch_config_get_pairs(self.db, c_prefix)
+	if pairs == nil {
+		return nil
+	}
+	return &ConfigPairs{pairs: pairs, h: self.child()}
+}
+
+/* Return the path of the config file loaded, or an empty string if no
+ * config file was loaded.
+ */
+func (self *Database) ConfigPath() string {
+	if !self.live() {
+		return ""
+	}
+	return C.GoString(C.notmuch_config_path(self.db))
+}
+
+/* Is the given 'values' iterator pointing at a valid element. */
+func (self *ConfigValues) Valid() bool {
+	if !self.live() {
+		return false
+	}
+	return C.notmuch_config_values_valid(self.values) != 0
+}
+
+/* Get the current value from the 'values' iterator.
+ *
+ * Note: The returned string has the same lifetime as the iterator.
+ */
+func (self *ConfigValues) Get() string {
+	if !self.live() {
+		return ""
+	}
+	return C.GoString(C.notmuch_config_values_get(self.values))
+}
+
+/* Move the 'values' iterator to the next element. */
+func (self *ConfigValues) MoveToNext() {
+	if !self.live() {
+		return
+	}
+	C.notmuch_config_values_move_to_next(self.values)
+}
+
+/* Reset the 'values' iterator to the first element. */
+func (self *ConfigValues) Start() {
+	if !self.live() {
+		return
+	}
+	C.notmuch_config_values_start(self.values)
+}
+
+/* Return an iterator over the remaining values of 'values'. Call
+ * Start to range over them again. */
+func (self *ConfigValues) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for ; self.Valid(); self.MoveToNext() {
+			if !yield(self.Get()) {
+				return
+			}
+		}
+	}
+}
+
+/* Destroy a config values iterator, along with any associated
+ * resources. */
+func (self *ConfigValues) Destroy() {
+	if !self.live() {
+		return
+	}
+	C.notmuch_config_values_destroy(self.values)
+	self.values = nil
+	self.h.destroyed = true
+}
+
+/* Is the given 'pairs' iterator pointing at a valid element. */
+func (self *ConfigPairs) Valid() bool {
+	if !self.live() {
+		return false
+	}
+	return C.notmuch_config_pairs_valid(self.pairs) != 0
+}
+
+/* Move the 'pairs' iterator to the next element. */
+func (self *ConfigPairs) MoveToNext() {
+	if !self.live() {
+		return
+	}
+	C.notmuch_config_pairs_move_to_next(self.pairs)
+}
+
+/* Get the current key from the 'pairs' iterator.
+ *
+ * Note: The returned string has the same lifetime as the iterator.
+ */
+func (self *ConfigPairs) Key() string {
+	if !self.live() {
+		return ""
+	}
+	return C.GoString(C.notmuch_config_pairs_key(self.pairs))
+}
+
+/* Get the current value from the 'pairs' iterator.
+ *
+ * Note: The returned string has the same lifetime as the iterator.
+ */
+func (self *ConfigPairs) Value() string {
+	if !self.live() {
+		return ""
+	}
+	return C.GoString(C.notmuch_config_pairs_value(self.pairs))
+}
+
+/* Return an iterator over the remaining (key, value) pairs of 'pairs'.
+ * Like the underlying iterator it can only be ranged over once. */
+func (self *ConfigPairs) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for ; self.Valid(); self.MoveToNext() {
+			if !yield(self.Key(), self.Value()) {
+				return
+			}
+		}
+	}
+}
+
+/* Destroy a config pairs iterator, along with any associated
+ * resources. */
+func (self *ConfigPairs) Destroy() {
+	if !self.live() {
+		return
+	}
+	C.notmuch_config_pairs_destroy(self.pairs)
+	self.pairs = nil
+	self.h.destroyed = true
+}
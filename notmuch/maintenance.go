@@ -0,0 +1,95 @@
+// Database maintenance: upgrade and compaction
+
+package notmuch
+
+/*
+#include <stdlib.h>
+#include "notmuch.h"
+
+extern void goUpgradeProgress(void *closure, double progress);
+extern void goCompactStatus(char *message, void *closure);
+*/
+import "C"
+import (
+	"runtime/cgo"
+	"unsafe"
+)
+
+/* Upgrade the current database to the latest supported version.
+ *
+ * This ensures that all current notmuch functionality will be
+ * available on the database. After opening a database in read-write
+ * mode, it is recommended that clients check if an upgrade is needed
+ * (NeedsUpgrade) and if so, upgrade with this function before making
+ * any modifications. If NeedsUpgrade returns false, this will be a
+ * no-op.
+ *
+ * If 'progress' is not nil it is called periodically with a value in
+ * the range [0.0 .. 1.0] indicating the progress made so far.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_SUCCESS: Successfully upgraded the database.
+ *
+ * NOTMUCH_STATUS_READ_ONLY_DATABASE: Database was opened in read-only
+ *	mode so it cannot be upgraded.
+ *
+ * NOTMUCH_STATUS_XAPIAN_EXCEPTION: A Xapian exception occurred; the
+ *	database has not been upgraded.
+ */
+func (self *Database) Upgrade(progress func(float64)) error {
+	if !self.live() {
+		return ErrClosedDatabase
+	}
+	if progress == nil {
+		return Status(C.notmuch_database_upgrade(self.db, nil, nil)).Err()
+	}
+
+	// libnotmuch only calls back during the upgrade, so the handle does
+	// not outlive it
+	h := cgo.NewHandle(progress)
+	defer h.Delete()
+	return Status(C.notmuch_database_upgrade(self.db, (*[0]byte)(C.goUpgradeProgress), unsafe.Pointer(&h))).Err()
+}
+
+/* Compact the notmuch database at 'path', backing up the original
+ * database to 'backup_path'. An empty 'backup_path' discards the
+ * original once the compacted copy is in place.
+ *
+ * The database is opened in read-write mode during the compaction
+ * process to ensure no writes are made, so compaction fails while
+ * another writer holds the database.
+ *
+ * If 'status' is not nil it is called with diagnostic and
+ * informational messages.
+ */
+func Compact(path string, backup_path string, status func(string)) error {
+	c_path := C.CString(path)
+	defer C.free(unsafe.Pointer(c_path))
+
+	var c_backup *C.char
+	if backup_path != "" {
+		c_backup = C.CString(backup_path)
+		defer C.free(unsafe.Pointer(c_backup))
+	}
+
+	if status == nil {
+		return Status(C.notmuch_database_compact(c_path, c_backup, nil, nil)).Err()
+	}
+
+	h := cgo.NewHandle(status)
+	defer h.Delete()
+	return Status(C.notmuch_database_compact(c_path, c_backup, C.notmuch_compact_status_cb_t(C.goCompactStatus), unsafe.Pointer(&h))).Err()
+}
+
+//export goUpgradeProgress
+func goUpgradeProgress(closure unsafe.Pointer, progress C.double) {
+	fn := (*(*cgo.Handle)(closure)).Value().(func(float64))
+	fn(float64(progress))
+}
+
+//export goCompactStatus
+func goCompactStatus(message *C.char, closure unsafe.Pointer) {
+	fn := (*(*cgo.Handle)(closure)).Value().(func(string))
+	fn(C.GoString(message))
+}
@@ -11,7 +11,11 @@ package notmuch
 #include "notmuch.h"
 */
 import "C"
-import "unsafe"
+import (
+	"iter"
+	"runtime"
+	"unsafe"
+)
 
 // Status codes used for the return values of most functions
 type Status C.notmuch_status_t
@@ -28,6 +32,20 @@ const (
 	STATUS_TAG_TOO_LONG
 	STATUS_UNBALANCED_FREEZE_THAW
 	STATUS_UNBALANCED_ATOMIC
+	STATUS_UNSUPPORTED_OPERATION
+	STATUS_UPGRADE_REQUIRED
+	STATUS_PATH_ERROR
+	STATUS_IGNORED
+	STATUS_ILLEGAL_ARGUMENT
+	STATUS_MALFORMED_CRYPTO_PROTOCOL
+	STATUS_FAILED_CRYPTO_CONTEXT_CREATION
+	STATUS_UNKNOWN_CRYPTO_PROTOCOL
+	STATUS_NO_CONFIG
+	STATUS_NO_DATABASE
+	STATUS_DATABASE_EXISTS
+	STATUS_BAD_QUERY_SYNTAX
+	STATUS_NO_MAIL_ROOT
+	STATUS_CLOSED_DATABASE
 
 	STATUS_LAST_STATUS
 )
@@ -44,43 +62,183 @@ func (self Status) String() string {
 	return ""
 }
 
+/* Error makes every status other than STATUS_SUCCESS usable as an
+ * error, so callers can test for a specific failure with errors.Is.
+ */
+func (self Status) Error() string {
+	return self.String()
+}
+
+/* Return nil for STATUS_SUCCESS and the status as an error otherwise. */
+func (self Status) Err() error {
+	if self == STATUS_SUCCESS {
+		return nil
+	}
+	return self
+}
+
+/* Errors returned by the bindings, one per failing status. */
+var (
+	ErrOutOfMemory          error = STATUS_OUT_OF_MEMORY
+	ErrReadOnly             error = STATUS_READ_ONLY_DATABASE
+	ErrXapianException      error = STATUS_XAPIAN_EXCEPTION
+	ErrFileError            error = STATUS_FILE_ERROR
+	ErrFileNotEmail         error = STATUS_FILE_NOT_EMAIL
+	ErrDuplicateMessageID   error = STATUS_DUPLICATE_MESSAGE_ID
+	ErrNullPointer          error = STATUS_NULL_POINTER
+	ErrTagTooLong           error = STATUS_TAG_TOO_LONG
+	ErrUnbalancedFreezeThaw error = STATUS_UNBALANCED_FREEZE_THAW
+	ErrUnbalancedAtomic     error = STATUS_UNBALANCED_ATOMIC
+	ErrUnsupportedOperation error = STATUS_UNSUPPORTED_OPERATION
+	ErrUpgradeRequired      error = STATUS_UPGRADE_REQUIRED
+	ErrPathError            error = STATUS_PATH_ERROR
+	ErrIgnored              error = STATUS_IGNORED
+	ErrIllegalArgument      error = STATUS_ILLEGAL_ARGUMENT
+	ErrNoConfig             error = STATUS_NO_CONFIG
+	ErrNoDatabase           error = STATUS_NO_DATABASE
+	ErrDatabaseExists       error = STATUS_DATABASE_EXISTS
+	ErrBadQuerySyntax       error = STATUS_BAD_QUERY_SYNTAX
+	ErrNoMailRoot           error = STATUS_NO_MAIL_ROOT
+	ErrClosedDatabase       error = STATUS_CLOSED_DATABASE
+)
+
+/* handle tracks whether a libnotmuch object may still be used.
+ *
+ * libnotmuch allocates every object under the one it was obtained
+ * from, and destroying an object frees everything allocated under it:
+ * closing the database frees its queries, destroying a query frees its
+ * messages, and so on. Each wrapper therefore points at the handle of
+ * its owner and is only live while none of its owners has been
+ * destroyed. This turns a second Destroy, or any use of an object
+ * whose owner is gone, into a no-op instead of a use after free.
+ *
+ * Handles also keep the Database reachable while any object obtained
+ * from it is, so its finalizer cannot close it underneath them.
+ */
+type handle struct {
+	owner     *handle
+	db        *Database
+	destroyed bool
+}
+
+/* Return a handle for an object owned by the object of 'self'. */
+func (self *handle) child() *handle {
+	return &handle{owner: self, db: self.db}
+}
+
+/* Report whether neither this object nor any of its owners has been
+ * destroyed. */
+func (self *handle) live() bool {
+	for h := self; h != nil; h = h.owner {
+		if h.destroyed {
+			return false
+		}
+	}
+	return true
+}
+
 /* Various opaque data types. For each notmuch_<foo>_t see the various
  * notmuch_<foo> functions below. */
 
 type Database struct {
 	db *C.notmuch_database_t
+	h  *handle
 }
 
 type Query struct {
 	query *C.notmuch_query_t
+	h     *handle
 }
 
 type Threads struct {
 	threads *C.notmuch_threads_t
+	h       *handle
 }
 
 type Thread struct {
 	thread *C.notmuch_thread_t
+	h      *handle
 }
 
 type Messages struct {
 	messages *C.notmuch_messages_t
+	h        *handle
 }
 
 type Message struct {
 	message *C.notmuch_message_t
+	h       *handle
 }
 
 type Tags struct {
 	tags *C.notmuch_tags_t
+	h    *handle
+}
+
+type Properties struct {
+	props *C.notmuch_message_properties_t
+	h     *handle
 }
 
 type Directory struct {
 	dir *C.notmuch_directory_t
+	h   *handle
 }
 
 type Filenames struct {
 	fnames *C.notmuch_filenames_t
+	h      *handle
+}
+
+type IndexOpts struct {
+	opts *C.notmuch_indexopts_t
+	h    *handle
+}
+
+/* Report whether the wrapped object may be used: it was obtained
+ * successfully and neither it nor any of its owners was destroyed. */
+func (self *Database) live() bool {
+	return self != nil && self.db != nil && self.h.live()
+}
+
+func (self *Query) live() bool {
+	return self != nil && self.query != nil && self.h.live()
+}
+
+func (self *Threads) live() bool {
+	return self != nil && self.threads != nil && self.h.live()
+}
+
+func (self *Thread) live() bool {
+	return self != nil && self.thread != nil && self.h.live()
+}
+
+func (self *Messages) live() bool {
+	return self != nil && self.messages != nil && self.h.live()
+}
+
+func (self *Message) live() bool {
+	return self != nil && self.message != nil && self.h.live()
+}
+
+func (self *Tags) live() bool {
+	return self != nil && self.tags != nil && self.h.live()
+}
+
+func (self *Properties) live() bool {
+	return self != nil && self.props != nil && self.h.live()
+}
+
+func (self *Directory) live() bool {
+	return self != nil && self.dir != nil && self.h.live()
+}
+
+func (self *Filenames) live() bool {
+	return self != nil && self.fnames != nil && self.h.live()
+}
+
+func (self *IndexOpts) live() bool {
+	return self != nil && self.opts != nil && self.h.live()
 }
 
 type DatabaseMode C.notmuch_database_mode_t
@@ -91,21 +249,22 @@ const (
 )
 
 // Create a new, empty notmuch database located at 'path'
-func NewDatabase(path string) (*Database, Status) {
+func NewDatabase(path string) (*Database, error) {
 
 	var c_path *C.char = C.CString(path)
 	defer C.free(unsafe.Pointer(c_path))
 
 	if c_path == nil {
-		return nil, STATUS_OUT_OF_MEMORY
+		return nil, ErrOutOfMemory
 	}
 
-	self := &Database{db: nil}
+	self := &Database{db: nil, h: &handle{}}
 	st := Status(C.notmuch_database_create(c_path, &self.db))
 	if st != STATUS_SUCCESS {
 		return nil, st
 	}
-	return self, st
+	runtime.SetFinalizer(self, (*Database).Close)
+	return self, nil
 }
 
 /* Open an existing notmuch database located at 'path'.
@@ -124,33 +283,57 @@ func NewDatabase(path string) (*Database, Status) {
  *
  * In case of any failure, this function returns NULL, (after printing
  * an error message on stderr).
+ *
+ * A database that is no longer referenced is closed by the garbage
+ * collector, but callers should still Close it as soon as they are
+ * done, since an open database may hold the write lock.
  */
-func OpenDatabase(path string, mode DatabaseMode) (*Database, Status) {
+func OpenDatabase(path string, mode DatabaseMode) (*Database, error) {
 
 	var c_path *C.char = C.CString(path)
 	defer C.free(unsafe.Pointer(c_path))
 
 	if c_path == nil {
-		return nil, STATUS_OUT_OF_MEMORY
+		return nil, ErrOutOfMemory
 	}
 
-	self := &Database{db: nil}
+	self := &Database{db: nil, h: &handle{}}
 	st := Status(C.notmuch_database_open(c_path, C.notmuch_database_mode_t(mode), &self.db))
 	if st != STATUS_SUCCESS {
 		return nil, st
 	}
-	return self, st
+	runtime.SetFinalizer(self, (*Database).Close)
+	return self, nil
 }
 
 /* Close the given notmuch database, freeing all associated
- * resources. See notmuch_database_open. */
-func (self *Database) Close() Status {
-	return Status(C.notmuch_database_destroy(self.db))
+ * resources. See notmuch_database_open.
+ *
+ * Every object obtained from the database becomes unusable. Closing a
+ * database more than once is harmless.
+ */
+func (self *Database) Close() error {
+	if !self.live() {
+		return nil
+	}
+	runtime.SetFinalizer(self, nil)
+	st := Status(C.notmuch_database_destroy(self.db))
+	self.db = nil
+	self.h.destroyed = true
+	return st.Err()
+}
+
+/* Return a handle for an object owned by the database. */
+func (self *Database) child() *handle {
+	return &handle{owner: self.h, db: self}
 }
 
 /* Return the database path of the given database.
  */
 func (self *Database) GetPath() string {
+	if !self.live() {
+		return ""
+	}
 
 	/* The return value is a string owned by notmuch so should not be
 	 * modified nor freed by the caller. */
@@ -164,9 +347,79 @@ func (self *Database) GetPath() string {
 
 /* Return the database format version of the given database. */
 func (self *Database) GetVersion() uint {
+	if !self.live() {
+		return 0
+	}
 	return uint(C.notmuch_database_get_version(self.db))
 }
 
+/* Begin an atomic database operation.
+ *
+ * Any modifications performed between a successful begin and an
+ * EndAtomic will be applied to the database atomically. Note that,
+ * unlike a typical database transaction, this only ensures atomicity,
+ * not durability; neither begin nor end necessarily flush
+ * modifications to disk.
+ *
+ * Atomic sections may be nested. BeginAtomic and EndAtomic must
+ * always be called in pairs. Closing the database inside an atomic
+ * section discards the changes made since the last commit.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_SUCCESS: Successfully entered atomic section.
+ *
+ * NOTMUCH_STATUS_XAPIAN_EXCEPTION: A Xapian exception occurred;
+ *	atomic section not entered.
+ */
+func (self *Database) BeginAtomic() error {
+	if !self.live() {
+		return ErrClosedDatabase
+	}
+	return Status(C.notmuch_database_begin_atomic(self.db)).Err()
+}
+
+/* Indicate the end of an atomic database operation.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_SUCCESS: Successfully completed atomic section.
+ *
+ * NOTMUCH_STATUS_XAPIAN_EXCEPTION: A Xapian exception occurred;
+ *	atomic section not ended.
+ *
+ * NOTMUCH_STATUS_UNBALANCED_ATOMIC: The database is not currently in
+ *	an atomic section.
+ */
+func (self *Database) EndAtomic() error {
+	if !self.live() {
+		return ErrClosedDatabase
+	}
+	return Status(C.notmuch_database_end_atomic(self.db)).Err()
+}
+
+/* Return the committed database revision and UUID.
+ *
+ * The database revision number increases monotonically with each
+ * commit to the database. Hence, all messages and message changes
+ * committed to the database (that is, visible to readers) have a last
+ * modification revision <= the committed database revision. Any
+ * messages committed in the future will be assigned a modification
+ * revision > the committed database revision.
+ *
+ * The UUID is an opaque string that uniquely identifies this
+ * database. Two revision numbers are only comparable if they have the
+ * same database UUID. */
+func (self *Database) GetRevision() (uint64, string) {
+	if !self.live() {
+		return 0, ""
+	}
+	var uuid *C.char
+	rev := C.notmuch_database_get_revision(self.db, &uuid)
+	// we don't own 'uuid'
+	return uint64(rev), C.GoString(uuid)
+}
+
 /* Does this database need to be upgraded before writing to it?
  *
  * If this function returns TRUE then no functions that modify the
@@ -174,6 +427,9 @@ func (self *Database) GetVersion() uint {
  * notmuch_directory_set_mtime, etc.) will work unless the function
  * notmuch_database_upgrade is called successfully first. */
 func (self *Database) NeedsUpgrade() bool {
+	if !self.live() {
+		return false
+	}
 	do_upgrade := C.notmuch_database_needs_upgrade(self.db)
 	if do_upgrade == 0 {
 		return false
@@ -191,20 +447,26 @@ func (self *Database) NeedsUpgrade() bool {
  *
  * Can return NULL if a Xapian exception occurs.
  */
-func (self *Database) GetDirectory(path string) (*Directory, Status) {
+func (self *Database) GetDirectory(path string) (*Directory, error) {
+	if !self.live() {
+		return nil, ErrClosedDatabase
+	}
 	var c_path *C.char = C.CString(path)
 	defer C.free(unsafe.Pointer(c_path))
 
 	if c_path == nil {
-		return nil, STATUS_OUT_OF_MEMORY
+		return nil, ErrOutOfMemory
 	}
 
 	var c_dir *C.notmuch_directory_t
 	st := Status(C.notmuch_database_get_directory(self.db, c_path, &c_dir))
-	if st != STATUS_SUCCESS || c_dir == nil {
+	if st != STATUS_SUCCESS {
 		return nil, st
 	}
-	return &Directory{dir: c_dir}, st
+	if c_dir == nil {
+		return nil, nil
+	}
+	return &Directory{dir: c_dir, h: self.child()}, nil
 }
 
 /* Add a new message to the given notmuch database.
@@ -246,19 +508,25 @@ func (self *Database) GetDirectory(path string) (*Directory, Status) {
  *
  * NOTMUCH_STATUS_READ_ONLY_DATABASE: Database was opened in read-only
  *	mode so no message can be added.
+ *
+ * As with libnotmuch, a usable message is returned along with
+ * ErrDuplicateMessageID.
  */
-func (self *Database) AddMessage(fname string) (*Message, Status) {
+func (self *Database) AddMessage(fname string) (*Message, error) {
+	if !self.live() {
+		return nil, ErrClosedDatabase
+	}
 	var c_fname *C.char = C.CString(fname)
 	defer C.free(unsafe.Pointer(c_fname))
 
 	if c_fname == nil {
-		return nil, STATUS_OUT_OF_MEMORY
+		return nil, ErrOutOfMemory
 	}
 
 	var c_msg *C.notmuch_message_t
 	st := Status(C.notmuch_database_add_message(self.db, c_fname, &c_msg))
 
-	return &Message{message: c_msg}, st
+	return &Message{message: c_msg, h: self.child()}, st.Err()
 }
 
 /* Remove a message from the given notmuch database.
@@ -285,17 +553,20 @@ func (self *Database) AddMessage(fname string) (*Message, Status) {
  * NOTMUCH_STATUS_READ_ONLY_DATABASE: Database was opened in read-only
  *	mode so no message can be removed.
  */
-func (self *Database) RemoveMessage(fname string) Status {
+func (self *Database) RemoveMessage(fname string) error {
+	if !self.live() {
+		return ErrClosedDatabase
+	}
 
 	var c_fname *C.char = C.CString(fname)
 	defer C.free(unsafe.Pointer(c_fname))
 
 	if c_fname == nil {
-		return STATUS_OUT_OF_MEMORY
+		return ErrOutOfMemory
 	}
 
 	st := C.notmuch_database_remove_message(self.db, c_fname)
-	return Status(st)
+	return Status(st).Err()
 }
 
 /* Find a message with the given message_id.
@@ -304,27 +575,65 @@ func (self *Database) RemoveMessage(fname string) Status {
  * a new notmuch_message_t object is returned. The caller should call
  * notmuch_message_destroy when done with the message.
  *
- * This function returns NULL in the following situations:
- *
- *	* No message is found with the given message_id
- *	* An out-of-memory situation occurs
- *	* A Xapian exception occurs
+ * If no message is found with the given message_id, this function
+ * returns a nil message and a nil error. An error is returned if an
+ * out-of-memory situation or a Xapian exception occurs.
  */
-func (self *Database) FindMessage(message_id string) (*Message, Status) {
+func (self *Database) FindMessage(message_id string) (*Message, error) {
+	if !self.live() {
+		return nil, ErrClosedDatabase
+	}
 
 	var c_msg_id *C.char = C.CString(message_id)
 	defer C.free(unsafe.Pointer(c_msg_id))
 
 	if c_msg_id == nil {
-		return nil, STATUS_OUT_OF_MEMORY
+		return nil, ErrOutOfMemory
 	}
 
-	msg := &Message{message: nil}
+	msg := &Message{message: nil, h: self.child()}
 	st := Status(C.notmuch_database_find_message(self.db, c_msg_id, &msg.message))
 	if st != STATUS_SUCCESS {
 		return nil, st
 	}
-	return msg, st
+	if msg.message == nil {
+		return nil, nil
+	}
+	return msg, nil
+}
+
+/* Find a message with the given filename.
+ *
+ * If the database contains a message with the given filename, then a
+ * new notmuch_message_t object is returned. The caller should call
+ * notmuch_message_destroy when done with the message.
+ *
+ * If no message is found with the given filename, this function
+ * returns a nil message and a nil error. An error is returned if an
+ * out-of-memory situation or a Xapian exception occurs, or with
+ * ErrUpgradeRequired when the database must be upgraded first.
+ */
+func (self *Database) FindMessageByFilename(filename string) (*Message, error) {
+	if !self.live() {
+		return nil, ErrClosedDatabase
+	}
+
+	var c_filename *C.char = C.CString(filename)
+	defer C.free(unsafe.Pointer(c_filename))
+
+	if c_filename == nil {
+		return nil, ErrOutOfMemory
+	}
+
+	msg := &Message{message: nil, h: self.child()}
+	st := Status(C.notmuch_database_find_message_by_filename(self.db, c_filename, &msg.message))
+	if st != STATUS_SUCCESS {
+		return nil, st
+	}
+	if msg.message == nil {
+		return nil, nil
+	}
+	return msg, nil
 }
 
 /* Return a list of all tags found in the database.
@@ -335,11 +644,32 @@ func (self *Database) FindMessage(message_id string) (*Message, Status) {
  * On error this function returns NULL.
  */
 func (self *Database) GetAllTags() *Tags {
+	if !self.live() {
+		return nil
+	}
 	tags := C.notmuch_database_get_all_tags(self.db)
 	if tags == nil {
 		return nil
 	}
-	return &Tags{tags: tags}
+	return &Tags{tags: tags, h: self.child()}
+}
+
+/* Get the current default indexing options for the database.
+ *
+ * The options survive until the database itself is closed, but the
+ * caller may also release them earlier with Destroy.
+ *
+ * Returns nil in case of error.
+ */
+func (self *Database) GetDefaultIndexOpts() *IndexOpts {
+	if !self.live() {
+		return nil
+	}
+	opts := C.notmuch_database_get_default_indexopts(self.db)
+	if opts == nil {
+		return nil
+	}
+	return &IndexOpts{opts: opts, h: self.child()}
 }
 
 /* Create a new query for 'database'.
@@ -367,6 +697,9 @@ func (self *Database) GetAllTags() *Tags {
  * Will return NULL if insufficient memory is available.
  */
 func (self *Database) CreateQuery(query string) *Query {
+	if !self.live() {
+		return nil
+	}
 
 	var c_query *C.char = C.CString(query)
 	defer C.free(unsafe.Pointer(c_query))
@@ -379,7 +712,47 @@ func (self *Database) CreateQuery(query string) *Query {
 	if q == nil {
 		return nil
 	}
-	return &Query{query: q}
+	return &Query{query: q, h: self.child()}
+}
+
+type QuerySyntax C.notmuch_query_syntax_t
+
+const (
+	QUERY_SYNTAX_XAPIAN QuerySyntax = iota
+	QUERY_SYNTAX_SEXP
+)
+
+/* Create a new query for 'database' written in the given syntax.
+ *
+ * Unlike CreateQuery, the query string is parsed immediately, so
+ * syntax errors are reported here.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_SUCCESS: query created.
+ *
+ * NOTMUCH_STATUS_BAD_QUERY_SYNTAX: the query string could not be
+ *	parsed.
+ *
+ * NOTMUCH_STATUS_ILLEGAL_ARGUMENT: the syntax is not supported, e.g.
+ *	sexp queries with a libnotmuch built without sfsexp.
+ */
+func (self *Database) CreateQueryWithSyntax(query string, syntax QuerySyntax) (*Query, error) {
+	if !self.live() {
+		return nil, ErrClosedDatabase
+	}
+	c_query := C.CString(query)
+	defer C.free(unsafe.Pointer(c_query))
+
+	var q *C.notmuch_query_t
+	st := Status(C.notmuch_query_create_with_syntax(self.db, c_query, C.notmuch_query_syntax_t(syntax), &q))
+	if st != STATUS_SUCCESS {
+		return nil, st
+	}
+	if q == nil {
+		return nil, ErrOutOfMemory
+	}
+	return &Query{query: q, h: self.child()}, nil
 }
 
 /* Sort values for notmuch_query_set_sort */
@@ -392,8 +765,24 @@ const (
 	SORT_UNSORTED
 )
 
+type Exclude C.notmuch_exclude_t
+
+/* Exclude values for SetOmitExcluded. The strange order is to maintain
+ * backward compatibility: the old FALSE/TRUE options correspond to
+ * the new EXCLUDE_FLAG/EXCLUDE_TRUE options.
+ */
+const (
+	EXCLUDE_FLAG Exclude = iota
+	EXCLUDE_TRUE
+	EXCLUDE_FALSE
+	EXCLUDE_ALL
+)
+
 /* Return the query_string of this query. See notmuch_query_create. */
 func (self *Query) String() string {
+	if !self.live() {
+		return ""
+	}
 	// FIXME: do we own 'q' or not ?
 	q := C.notmuch_query_get_query_string(self.query)
 	//defer C.free(unsafe.Pointer(q))
@@ -406,13 +795,61 @@ func (self *Query) String() string {
 	return ""
 }
 
+/* Specify whether to omit excluded results or simply flag them. By
+ * default, this is set to EXCLUDE_TRUE.
+ *
+ * If set to EXCLUDE_TRUE or EXCLUDE_ALL, SearchMessages will omit
+ * excluded messages from the results, and SearchThreads will omit
+ * threads that match only in excluded messages.
+ *
+ * If set to EXCLUDE_FALSE or EXCLUDE_FLAG then both SearchMessages
+ * and SearchThreads will return all matching messages/threads
+ * regardless of exclude status.
+ */
+func (self *Query) SetOmitExcluded(omit Exclude) {
+	if !self.live() {
+		return
+	}
+	C.notmuch_query_set_omit_excluded(self.query, C.notmuch_exclude_t(omit))
+}
+
+/* Add a tag that will be excluded from the query results by default.
+ * This exclusion will be ignored if this tag appears explicitly in
+ * the query.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_SUCCESS: excluded was added successfully.
+ *
+ * NOTMUCH_STATUS_XAPIAN_EXCEPTION: a Xapian exception occurred.
+ *	Most likely a problem lazily parsing the query string.
+ *
+ * NOTMUCH_STATUS_IGNORED: tag is explicitly present in the query, so
+ *	not excluded.
+ */
+func (self *Query) AddTagExclude(tag string) error {
+	if !self.live() {
+		return ErrNullPointer
+	}
+	c_tag := C.CString(tag)
+	defer C.free(unsafe.Pointer(c_tag))
+
+	return Status(C.notmuch_query_add_tag_exclude(self.query, c_tag)).Err()
+}
+
 /* Specify the sorting desired for this query. */
 func (self *Query) SetSort(sort Sort) {
+	if !self.live() {
+		return
+	}
 	C.notmuch_query_set_sort(self.query, C.notmuch_sort_t(sort))
 }
 
 /* Return the sort specified for this query. See notmuch_query_set_sort. */
 func (self *Query) GetSort() Sort {
+	if !self.live() {
+		return SORT_UNSORTED
+	}
 	return Sort(C.notmuch_query_get_sort(self.query))
 }
 
@@ -454,13 +891,16 @@ func (self *Query) GetSort() Sort {
  *
  * If a Xapian exception occurs this function will return NULL.
  */
-func (self *Query) SearchThreads() (*Threads, Status) {
+func (self *Query) SearchThreads() (*Threads, error) {
+	if !self.live() {
+		return nil, ErrNullPointer
+	}
 	var threads *C.notmuch_threads_t
 	st := Status(C.notmuch_query_search_threads(self.query, &threads))
 	if st != STATUS_SUCCESS {
 		return nil, st
 	}
-	return &Threads{threads: threads}, st
+	return &Threads{threads: threads, h: self.h.child()}, nil
 }
 
 /* Execute a query for messages, returning a notmuch_messages_t object
@@ -501,13 +941,16 @@ func (self *Query) SearchThreads() (*Threads, Status) {
  *
  * If a Xapian exception occurs this function will return NULL.
  */
-func (self *Query) SearchMessages() (*Messages, Status) {
+func (self *Query) SearchMessages() (*Messages, error) {
+	if !self.live() {
+		return nil, ErrNullPointer
+	}
 	var msgs *C.notmuch_messages_t
 	st := Status(C.notmuch_query_search_messages(self.query, &msgs))
 	if st != STATUS_SUCCESS {
 		return nil, st
 	}
-	return &Messages{messages: msgs}, st
+	return &Messages{messages: msgs, h: self.h.child()}, nil
 }
 
 /* Destroy a notmuch_query_t along with any associated resources.
@@ -519,9 +962,12 @@ func (self *Query) SearchMessages() (*Messages, Status) {
  * destroyed.
  */
 func (self *Query) Destroy() {
-	if self.query != nil {
-		C.notmuch_query_destroy(self.query)
+	if !self.live() {
+		return
 	}
+	C.notmuch_query_destroy(self.query)
+	self.query = nil
+	self.h.destroyed = true
 }
 
 /* Return an estimate of the number of messages matching a search
@@ -532,10 +978,41 @@ func (self *Query) Destroy() {
  * If a Xapian exception occurs, this function may return 0 (after
  * printing a message).
  */
-func (self *Query) CountMessages() (uint, Status) {
+func (self *Query) CountMessages() (uint, error) {
+	if !self.live() {
+		return 0, ErrNullPointer
+	}
 	var count C.uint
 	st := Status(C.notmuch_query_count_messages(self.query, &count))
-	return uint(count), st
+	return uint(count), st.Err()
+}
+
+/* Return the number of threads matching a search.
+ *
+ * This function performs a search and returns the number of unique
+ * thread IDs in the matching messages. This is the same as number of
+ * threads matching a search.
+ *
+ * Note that this is a significantly heavier operation than
+ * CountMessages.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_OUT_OF_MEMORY: Memory allocation failed. The value
+ *	of count is not defined
+ *
+ * NOTMUCH_STATUS_SUCCESS: query completed successfully.
+ *
+ * NOTMUCH_STATUS_XAPIAN_EXCEPTION: a Xapian exception occurred. The
+ *	value of count is not defined.
+ */
+func (self *Query) CountThreads() (uint, error) {
+	if !self.live() {
+		return 0, ErrNullPointer
+	}
+	var count C.uint
+	st := Status(C.notmuch_query_count_threads(self.query, &count))
+	return uint(count), st.Err()
 }
 
 /* Is the given 'threads' iterator pointing at a valid thread.
@@ -548,7 +1025,7 @@ func (self *Query) CountMessages() (uint, Status) {
  * code showing how to iterate over a notmuch_threads_t object.
  */
 func (self *Threads) Valid() bool {
-	if self.threads == nil {
+	if !self.live() {
 		return false
 	}
 	valid := C.notmuch_threads_valid(self.threads)
@@ -570,14 +1047,14 @@ func (self *Threads) Valid() bool {
  * NULL.
  */
 func (self *Threads) Get() *Thread {
-	if self.threads == nil {
+	if !self.live() {
 		return nil
 	}
 	thread := C.notmuch_threads_get(self.threads)
 	if thread == nil {
 		return nil
 	}
-	return &Thread{thread}
+	return &Thread{thread: thread, h: self.h.child()}
 }
 
 /* Move the 'threads' iterator to the next thread.
@@ -591,12 +1068,31 @@ func (self *Threads) Get() *Thread {
  * code showing how to iterate over a notmuch_threads_t object.
  */
 func (self *Threads) MoveToNext() {
-	if self.threads == nil {
+	if !self.live() {
 		return
 	}
 	C.notmuch_threads_move_to_next(self.threads)
 }
 
+/* Return an iterator over the remaining threads of 'threads'.
+ *
+ * The iterator advances 'threads' itself, so the results can only be
+ * ranged over once:
+ *
+ *     for thread := range threads.All() {
+ *         ....
+ *     }
+ */
+func (self *Threads) All() iter.Seq[*Thread] {
+	return func(yield func(*Thread) bool) {
+		for ; self.Valid(); self.MoveToNext() {
+			if thread := self.Get(); thread != nil && !yield(thread) {
+				return
+			}
+		}
+	}
+}
+
 /* Destroy a notmuch_threads_t object.
  *
  * It's not strictly necessary to call this function. All memory from
@@ -604,9 +1100,12 @@ func (self *Threads) MoveToNext() {
  * containing query object is destroyed.
  */
 func (self *Threads) Destroy() {
-	if self.threads != nil {
-		C.notmuch_threads_destroy(self.threads)
+	if !self.live() {
+		return
 	}
+	C.notmuch_threads_destroy(self.threads)
+	self.threads = nil
+	self.h.destroyed = true
 }
 
 /**
@@ -618,7 +1117,7 @@ func (self *Threads) Destroy() {
  * the query from which it derived is destroyed).
  */
 func (self *Thread) GetThreadId() string {
-	if self.thread == nil {
+	if !self.live() {
 		return ""
 	}
 	id := C.notmuch_thread_get_thread_id(self.thread)
@@ -635,7 +1134,7 @@ func (self *Thread) GetThreadId() string {
  * this thread. Contrast with notmuch_thread_get_matched_messages() .
  */
 func (self *Thread) GetTotalMessages() int {
-	if self.thread == nil {
+	if !self.live() {
 		return 0
 	}
 	return int(C.notmuch_thread_get_total_messages(self.thread))
@@ -651,16 +1150,16 @@ func (self *Thread) GetTotalMessages() int {
  *
  * The returned list will be destroyed when the thread is destroyed.
  */
-func (self *Thread) GetToplevelMessages() (*Messages, Status) {
-	if self.thread == nil {
-		return nil, STATUS_NULL_POINTER
+func (self *Thread) GetToplevelMessages() (*Messages, error) {
+	if !self.live() {
+		return nil, ErrNullPointer
 	}
 
 	msgs := C.notmuch_thread_get_toplevel_messages(self.thread)
 	if msgs == nil {
-		return nil, STATUS_NULL_POINTER
+		return nil, ErrNullPointer
 	}
-	return &Messages{msgs}, STATUS_SUCCESS
+	return &Messages{messages: msgs, h: self.h.child()}, nil
 }
 
 /**
@@ -669,16 +1168,16 @@ func (self *Thread) GetToplevelMessages() (*Messages, Status) {
  *
  * The returned list will be destroyed when the thread is destroyed.
  */
-func (self *Thread) GetMessages() (*Messages, Status) {
-	if self.thread == nil {
-		return nil, STATUS_NULL_POINTER
+func (self *Thread) GetMessages() (*Messages, error) {
+	if !self.live() {
+		return nil, ErrNullPointer
 	}
 
 	msgs := C.notmuch_thread_get_messages(self.thread)
 	if msgs == nil {
-		return nil, STATUS_NULL_POINTER
+		return nil, ErrNullPointer
 	}
-	return &Messages{msgs}, STATUS_SUCCESS
+	return &Messages{messages: msgs, h: self.h.child()}, nil
 }
 
 /**
@@ -691,7 +1190,7 @@ func (self *Thread) GetMessages() (*Messages, Status) {
  * notmuch_thread_get_total_messages() .
  */
 func (self *Thread) GetMatchedMessages() int {
-	if self.thread == nil {
+	if !self.live() {
 		return 0
 	}
 	return int(C.notmuch_thread_get_matched_messages(self.thread))
@@ -714,7 +1213,7 @@ func (self *Thread) GetMatchedMessages() int {
  * the query from which it derived is destroyed).
  */
 func (self *Thread) GetAuthors() string {
-	if self.thread == nil {
+	if !self.live() {
 		return ""
 	}
 	str := C.notmuch_thread_get_authors(self.thread)
@@ -737,7 +1236,7 @@ func (self *Thread) GetAuthors() string {
  * the query from which it derived is destroyed).
  */
 func (self *Thread) GetSubject() string {
-	if self.thread == nil {
+	if !self.live() {
 		return ""
 	}
 	str := C.notmuch_thread_get_subject(self.thread)
@@ -751,7 +1250,7 @@ func (self *Thread) GetSubject() string {
  * Get the date of the oldest message in 'thread' as a time_t value.
  */
 func (self *Thread) GetOldestDate() int64 {
-	if self.thread == nil {
+	if !self.live() {
 		return 0
 	}
 	date := C.notmuch_thread_get_oldest_date(self.thread)
@@ -763,7 +1262,7 @@ func (self *Thread) GetOldestDate() int64 {
  * Get the date of the newest message in 'thread' as a time_t value.
  */
 func (self *Thread) GetNewestDate() int64 {
-	if self.thread == nil {
+	if !self.live() {
 		return 0
 	}
 	date := C.notmuch_thread_get_newest_date(self.thread)
@@ -809,7 +1308,7 @@ func (self *Thread) GetNewestDate() int64 {
  * it if the message is about to be destroyed).
  */
 func (self *Thread) GetTags() *Tags {
-	if self.thread == nil {
+	if !self.live() {
 		return nil
 	}
 
@@ -818,16 +1317,19 @@ func (self *Thread) GetTags() *Tags {
 		return nil
 	}
 
-	return &Tags{tags}
+	return &Tags{tags: tags, h: self.h.child()}
 }
 
 /**
  * Destroy a notmuch_thread_t object.
  */
 func (self *Thread) Destroy() {
-	if self.thread != nil {
-		C.notmuch_thread_destroy(self.thread)
+	if !self.live() {
+		return
 	}
+	C.notmuch_thread_destroy(self.thread)
+	self.thread = nil
+	self.h.destroyed = true
 }
 
 /* Is the given 'messages' iterator pointing at a valid message.
@@ -840,7 +1342,7 @@ func (self *Thread) Destroy() {
  * code showing how to iterate over a notmuch_messages_t object.
  */
 func (self *Messages) Valid() bool {
-	if self.messages == nil {
+	if !self.live() {
 		return false
 	}
 	valid := C.notmuch_messages_valid(self.messages)
@@ -862,14 +1364,14 @@ func (self *Messages) Valid() bool {
  * NULL.
  */
 func (self *Messages) Get() *Message {
-	if self.messages == nil {
+	if !self.live() {
 		return nil
 	}
 	msg := C.notmuch_messages_get(self.messages)
 	if msg == nil {
 		return nil
 	}
-	return &Message{message: msg}
+	return &Message{message: msg, h: self.h.child()}
 }
 
 /* Move the 'messages' iterator to the next message.
@@ -883,12 +1385,31 @@ func (self *Messages) Get() *Message {
  * code showing how to iterate over a notmuch_messages_t object.
  */
 func (self *Messages) MoveToNext() {
-	if self.messages == nil {
+	if !self.live() {
 		return
 	}
 	C.notmuch_messages_move_to_next(self.messages)
 }
 
+/* Return an iterator over the remaining messages of 'messages'.
+ *
+ * The iterator advances 'messages' itself, so the results can only be
+ * ranged over once:
+ *
+ *     for message := range messages.All() {
+ *         ....
+ *     }
+ */
+func (self *Messages) All() iter.Seq[*Message] {
+	return func(yield func(*Message) bool) {
+		for ; self.Valid(); self.MoveToNext() {
+			if msg := self.Get(); msg != nil && !yield(msg) {
+				return
+			}
+		}
+	}
+}
+
 /* Destroy a notmuch_messages_t object.
  *
  * It's not strictly necessary to call this function. All memory from
@@ -896,9 +1417,12 @@ func (self *Messages) MoveToNext() {
  * query object is destroyed.
  */
 func (self *Messages) Destroy() {
-	if self.messages != nil {
-		C.notmuch_messages_destroy(self.messages)
+	if !self.live() {
+		return
 	}
+	C.notmuch_messages_destroy(self.messages)
+	self.messages = nil
+	self.h.destroyed = true
 }
 
 /* Return a list of tags from all messages.
@@ -914,14 +1438,14 @@ func (self *Messages) Destroy() {
  * The function returns NULL on error.
  */
 func (self *Messages) CollectTags() *Tags {
-	if self.messages == nil {
+	if !self.live() {
 		return nil
 	}
 	tags := C.notmuch_messages_collect_tags(self.messages)
 	if tags == nil {
 		return nil
 	}
-	return &Tags{tags: tags}
+	return &Tags{tags: tags, h: self.h.child()}
 }
 
 /* Get the message ID of 'message'.
@@ -937,7 +1461,7 @@ func (self *Messages) CollectTags() *Tags {
  */
 func (self *Message) GetMessageId() string {
 
-	if self.message == nil {
+	if !self.live() {
 		return ""
 	}
 	id := C.notmuch_message_get_message_id(self.message)
@@ -962,7 +1486,7 @@ func (self *Message) GetMessageId() string {
  */
 func (self *Message) GetThreadId() string {
 
-	if self.message == nil {
+	if !self.live() {
 		return ""
 	}
 	id := C.notmuch_message_get_thread_id(self.message)
@@ -994,14 +1518,47 @@ func (self *Message) GetThreadId() string {
  * value as legitimate, and simply return FALSE for it.)
  */
 func (self *Message) GetReplies() *Messages {
-	if self.message == nil {
+	if !self.live() {
 		return nil
 	}
 	msgs := C.notmuch_message_get_replies(self.message)
 	if msgs == nil {
 		return nil
 	}
-	return &Messages{messages: msgs}
+	return &Messages{messages: msgs, h: self.h.child()}
+}
+
+/* Get all filenames for the email corresponding to 'message'.
+ *
+ * Returns a Filenames iterator listing all the filenames associated
+ * with 'message'. These files may not have identical content, but
+ * each will have the identical Message-ID.
+ *
+ * Each filename in the iterator is an absolute filename, (the initial
+ * component will match notmuch_database_get_path() ).
+ *
+ * This function returns nil if it triggers a Xapian exception.
+ */
+func (self *Message) GetFileNames() *Filenames {
+	if !self.live() {
+		return nil
+	}
+	fnames := C.notmuch_message_get_filenames(self.message)
+	if fnames == nil {
+		return nil
+	}
+	return &Filenames{fnames: fnames, h: self.h.child()}
+}
+
+/* Get the total number of files associated with a message.
+ *
+ * Returns a non-negative file count, or a negative integer on error.
+ */
+func (self *Message) CountFiles() int {
+	if !self.live() {
+		return -1
+	}
+	return int(C.notmuch_message_count_files(self.message))
 }
 
 /* Get a filename for the email corresponding to 'message'.
@@ -1019,7 +1576,7 @@ func (self *Message) GetReplies() *Messages {
  * filenames.
  */
 func (self *Message) GetFileName() string {
-	if self.message == nil {
+	if !self.live() {
 		return ""
 	}
 	fname := C.notmuch_message_get_filename(self.message)
@@ -1041,7 +1598,7 @@ const (
 
 /* Get a value of a flag for the email corresponding to 'message'. */
 func (self *Message) GetFlag(flag Flag) bool {
-	if self.message == nil {
+	if !self.live() {
 		return false
 	}
 	v := C.notmuch_message_get_flag(self.message, C.notmuch_message_flag_t(flag))
@@ -1053,7 +1610,7 @@ func (self *Message) GetFlag(flag Flag) bool {
 
 /* Set a value of a flag for the email corresponding to 'message'. */
 func (self *Message) SetFlag(flag Flag, value bool) {
-	if self.message == nil {
+	if !self.live() {
 		return
 	}
 	var v C.notmuch_bool_t = 0
@@ -1072,12 +1629,12 @@ func (self *Message) SetFlag(flag Flag, value bool) {
  * NOTMUCH_STATUS_NULL_POINTER: The 'message' argument is NULL
  *
  */
-func (self *Message) GetDate() (int64, Status) {
-	if self.message == nil {
-		return -1, STATUS_NULL_POINTER
+func (self *Message) GetDate() (int64, error) {
+	if !self.live() {
+		return -1, ErrNullPointer
 	}
 	timestamp := C.notmuch_message_get_date(self.message)
-	return int64(timestamp), STATUS_SUCCESS
+	return int64(timestamp), nil
 }
 
 /* Get the value of the specified header from 'message'.
@@ -1093,7 +1650,7 @@ func (self *Message) GetDate() (int64, Status) {
  * header line matching 'header'. Returns NULL if any error occurs.
  */
 func (self *Message) GetHeader(header string) string {
-	if self.message == nil {
+	if !self.live() {
 		return ""
 	}
 
@@ -1140,14 +1697,14 @@ func (self *Message) GetHeader(header string) string {
  * it if the message is about to be destroyed).
  */
 func (self *Message) GetTags() *Tags {
-	if self.message == nil {
+	if !self.live() {
 		return nil
 	}
 	tags := C.notmuch_message_get_tags(self.message)
 	if tags == nil {
 		return nil
 	}
-	return &Tags{tags: tags}
+	return &Tags{tags: tags, h: self.h.child()}
 }
 
 /* The longest possible tag value. */
@@ -1167,14 +1724,14 @@ const TAG_MAX = 200
  * NOTMUCH_STATUS_READ_ONLY_DATABASE: Database was opened in read-only
  *	mode so message cannot be modified.
  */
-func (self *Message) AddTag(tag string) Status {
-	if self.message == nil {
-		return STATUS_NULL_POINTER
+func (self *Message) AddTag(tag string) error {
+	if !self.live() {
+		return ErrNullPointer
 	}
 	c_tag := C.CString(tag)
 	defer C.free(unsafe.Pointer(c_tag))
 
-	return Status(C.notmuch_message_add_tag(self.message, c_tag))
+	return Status(C.notmuch_message_add_tag(self.message, c_tag)).Err()
 }
 
 /* Remove a tag from the given message.
@@ -1191,14 +1748,14 @@ func (self *Message) AddTag(tag string) Status {
  * NOTMUCH_STATUS_READ_ONLY_DATABASE: Database was opened in read-only
  *	mode so message cannot be modified.
  */
-func (self *Message) RemoveTag(tag string) Status {
-	if self.message == nil {
-		return STATUS_NULL_POINTER
+func (self *Message) RemoveTag(tag string) error {
+	if !self.live() {
+		return ErrNullPointer
 	}
 	c_tag := C.CString(tag)
 	defer C.free(unsafe.Pointer(c_tag))
 
-	return Status(C.notmuch_message_remove_tag(self.message, c_tag))
+	return Status(C.notmuch_message_remove_tag(self.message, c_tag)).Err()
 }
 
 /* Remove all tags from the given message.
@@ -1209,11 +1766,11 @@ func (self *Message) RemoveTag(tag string) Status {
  * NOTMUCH_STATUS_READ_ONLY_DATABASE: Database was opened in read-only
  *	mode so message cannot be modified.
  */
-func (self *Message) RemoveAllTags() Status {
-	if self.message == nil {
-		return STATUS_NULL_POINTER
+func (self *Message) RemoveAllTags() error {
+	if !self.live() {
+		return ErrNullPointer
 	}
-	return Status(C.notmuch_message_remove_all_tags(self.message))
+	return Status(C.notmuch_message_remove_all_tags(self.message)).Err()
 }
 
 /* Freeze the current state of 'message' within the database.
@@ -1256,11 +1813,11 @@ func (self *Message) RemoveAllTags() Status {
  * NOTMUCH_STATUS_READ_ONLY_DATABASE: Database was opened in read-only
  *	mode so message cannot be modified.
  */
-func (self *Message) Freeze() Status {
-	if self.message == nil {
-		return STATUS_NULL_POINTER
+func (self *Message) Freeze() error {
+	if !self.live() {
+		return ErrNullPointer
 	}
-	return Status(C.notmuch_message_freeze(self.message))
+	return Status(C.notmuch_message_freeze(self.message)).Err()
 }
 
 /* Thaw the current 'message', synchronizing any changes that may have
@@ -1283,12 +1840,262 @@ func (self *Message) Freeze() Status {
  *	number of calls to notmuch_message_freeze and
  *	notmuch_message_thaw.
  */
-func (self *Message) Thaw() Status {
-	if self.message == nil {
-		return STATUS_NULL_POINTER
+func (self *Message) Thaw() error {
+	if !self.live() {
+		return ErrNullPointer
 	}
 
-	return Status(C.notmuch_message_thaw(self.message))
+	return Status(C.notmuch_message_thaw(self.message)).Err()
+}
+
+/* Retrieve the value for a single property key.
+ *
+ * Returns the empty string when there is no such key. In the case of
+ * multiple values for the given key, the first one is retrieved.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_SUCCESS: No error occurred.
+ */
+func (self *Message) GetProperty(key string) (string, error) {
+	if !self.live() {
+		return "", ErrNullPointer
+	}
+	c_key := C.CString(key)
+	defer C.free(unsafe.Pointer(c_key))
+
+	var c_value *C.char
+	st := Status(C.notmuch_message_get_property(self.message, c_key, &c_value))
+	// we don't own 'c_value'
+	if c_value == nil {
+		return "", st.Err()
+	}
+	return C.GoString(c_value), st.Err()
+}
+
+/* Add a (key,value) pair to a message.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_ILLEGAL_ARGUMENT: 'key' may not contain an '=' character.
+ *
+ * NOTMUCH_STATUS_SUCCESS: No error occurred.
+ */
+func (self *Message) AddProperty(key, value string) error {
+	if !self.live() {
+		return ErrNullPointer
+	}
+	c_key := C.CString(key)
+	defer C.free(unsafe.Pointer(c_key))
+	c_value := C.CString(value)
+	defer C.free(unsafe.Pointer(c_value))
+
+	return Status(C.notmuch_message_add_property(self.message, c_key, c_value)).Err()
+}
+
+/* Remove a (key,value) pair from a message.
+ *
+ * It is not an error to remove a non-existent (key,value) pair.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_ILLEGAL_ARGUMENT: 'key' may not contain an '=' character.
+ *
+ * NOTMUCH_STATUS_SUCCESS: No error occurred.
+ */
+func (self *Message) RemoveProperty(key, value string) error {
+	if !self.live() {
+		return ErrNullPointer
+	}
+	c_key := C.CString(key)
+	defer C.free(unsafe.Pointer(c_key))
+	c_value := C.CString(value)
+	defer C.free(unsafe.Pointer(c_value))
+
+	return Status(C.notmuch_message_remove_property(self.message, c_key, c_value)).Err()
+}
+
+/* Remove all (key,value) pairs for 'key' from the given message. An
+ * empty 'key' removes the properties for all keys.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_READ_ONLY_DATABASE: Database was opened in read-only
+ *	mode so message cannot be modified.
+ *
+ * NOTMUCH_STATUS_SUCCESS: No error occurred.
+ */
+func (self *Message) RemoveAllProperties(key string) error {
+	if !self.live() {
+		return ErrNullPointer
+	}
+	if key == "" {
+		return Status(C.notmuch_message_remove_all_properties(self.message, nil)).Err()
+	}
+	c_key := C.CString(key)
+	defer C.free(unsafe.Pointer(c_key))
+
+	return Status(C.notmuch_message_remove_all_properties(self.message, c_key)).Err()
+}
+
+/* Remove all (prefix*,value) pairs from the given message. An empty
+ * 'prefix' removes all properties.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_READ_ONLY_DATABASE: Database was opened in read-only
+ *	mode so message cannot be modified.
+ *
+ * NOTMUCH_STATUS_SUCCESS: No error occurred.
+ */
+func (self *Message) RemoveAllPropertiesWithPrefix(prefix string) error {
+	if !self.live() {
+		return ErrNullPointer
+	}
+	if prefix == "" {
+		return Status(C.notmuch_message_remove_all_properties_with_prefix(self.message, nil)).Err()
+	}
+	c_prefix := C.CString(prefix)
+	defer C.free(unsafe.Pointer(c_prefix))
+
+	return Status(C.notmuch_message_remove_all_properties_with_prefix(self.message, c_prefix)).Err()
+}
+
+/* Get the properties for 'message', returning a Properties object
+ * which can be used to iterate over all properties.
+ *
+ * If 'exact' is true only properties named 'key' are returned,
+ * otherwise 'key' is treated as a key prefix.
+ *
+ * The Properties object is owned by the message and as such, will
+ * only be valid for as long as the message is valid, (which is until
+ * the query from which it derived is destroyed).
+ *
+ * Typical usage might be:
+ *
+ *     props := message.GetProperties("voyage.", false)
+ *     for key, value := range props.All() {
+ *         fmt.Println(key, value)
+ *     }
+ *     props.Destroy()
+ */
+func (self *Message) GetProperties(key string, exact bool) *Properties {
+	if !self.live() {
+		return nil
+	}
+	c_key := C.CString(key)
+	defer C.free(unsafe.Pointer(c_key))
+
+	c_exact := C.notmuch_bool_t(0)
+	if exact {
+		c_exact = 1
+	}
+	props := C.notmuch_message_get_properties(self.message, c_key, c_exact)
+	if props == nil {
+		return nil
+	}
+	return &Properties{props: props, h: self.h.child()}
+}
+
+/* Return the number of properties named 'key' belonging to the
+ * message.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_SUCCESS: successful count, possibly some other error.
+ */
+func (self *Message) CountProperties(key string) (uint, error) {
+	if !self.live() {
+		return 0, ErrNullPointer
+	}
+	c_key := C.CString(key)
+	defer C.free(unsafe.Pointer(c_key))
+
+	var count C.uint
+	st := Status(C.notmuch_message_count_properties(self.message, c_key, &count))
+	return uint(count), st.Err()
+}
+
+/* Add/remove tags according to maildir flags in the message filename(s).
+ *
+ * This function examines the filenames of 'message' for maildir
+ * flags, and adds or removes tags on 'message' as follows when these
+ * flags are present:
+ *
+ *	Flag	Action if present
+ *	----	-----------------
+ *	'D'	Adds the "draft" tag to the message
+ *	'F'	Adds the "flagged" tag to the message
+ *	'P'	Adds the "passed" tag to the message
+ *	'R'	Adds the "replied" tag to the message
+ *	'S'	Removes the "unread" tag from the message
+ *
+ * For each flag that is not present, the opposite action (add/remove)
+ * is performed for the corresponding tags.
+ *
+ * If there are multiple filenames associated with this message, the
+ * flag is considered present if it appears in one or more
+ * filenames. (That is, the flags from the multiple filenames are
+ * combined with the logical OR operator.)
+ */
+func (self *Message) MaildirFlagsToTags() error {
+	if !self.live() {
+		return ErrNullPointer
+	}
+	return Status(C.notmuch_message_maildir_flags_to_tags(self.message)).Err()
+}
+
+/* Rename message filename(s) to encode tags as maildir flags.
+ *
+ * Specifically, for each filename corresponding to this message:
+ *
+ * If the filename is not in a maildir directory, do nothing. (A
+ * maildir directory is determined as a directory named "new" or
+ * "cur".) Similarly, if the filename has invalid maildir info,
+ * (repeated or outof-ASCII-order flag characters after ":2,"), then
+ * do nothing.
+ *
+ * If the filename is in a maildir directory, rename the file so that
+ * its filename ends with the sequence ":2," followed by zero or more
+ * of the following single-character flags (in ASCII order):
+ *
+ *   * flag 'D' iff the message has the "draft" tag
+ *   * flag 'F' iff the message has the "flagged" tag
+ *   * flag 'P' iff the message has the "passed" tag
+ *   * flag 'R' iff the message has the "replied" tag
+ *   * flag 'S' iff the message does not have the "unread" tag
+ *
+ * Any existing flags unmentioned in the list above will be preserved
+ * in the renaming.
+ *
+ * Also, if this filename is in a directory named "new", rename it to
+ * be within the neighboring directory named "cur".
+ */
+func (self *Message) TagsToMaildirFlags() error {
+	if !self.live() {
+		return ErrNullPointer
+	}
+	return Status(C.notmuch_message_tags_to_maildir_flags(self.message)).Err()
+}
+
+/* Re-index the e-mail corresponding to 'message' using the supplied
+ * index options, or the database defaults when 'opts' is nil.
+ *
+ * Returns the status of the re-index operation, see AddMessage.
+ *
+ * After reindexing, the caller should discard 'message' by calling
+ * Destroy, since it refers to the original message, not to the
+ * reindexed message.
+ */
+func (self *Message) Reindex(opts *IndexOpts) error {
+	if !self.live() {
+		return ErrNullPointer
+	}
+	var c_opts *C.notmuch_indexopts_t
+	if opts.live() {
+		c_opts = opts.opts
+	}
+	return Status(C.notmuch_message_reindex(self.message, c_opts)).Err()
 }
 
 /* Destroy a notmuch_message_t object.
@@ -1300,10 +2107,12 @@ func (self *Message) Thaw() Status {
  * the messages get reclaimed when the containing query is destroyed.)
  */
 func (self *Message) Destroy() {
-	if self.message == nil {
+	if !self.live() {
 		return
 	}
 	C.notmuch_message_destroy(self.message)
+	self.message = nil
+	self.h.destroyed = true
 }
 
 /* Is the given 'tags' iterator pointing at a valid tag.
@@ -1316,7 +2125,7 @@ func (self *Message) Destroy() {
  * showing how to iterate over a notmuch_tags_t object.
  */
 func (self *Tags) Valid() bool {
-	if self.tags == nil {
+	if !self.live() {
 		return false
 	}
 	v := C.notmuch_tags_valid(self.tags)
@@ -1335,7 +2144,7 @@ func (self *Tags) Valid() bool {
  * showing how to iterate over a notmuch_tags_t object.
  */
 func (self *Tags) Get() string {
-	if self.tags == nil {
+	if !self.live() {
 		return ""
 	}
 	s := C.notmuch_tags_get(self.tags)
@@ -1358,12 +2167,24 @@ func (self *Tags) String() string {
  * showing how to iterate over a notmuch_tags_t object.
  */
 func (self *Tags) MoveToNext() {
-	if self.tags == nil {
+	if !self.live() {
 		return
 	}
 	C.notmuch_tags_move_to_next(self.tags)
 }
 
+/* Return an iterator over the remaining tags of 'tags'. Like the
+ * underlying iterator it can only be ranged over once. */
+func (self *Tags) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for ; self.Valid(); self.MoveToNext() {
+			if !yield(self.Get()) {
+				return
+			}
+		}
+	}
+}
+
 /* Destroy a notmuch_tags_t object.
  *
  * It's not strictly necessary to call this function. All memory from
@@ -1371,23 +2192,241 @@ func (self *Tags) MoveToNext() {
  * message or query objects are destroyed.
  */
 func (self *Tags) Destroy() {
-	if self.tags == nil {
+	if !self.live() {
 		return
 	}
 	C.notmuch_tags_destroy(self.tags)
+	self.tags = nil
+	self.h.destroyed = true
 }
 
-// TODO: wrap notmuch_directory_<fct>
+/* Is the given 'properties' iterator pointing at a valid (key,value)
+ * pair.
+ *
+ * When this function returns TRUE, Key and Value will return valid
+ * strings. Whereas when this function returns FALSE, they return
+ * empty strings.
+ *
+ * See the documentation of Message.GetProperties for example code
+ * showing how to iterate over a Properties object.
+ */
+func (self *Properties) Valid() bool {
+	if !self.live() {
+		return false
+	}
+	v := C.notmuch_message_properties_valid(self.props)
+	if v == 0 {
+		return false
+	}
+	return true
+}
+
+/* Return the key from the current (key,value) pair. */
+func (self *Properties) Key() string {
+	if !self.Valid() {
+		return ""
+	}
+	// we don't own the returned string
+	return C.GoString(C.notmuch_message_properties_key(self.props))
+}
+
+/* Return the value from the current (key,value) pair. */
+func (self *Properties) Value() string {
+	if !self.Valid() {
+		return ""
+	}
+	// we don't own the returned string
+	return C.GoString(C.notmuch_message_properties_value(self.props))
+}
+
+/* Move the 'properties' iterator to the next (key,value) pair.
+ *
+ * If 'properties' is already pointing at the last pair then the
+ * iterator will be moved to a point just beyond that last pair,
+ * (where Valid will return FALSE).
+ */
+func (self *Properties) MoveToNext() {
+	if !self.live() {
+		return
+	}
+	C.notmuch_message_properties_move_to_next(self.props)
+}
+
+/* Return an iterator over the remaining (key,value) pairs of
+ * 'properties'. Like the underlying iterator it can only be ranged
+ * over once. */
+func (self *Properties) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for ; self.Valid(); self.MoveToNext() {
+			if !yield(self.Key(), self.Value()) {
+				return
+			}
+		}
+	}
+}
+
+/* Destroy a notmuch_message_properties_t object.
+ *
+ * It's not strictly necessary to call this function. All memory from
+ * the notmuch_message_properties_t object will be reclaimed when the
+ * containing message object is destroyed.
+ */
+func (self *Properties) Destroy() {
+	if !self.live() {
+		return
+	}
+	C.notmuch_message_properties_destroy(self.props)
+	self.props = nil
+	self.h.destroyed = true
+}
+
+/* Store an mtime within the database for 'directory'.
+ *
+ * The intention is for the caller to read the mtime of the directory
+ * from the file system, index every mail file in it, then store that
+ * mtime. A later scan only needs to look at the files of the directory
+ * when its mtime differs from the stored one.
+ *
+ * Don't store a timestamp of 0, GetMtime can not tell it from a
+ * missing one.
+ *
+ * Return value:
+ *
+ * NOTMUCH_STATUS_SUCCESS: mtime successfully stored in database.
+ *
+ * NOTMUCH_STATUS_XAPIAN_EXCEPTION: A Xapian exception
+ *	occurred, mtime not stored.
+ *
+ * NOTMUCH_STATUS_READ_ONLY_DATABASE: Database was opened in read-only
+ *	mode so directory mtime cannot be modified.
+ */
+func (self *Directory) SetMtime(mtime int64) error {
+	if !self.live() {
+		return ErrNullPointer
+	}
+	return Status(C.notmuch_directory_set_mtime(self.dir, C.time_t(mtime))).Err()
+}
+
+/* Get the mtime of a directory, as previously stored with SetMtime.
+ *
+ * Returns 0 if no mtime has previously been stored for this directory.
+ */
+func (self *Directory) GetMtime() int64 {
+	if !self.live() {
+		return 0
+	}
+	return int64(C.notmuch_directory_get_mtime(self.dir))
+}
+
+/* Get a Filenames iterator listing the base names of the messages'
+ * files in the database within the given directory.
+ *
+ * This function returns nil if it triggers a Xapian exception.
+ */
+func (self *Directory) GetChildFiles() *Filenames {
+	if !self.live() {
+		return nil
+	}
+	fnames := C.notmuch_directory_get_child_files(self.dir)
+	if fnames == nil {
+		return nil
+	}
+	return &Filenames{fnames: fnames, h: self.h.child()}
+}
+
+/* Get a Filenames iterator listing the base names of the
+ * sub-directories in the database within the given directory.
+ *
+ * This function returns nil if it triggers a Xapian exception.
+ */
+func (self *Directory) GetChildDirectories() *Filenames {
+	if !self.live() {
+		return nil
+	}
+	fnames := C.notmuch_directory_get_child_directories(self.dir)
+	if fnames == nil {
+		return nil
+	}
+	return &Filenames{fnames: fnames, h: self.h.child()}
+}
+
+/* Delete the directory document from the database, and destroy the
+ * Directory object. Assumes any child directories and files have been
+ * deleted by the caller.
+ */
+func (self *Directory) Delete() error {
+	if !self.live() {
+		return ErrNullPointer
+	}
+	st := Status(C.notmuch_directory_delete(self.dir))
+	self.dir = nil
+	self.h.destroyed = true
+	return st.Err()
+}
 
 /* Destroy a notmuch_directory_t object. */
 func (self *Directory) Destroy() {
-	if self.dir == nil {
+	if !self.live() {
 		return
 	}
 	C.notmuch_directory_destroy(self.dir)
+	self.dir = nil
+	self.h.destroyed = true
+}
+
+/* Is the given 'filenames' iterator pointing at a valid filename.
+ *
+ * When this function returns TRUE, Get will return a valid string.
+ * Whereas when this function returns FALSE, Get will return the empty
+ * string.
+ */
+func (self *Filenames) Valid() bool {
+	if !self.live() {
+		return false
+	}
+	v := C.notmuch_filenames_valid(self.fnames)
+	if v == 0 {
+		return false
+	}
+	return true
+}
+
+/* Get the current filename from 'filenames' as a string. */
+func (self *Filenames) Get() string {
+	if !self.live() {
+		return ""
+	}
+	s := C.notmuch_filenames_get(self.fnames)
+	// we don't own 's'
+
+	return C.GoString(s)
+}
+
+/* Move the 'filenames' iterator to the next filename.
+ *
+ * If 'filenames' is already pointing at the last filename then the
+ * iterator will be moved to a point just beyond that last filename,
+ * (where Valid will return FALSE and Get will return the empty
+ * string).
+ */
+func (self *Filenames) MoveToNext() {
+	if !self.live() {
+		return
+	}
+	C.notmuch_filenames_move_to_next(self.fnames)
 }
 
-// TODO: wrap notmuch_filenames_<fct>
+/* Return an iterator over the remaining filenames of 'filenames'. Like
+ * the underlying iterator it can only be ranged over once. */
+func (self *Filenames) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for ; self.Valid(); self.MoveToNext() {
+			if !yield(self.Get()) {
+				return
+			}
+		}
+	}
+}
 
 /* Destroy a notmuch_filenames_t object.
  *
@@ -1399,10 +2438,56 @@ func (self *Directory) Destroy() {
  * function will do nothing.
  */
 func (self *Filenames) Destroy() {
-	if self.fnames == nil {
+	if !self.live() {
 		return
 	}
 	C.notmuch_filenames_destroy(self.fnames)
+	self.fnames = nil
+	self.h.destroyed = true
+}
+
+/* Policy for decrypting encrypted parts while indexing. See
+ * index.decrypt in notmuch-config(1) for more details. */
+type DecryptionPolicy C.notmuch_decryption_policy_t
+
+const (
+	DECRYPT_FALSE DecryptionPolicy = iota
+	DECRYPT_TRUE
+	DECRYPT_AUTO
+	DECRYPT_NOSTASH
+)
+
+/* Specify whether to decrypt encrypted parts while indexing.
+ *
+ * Be aware that the index is likely sufficient to reconstruct the
+ * cleartext of the message itself, so please ensure that the notmuch
+ * message index is adequately protected. DO NOT SET THIS FLAG TO TRUE
+ * without considering the security of your index.
+ */
+func (self *IndexOpts) SetDecryptPolicy(policy DecryptionPolicy) error {
+	if !self.live() {
+		return ErrNullPointer
+	}
+	return Status(C.notmuch_indexopts_set_decrypt_policy(self.opts, C.notmuch_decryption_policy_t(policy))).Err()
+}
+
+/* Return whether to decrypt encrypted parts while indexing. See
+ * SetDecryptPolicy. */
+func (self *IndexOpts) GetDecryptPolicy() DecryptionPolicy {
+	if !self.live() {
+		return DECRYPT_AUTO
+	}
+	return DecryptionPolicy(C.notmuch_indexopts_get_decrypt_policy(self.opts))
+}
+
+/* Destroy a notmuch_indexopts_t object. */
+func (self *IndexOpts) Destroy() {
+	if !self.live() {
+		return
+	}
+	C.notmuch_indexopts_destroy(self.opts)
+	self.opts = nil
+	self.h.destroyed = true
 }
 
 /* EOF */
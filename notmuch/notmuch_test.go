@@ -0,0 +1,301 @@
+package notmuch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStatusErr(t *testing.T) {
+	if err := STATUS_SUCCESS.Err(); err != nil {
+		t.Errorf("STATUS_SUCCESS.Err() = %v, want nil", err)
+	}
+
+	tests := []struct {
+		status Status
+		err    error
+	}{
+		{STATUS_OUT_OF_MEMORY, ErrOutOfMemory},
+		{STATUS_READ_ONLY_DATABASE, ErrReadOnly},
+		{STATUS_NULL_POINTER, ErrNullPointer},
+		{STATUS_TAG_TOO_LONG, ErrTagTooLong},
+		{STATUS_UNBALANCED_ATOMIC, ErrUnbalancedAtomic},
+		{STATUS_UPGRADE_REQUIRED, ErrUpgradeRequired},
+		{STATUS_BAD_QUERY_SYNTAX, ErrBadQuerySyntax},
+		{STATUS_CLOSED_DATABASE, ErrClosedDatabase},
+	}
+	for _, tt := range tests {
+		err := tt.status.Err()
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Status(%d).Err() = %v, want %v", tt.status, err, tt.err)
+		}
+		if errors.Is(err, ErrFileError) {
+			t.Errorf("Status(%d).Err() matches ErrFileError", tt.status)
+		}
+		if wrapped := fmt.Errorf("add message: %w", err); !errors.Is(wrapped, tt.err) {
+			t.Errorf("wrapped Status(%d) does not match %v", tt.status, tt.err)
+		}
+		if err.Error() != tt.status.String() {
+			t.Errorf("Status(%d).Error() = %q, want %q", tt.status, err.Error(), tt.status.String())
+		}
+	}
+}
+
+func TestHandleLive(t *testing.T) {
+	db := &handle{}
+	query := db.child()
+	messages := query.child()
+	tags := messages.child()
+	other := db.child()
+
+	query.destroyed = true
+	for name, h := range map[string]*handle{"query": query, "messages": messages, "tags": tags} {
+		if h.live() {
+			t.Errorf("%s is live after its query was destroyed", name)
+		}
+	}
+	if !db.live() || !other.live() {
+		t.Error("destroying a query destroyed its database or a sibling")
+	}
+}
+
+func TestNilObjects(t *testing.T) {
+	var (
+		db    *Database
+		msg   *Message
+		msgs  *Messages
+		tags  *Tags
+		props *Properties
+		files *Filenames
+		dir   *Directory
+	)
+
+	if _, err := db.AddMessage("/nonexistent"); !errors.Is(err, ErrClosedDatabase) {
+		t.Errorf("AddMessage on a nil database = %v, want ErrClosedDatabase", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("Close on a nil database = %v", err)
+	}
+	if err := msg.AddTag("travel"); !errors.Is(err, ErrNullPointer) {
+		t.Errorf("AddTag on a nil message = %v, want ErrNullPointer", err)
+	}
+	if id := msg.GetMessageId(); id != "" {
+		t.Errorf("GetMessageId on a nil message = %q", id)
+	}
+	for range msgs.All() {
+		t.Error("nil messages yielded a message")
+	}
+	for range tags.All() {
+		t.Error("nil tags yielded a tag")
+	}
+	for range props.All() {
+		t.Error("nil properties yielded a property")
+	}
+	for range files.All() {
+		t.Error("nil filenames yielded a file")
+	}
+	if err := dir.SetMtime(1); !errors.Is(err, ErrNullPointer) {
+		t.Errorf("SetMtime on a nil directory = %v, want ErrNullPointer", err)
+	}
+	if files := dir.GetChildFiles(); files != nil {
+		t.Errorf("GetChildFiles on a nil directory = %v", files)
+	}
+	msg.Destroy()
+	msgs.Destroy()
+	dir.Destroy()
+}
+
+// newTestDatabase creates a database holding n emails, with IDs
+// <1@example.com> to <n@example.com>. Tests using it are skipped when
+// libnotmuch can not create a database, as with a stub library.
+func newTestDatabase(t *testing.T, n int) *Database {
+	t.Helper()
+
+	dir := t.TempDir()
+	db, err := NewDatabase(dir)
+	if err != nil || !db.live() {
+		t.Skipf("libnotmuch can not create a database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	maildir := filepath.Join(dir, "cur")
+	if err := os.Mkdir(maildir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= n; i++ {
+		name := filepath.Join(maildir, fmt.Sprintf("%d.eml", i))
+		email := fmt.Sprintf("From: a@example.com\nTo: b@example.com\nSubject: Flight %d\nMessage-ID: <%d@example.com>\nDate: Mon, 01 Jan 2024 %02d:00:00 +0000\n\nConfirmed\n", i, i, i)
+		if err := os.WriteFile(name, []byte(email), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := db.AddMessage(name)
+		if err != nil {
+			t.Fatalf("AddMessage: %v", err)
+		}
+		msg.Destroy()
+	}
+	return db
+}
+
+func TestMessageUseAfterDestroy(t *testing.T) {
+	db := newTestDatabase(t, 1)
+
+	msg, err := db.FindMessage("1@example.com")
+	if err != nil || msg == nil {
+		t.Fatalf("FindMessage = %v, %v", msg, err)
+	}
+	if err := msg.AddTag("travel"); err != nil {
+		t.Fatalf("AddTag: %v", err)
+	}
+
+	msg.Destroy()
+	if err := msg.AddTag("travel"); !errors.Is(err, ErrNullPointer) {
+		t.Errorf("AddTag after Destroy = %v, want ErrNullPointer", err)
+	}
+	if err := msg.AddProperty("voyage.type", "flight"); !errors.Is(err, ErrNullPointer) {
+		t.Errorf("AddProperty after Destroy = %v, want ErrNullPointer", err)
+	}
+	if id := msg.GetMessageId(); id != "" {
+		t.Errorf("GetMessageId after Destroy = %q", id)
+	}
+	// A second Destroy is harmless
+	msg.Destroy()
+}
+
+func TestObjectsDieWithTheirOwner(t *testing.T) {
+	db := newTestDatabase(t, 2)
+
+	q := db.CreateQuery("*")
+	messages, err := q.SearchMessages()
+	if err != nil {
+		t.Fatalf("SearchMessages: %v", err)
+	}
+	q.Destroy()
+	for range messages.All() {
+		t.Fatal("messages of a destroyed query yielded a message")
+	}
+
+	msg, err := db.FindMessage("2@example.com")
+	if err != nil || msg == nil {
+		t.Fatalf("FindMessage = %v, %v", msg, err)
+	}
+	tags := msg.GetTags()
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := msg.AddTag("travel"); !errors.Is(err, ErrNullPointer) {
+		t.Errorf("AddTag after Close = %v, want ErrNullPointer", err)
+	}
+	for range tags.All() {
+		t.Error("tags of a closed database yielded a tag")
+	}
+	if _, err := db.AddMessage("/nonexistent"); !errors.Is(err, ErrClosedDatabase) {
+		t.Errorf("AddMessage after Close = %v, want ErrClosedDatabase", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+}
+
+func TestMessagesAll(t *testing.T) {
+	db := newTestDatabase(t, 3)
+
+	q := db.CreateQuery("*")
+	defer q.Destroy()
+	q.SetSort(SORT_OLDEST_FIRST)
+
+	messages, err := q.SearchMessages()
+	if err != nil {
+		t.Fatalf("SearchMessages: %v", err)
+	}
+	var ids []string
+	for msg := range messages.All() {
+		ids = append(ids, msg.GetMessageId())
+		msg.Destroy()
+	}
+	want := []string{"1@example.com", "2@example.com", "3@example.com"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("All yielded %v, want %v", ids, want)
+	}
+}
+
+func TestMessagesAllBreaksEarly(t *testing.T) {
+	db := newTestDatabase(t, 3)
+
+	q := db.CreateQuery("*")
+	defer q.Destroy()
+
+	messages, err := q.SearchMessages()
+	if err != nil {
+		t.Fatalf("SearchMessages: %v", err)
+	}
+	seen := 0
+	for msg := range messages.All() {
+		seen++
+		if msg.GetMessageId() == "" {
+			t.Error("message has no ID")
+		}
+		break
+	}
+	if seen != 1 {
+		t.Fatalf("loop ran %d times after break, want 1", seen)
+	}
+
+	// The query and the database stay usable after the early break
+	messages.Destroy()
+	for range messages.All() {
+		t.Fatal("destroyed messages yielded a message")
+	}
+	count, err := q.CountMessages()
+	if err != nil || count != 3 {
+		t.Errorf("CountMessages = %d, %v, want 3", count, err)
+	}
+}
+
+func TestTagsAndPropertiesAll(t *testing.T) {
+	db := newTestDatabase(t, 1)
+
+	msg, err := db.FindMessage("1@example.com")
+	if err != nil || msg == nil {
+		t.Fatalf("FindMessage = %v, %v", msg, err)
+	}
+	defer msg.Destroy()
+
+	for _, tag := range []string{"travel", "flight", "inbox"} {
+		if err := msg.AddTag(tag); err != nil {
+			t.Fatalf("AddTag: %v", err)
+		}
+	}
+	var tags []string
+	for tag := range msg.GetTags().All() {
+		tags = append(tags, tag)
+	}
+	if want := []string{"flight", "inbox", "travel"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags = %v, want %v", tags, want)
+	}
+
+	for _, p := range [][2]string{{"voyage.type", "flight"}, {"voyage.name", "UA 123"}, {"other", "x"}} {
+		if err := msg.AddProperty(p[0], p[1]); err != nil {
+			t.Fatalf("AddProperty: %v", err)
+		}
+	}
+	props := map[string]string{}
+	for key, value := range msg.GetProperties("voyage.", false).All() {
+		props[key] = value
+	}
+	if want := map[string]string{"voyage.type": "flight", "voyage.name": "UA 123"}; !reflect.DeepEqual(props, want) {
+		t.Errorf("properties = %v, want %v", props, want)
+	}
+
+	var keys []string
+	for key := range msg.GetProperties("", false).All() {
+		keys = append(keys, key)
+		break
+	}
+	if len(keys) != 1 {
+		t.Errorf("property loop ran %d times after break, want 1", len(keys))
+	}
+}